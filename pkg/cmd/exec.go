@@ -0,0 +1,195 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"sort"
+	"strings"
+	"syscall"
+
+	"github.com/pastdev/clconf/v3/pkg/core"
+	"github.com/pastdev/clconf/v3/pkg/template"
+	"github.com/pastdev/clconf/v3/pkg/yamljson"
+	"github.com/spf13/cobra"
+)
+
+// execProcess replaces the current process. It is a variable so tests can
+// observe the exec without actually replacing the test process.
+var execProcess = syscall.Exec
+
+var invalidEnvNameChars = regexp.MustCompile(`[^A-Za-z0-9_]+`)
+
+type execContext struct {
+	*rootContext
+	decrypt           []string
+	envPrefix         optionalString
+	maps              []string
+	templates         []string
+	templateExtension string
+}
+
+func execCmd(rootCmdContext *rootContext) *cobra.Command {
+	var c = &execContext{rootContext: rootCmdContext}
+
+	var cmd = &cobra.Command{
+		Use:   "exec [options] -- <command> [args...]",
+		Short: "Run a command with config injected as environment variables",
+		Long: `Run a command with config injected as environment variables. The command
+replaces clconf (exec) so that signals are delivered directly to it and it
+keeps the PID (important when running as PID 1 in a container).
+
+With --env-prefix, every value in the config is flattened into a variable
+named by the prefix followed by the upper cased path with each non
+alphanumeric run replaced by _ (ie: /db/host-name with prefix APP_ becomes
+APP_DB_HOST_NAME). Each --map explicitly names the variable for a single path
+and takes precedence. Maps and lists mapped explicitly are json encoded. The
+existing environment is preserved, config values override it.`,
+		Example: `  # Inject all config as APP_* and the decrypted db password as DB_PASSWORD
+  clconf --yaml config.yml exec --env-prefix APP_ \
+    --decrypt /db/password --map /db/password=DB_PASSWORD -- ./app --port 8080
+
+  # Render config templates in place before starting
+  clconf --yaml config.yml exec --template /etc/app -- ./app`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return c.exec(args)
+		},
+	}
+
+	cmd.Flags().StringArrayVar(
+		&c.decrypt,
+		"decrypt",
+		nil,
+		"A `list` of paths whose values needs to be decrypted")
+	cmd.Flags().Var(
+		&c.envPrefix,
+		"env-prefix",
+		"Flatten all config values into environment variables starting with this `prefix` (may be empty)")
+	cmd.Flags().StringArrayVar(
+		&c.maps,
+		"map",
+		nil,
+		"A `/path=NAME` pair setting the environment variable NAME to the value at path")
+	cmd.Flags().StringArrayVar(
+		&c.templates,
+		"template",
+		nil,
+		"A template `file` or folder to process in place before running the command")
+	cmd.Flags().StringVar(
+		&c.templateExtension,
+		"template-extension",
+		".clconf",
+		"Template file extension (will be removed during templating).")
+
+	return cmd
+}
+
+func (c *execContext) exec(args []string) error {
+	value, err := (&getvContext{rootContext: c.rootContext, decrypt: c.decrypt}).getValue("/")
+	if err != nil {
+		return err
+	}
+
+	if len(c.templates) > 0 {
+		err = c.processTemplates(value)
+		if err != nil {
+			return err
+		}
+	}
+
+	env, err := c.environment(value)
+	if err != nil {
+		return err
+	}
+
+	command, err := exec.LookPath(args[0])
+	if err != nil {
+		return fmt.Errorf("find %s: %w", args[0], err)
+	}
+	err = execProcess(command, args, env)
+	if err != nil {
+		return fmt.Errorf("exec %s: %w", command, err)
+	}
+	return nil
+}
+
+// environment returns the current environment with the flattened and mapped
+// config values added.
+func (c *execContext) environment(value interface{}) ([]string, error) {
+	vars := map[string]string{}
+	for _, keyValue := range os.Environ() {
+		parts := strings.SplitN(keyValue, "=", 2)
+		if len(parts) == 2 {
+			vars[parts[0]] = parts[1]
+		}
+	}
+
+	if c.envPrefix.set {
+		for key, v := range core.ToKvMap(value) {
+			vars[envName(c.envPrefix.value, key)] = v
+		}
+	}
+
+	for _, m := range c.maps {
+		pathName := strings.SplitN(m, "=", 2)
+		if len(pathName) != 2 || pathName[1] == "" {
+			return nil, fmt.Errorf("failed to parse map, expected `/key/path=NAME`, found: %s", m)
+		}
+		mapped, err := core.GetValue(value, pathName[0])
+		if err != nil {
+			return nil, fmt.Errorf("get value at %s: %w", pathName[0], err)
+		}
+		envValue, err := envValueString(mapped)
+		if err != nil {
+			return nil, fmt.Errorf("map %s: %w", pathName[0], err)
+		}
+		vars[pathName[1]] = envValue
+	}
+
+	env := make([]string, 0, len(vars))
+	for name, v := range vars {
+		env = append(env, name+"="+v)
+	}
+	sort.Strings(env)
+	return env, nil
+}
+
+func (c *execContext) processTemplates(value interface{}) error {
+	secretAgent, _ := c.newSecretAgent()
+	results, err := template.ProcessTemplates(c.templates, "", value, secretAgent,
+		template.TemplateOptions{
+			CopyTemplatePerms: true,
+			DirMode:           0775,
+			Extension:         c.templateExtension,
+		})
+	if err != nil {
+		return fmt.Errorf("process templates: %w", err)
+	}
+
+	logTemplateResults(results, false)
+	return nil
+}
+
+// envName converts a / separated key path into an environment variable name.
+func envName(prefix, key string) string {
+	name := strings.Trim(invalidEnvNameChars.ReplaceAllString(key, "_"), "_")
+	return prefix + strings.ToUpper(name)
+}
+
+func envValueString(value interface{}) (string, error) {
+	switch value.(type) {
+	case nil:
+		return "", nil
+	case map[interface{}]interface{}, []interface{}:
+		marshaled, err := json.Marshal(yamljson.ConvertMapIToMapS(value))
+		if err != nil {
+			return "", fmt.Errorf("marshal: %w", err)
+		}
+		return string(marshaled), nil
+	default:
+		return fmt.Sprintf("%v", value), nil
+	}
+}
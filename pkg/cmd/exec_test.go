@@ -0,0 +1,97 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func stubExecProcess(t *testing.T) (*string, *[]string, *[]string) {
+	var argv0 string
+	var argv, envv []string
+	original := execProcess
+	execProcess = func(a0 string, a []string, e []string) error {
+		argv0, argv, envv = a0, a, e
+		return nil
+	}
+	t.Cleanup(func() { execProcess = original })
+	return &argv0, &argv, &envv
+}
+
+func TestExec(t *testing.T) {
+	argv0, argv, envv := stubExecProcess(t)
+	t.Setenv("CLCONF_EXEC_TEST", "kept")
+
+	testDataPath := filepath.Join("..", "..", "testdata")
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"--ignore-env",
+		"--yaml", filepath.Join(testDataPath, "testconfig.yml"),
+		"--secret-keyring", filepath.Join(testDataPath, "test.secring.gpg"),
+		"exec",
+		"--env-prefix", "APP_",
+		"--decrypt", "/app/db/password",
+		"--map", "/app/db/password=DB_PASSWORD",
+		"--map", "/app/aliases=ALIASES",
+		"--", "sh", "-c", "true"})
+	require.NoError(t, cmd.Execute())
+
+	assert.Equal(t, "sh", filepath.Base(*argv0))
+	assert.Equal(t, []string{"sh", "-c", "true"}, *argv)
+	assert.Contains(t, *envv, "CLCONF_EXEC_TEST=kept")
+	assert.Contains(t, *envv, "APP_APP_DB_HOSTNAME=db.pastdev.com")
+	assert.Contains(t, *envv, "APP_APP_DB_PASSWORD_PLAINTEXT=SECRET_PASS")
+	assert.Contains(t, *envv, "APP_APP_DB_PORT=3306")
+	assert.Contains(t, *envv, "APP_APP_ALIASES_0=foo")
+	assert.Contains(t, *envv, "DB_PASSWORD=SECRET_PASS")
+	assert.Contains(t, *envv, `ALIASES=["foo","bar"]`)
+}
+
+func TestExecTemplate(t *testing.T) {
+	_, _, envv := stubExecProcess(t)
+	temp := t.TempDir()
+	templateFile := filepath.Join(temp, "app.conf.clconf")
+	require.NoError(t, os.WriteFile(templateFile, []byte(`{{ getv "/app/db/hostname" }}`), 0600))
+
+	testDataPath := filepath.Join("..", "..", "testdata")
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"--ignore-env",
+		"--yaml", filepath.Join(testDataPath, "testconfig.yml"),
+		"exec",
+		"--template", temp,
+		"--map", "/app/db/port=PORT",
+		"--", "sh"})
+	require.NoError(t, cmd.Execute())
+
+	actual, err := os.ReadFile(filepath.Join(temp, "app.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "db.pastdev.com", string(actual))
+	assert.Contains(t, *envv, "PORT=3306")
+	for _, keyValue := range *envv {
+		assert.NotContains(t, keyValue, "APP_")
+	}
+}
+
+func TestExecErrors(t *testing.T) {
+	stubExecProcess(t)
+	testDataPath := filepath.Join("..", "..", "testdata")
+
+	for _, args := range [][]string{
+		{"exec", "--map", "/app/db/port", "--", "sh"},
+		{"exec", "--map", "/not/there=X", "--", "sh"},
+		{"exec", "--", "clconf-not-a-real-command"},
+	} {
+		cmd := rootCmd()
+		cmd.SetArgs(append([]string{"--ignore-env",
+			"--yaml", filepath.Join(testDataPath, "testconfig.yml")}, args...))
+		assert.Error(t, cmd.Execute(), "%v", args)
+	}
+}
+
+func TestEnvName(t *testing.T) {
+	assert.Equal(t, "APP_DB_HOST_NAME", envName("APP_", "/db/host-name"))
+	assert.Equal(t, "LIST_0", envName("", "/list/0"))
+	assert.Equal(t, "x_A_B", envName("x_", "/a.b/"))
+}
@@ -9,8 +9,10 @@ import (
 	"reflect"
 	"testing"
 
+	"github.com/pastdev/clconf/v3/pkg/core"
 	"github.com/pastdev/clconf/v3/pkg/secret"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func testBase64Yaml(yaml string) []string {
@@ -209,3 +211,42 @@ func TestGetTemplateDelims(t *testing.T) {
 	}
 	testGetTemplate(t, "template string", "bar", data, context)
 }
+
+func TestConfSourcesSecretAgent(t *testing.T) {
+	keyFile := path.Join("..", "..", "testdata", "test.secring.gpg")
+	temp := t.TempDir()
+	plainFile := filepath.Join(temp, "plain.yml")
+	require.NoError(t, os.WriteFile(plainFile, []byte("a: 1\n"), 0600))
+	encryptedFile := filepath.Join(temp, "encrypted.yml")
+	secretAgent, err := secret.NewSecretAgentFromFile(keyFile)
+	require.NoError(t, err)
+	encrypted := map[interface{}]interface{}{"b": "secret"}
+	require.NoError(t, secretAgent.EncryptTree(encrypted))
+	require.NoError(t, core.SaveConf(encrypted, encryptedFile))
+
+	context := rootContext{ignoreEnv: true, yaml: []string{plainFile, encryptedFile}}
+	value, err := context.getValue("/b")
+	require.NoError(t, err, "no keyring configured")
+	assert.NotEqual(t, "secret", value)
+
+	context.secretKeyring = *newOptionalString(keyFile, true)
+	value, err = context.getValue("/b")
+	require.NoError(t, err)
+	assert.Equal(t, "secret", value)
+
+	// a keyring that can not be loaded only fails configs that need it
+	context.secretKeyring = *newOptionalString(path.Join("..", "..", "testdata", "missing.gpg"), true)
+	_, err = context.getValue("/b")
+	require.ErrorContains(t, err, "load secret agent")
+	context.yaml = []string{plainFile}
+	value, err = context.getValue("/a")
+	require.NoError(t, err)
+	assert.Equal(t, 1, value)
+
+	context = rootContext{
+		secretKeyringBase64: *newOptionalString("not base64!", true),
+		yaml:                []string{encryptedFile},
+	}
+	_, err = context.getValue("/")
+	require.ErrorContains(t, err, "load secret agent")
+}
@@ -3,10 +3,8 @@ package cmd
 import (
 	"fmt"
 
-	"github.com/pastdev/clconf/v3/pkg/yamljson"
+	"github.com/pastdev/clconf/v3/pkg/jsonpath"
 	"github.com/spf13/cobra"
-	"github.com/vmware-labs/yaml-jsonpath/pkg/yamlpath"
-	yv3 "gopkg.in/yaml.v3"
 )
 
 type jsonpathContext struct {
@@ -53,49 +51,24 @@ func (c jsonpathContext) jsonpath(
 }
 
 func evaluateJSONPath(path string, data interface{}, first bool) (interface{}, error) {
-	// We have to go through a complicated marshal->unmarshal->evaluate->marshal->unmarshal
-	// because our chosen jsonpath library deals in yaml.v3 Node objects, whereas the majority
-	// of clconf deals with maps and slices. Our final marshaller is also custom in that
-	// it may output in something besides yaml (properties, json, etc), so skipping the final
-	// unmarshal isn't universally possible. It's probably possible to optimize this somewhere,
-	// but given the use case performance at this level isn't a concern.
-	p, err := yamlpath.NewPath(path)
+	p, err := jsonpath.Compile(path)
 	if err != nil {
 		return nil, fmt.Errorf("invalid jsonpath [%s]: %w", path, err)
 	}
 
-	yml, err := yv3.Marshal(data)
-	if err != nil {
-		return nil, fmt.Errorf("marshalling via yaml.v3: %w", err)
-	}
-
-	var n yv3.Node
-
-	err = yv3.Unmarshal(yml, &n)
-	if err != nil {
-		return nil, fmt.Errorf("unmarshalling to yaml.v3.Node: %w", err)
-	}
-
-	results, err := p.Find(&n)
-	if err != nil {
-		return nil, fmt.Errorf("executing jsonpath.Find: %w", err)
-	}
-
+	matches := p.Find(data)
 	if first {
-		yml, err = yv3.Marshal(results[0])
-	} else {
-		yml, err = yv3.Marshal(results)
-	}
-	if err != nil {
-		return nil, fmt.Errorf("converting back to yaml via yaml.v3: %w", err)
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("jsonpath [%s] matched nothing", path)
+		}
+		return matches[0].Value, nil
 	}
 
-	result, err := yamljson.UnmarshalSingleYaml(string(yml))
-	if err != nil {
-		return nil, fmt.Errorf("converting back to clconf interface: %w", err)
+	values := make([]interface{}, 0, len(matches))
+	for _, match := range matches {
+		values = append(values, match.Value)
 	}
-
-	return result, nil
+	return values, nil
 }
 
 func jsonpathCmd(rootCmdContext *rootContext) *cobra.Command {
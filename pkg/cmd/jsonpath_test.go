@@ -57,4 +57,32 @@ tag: example.org/image:latest
 		"- example.org/otherimage:latest\n")
 	test("filter selection on child content 2, first only", "$.images[?(@.dockerfile == 'docker/test/Dockerfile')].tag", true,
 		"example.org/otherimage:latest\n")
+	test("implicit root", "images[1].tag", true,
+		"example.org/otherimage:latest\n")
+	test("implicit root dot", ".images[1].tag", true,
+		"example.org/otherimage:latest\n")
+	test("implicit root recursive", "images..tag", false,
+		"- example.org/image:latest\n- example.org/otherimage:latest\n")
+}
+
+func TestJSONPathTypes(t *testing.T) {
+	data, err := yamljson.UnmarshalSingleYaml("ports:\n  80: http\n  443: {tls: true}\n")
+	require.NoError(t, err)
+
+	result, err := evaluateJSONPath("$.ports", data, true)
+	require.NoError(t, err)
+	require.Equal(t,
+		map[interface{}]interface{}{80: "http", 443: map[interface{}]interface{}{"tls": true}},
+		result,
+		"integer keys and types preserved")
+
+	result, err = evaluateJSONPath("$.ports[443].tls", data, false)
+	require.NoError(t, err)
+	require.Equal(t, []interface{}{true}, result)
+
+	_, err = evaluateJSONPath("$.ports[8080]", data, true)
+	require.Error(t, err, "first of nothing")
+
+	_, err = evaluateJSONPath("$.ports[", data, false)
+	require.Error(t, err)
 }
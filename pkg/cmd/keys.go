@@ -0,0 +1,212 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/pastdev/clconf/v3/pkg/secret"
+	"github.com/spf13/cobra"
+)
+
+type keysContext struct {
+	*rootContext
+	base64Output bool
+	bits         int
+	comment      string
+	email        string
+	name         string
+	output       string
+}
+
+func keysCmd(rootCmdContext *rootContext) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "keys",
+		Short: "Generate and inspect gpg keyrings used by the secret agent",
+		Long: `Generate and inspect gpg keyrings used by the secret agent without
+requiring a gpg installation.`,
+	}
+
+	cmd.AddCommand(
+		keysExportPublicCmd(rootCmdContext),
+		keysGenerateCmd(rootCmdContext),
+		keysInfoCmd(rootCmdContext))
+
+	return cmd
+}
+
+func keysExportPublicCmd(rootCmdContext *rootContext) *cobra.Command {
+	var c = &keysContext{rootContext: rootCmdContext}
+
+	var cmd = &cobra.Command{
+		Use:   "export-public [options]",
+		Short: "Export the public portion of the secret keyring",
+		Long: `Export the public portion of the keyring specified by --secret-keyring,
+--secret-keyring-base64 or their environment equivalents. The result can
+encrypt values, but not decrypt them.`,
+		Example: `  # Create a public keyring for use in CI
+  clconf --secret-keyring secring.gpg keys export-public --output pubring.gpg`,
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return c.exportPublic()
+		},
+	}
+
+	c.addOutputFlags(cmd)
+
+	return cmd
+}
+
+func keysGenerateCmd(rootCmdContext *rootContext) *cobra.Command {
+	var c = &keysContext{rootContext: rootCmdContext}
+
+	var cmd = &cobra.Command{
+		Use:   "generate [options]",
+		Short: "Generate a new secret keyring",
+		Example: `  # Write a new keyring to a file
+  clconf keys generate --name myapp --email myapp@example.com --output secring.gpg
+
+  # Generate a keyring suitable for SECRET_KEYRING_BASE64
+  SECRET_KEYRING_BASE64="$(clconf keys generate --name myapp --base64)"`,
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return c.generate()
+		},
+	}
+
+	cmd.Flags().IntVar(
+		&c.bits,
+		"bits",
+		secret.DefaultKeyBits,
+		"The size of the generated RSA keys")
+	cmd.Flags().StringVar(
+		&c.comment,
+		"comment",
+		"",
+		"The comment portion of the key identity")
+	cmd.Flags().StringVar(
+		&c.email,
+		"email",
+		"",
+		"The email portion of the key identity")
+	cmd.Flags().StringVar(
+		&c.name,
+		"name",
+		"clconf",
+		"The name portion of the key identity")
+	c.addOutputFlags(cmd)
+
+	return cmd
+}
+
+func keysInfoCmd(rootCmdContext *rootContext) *cobra.Command {
+	var c = &keysContext{rootContext: rootCmdContext}
+
+	var cmd = &cobra.Command{
+		Use:   "info [keyring]",
+		Short: "Print the key ids and fingerprints in a keyring",
+		Long: `Print the key ids and fingerprints in the supplied keyring file, or if not
+supplied, the keyring specified by --secret-keyring, --secret-keyring-base64
+or their environment equivalents.`,
+		Args: cobra.MaximumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return c.info(args)
+		},
+	}
+
+	return cmd
+}
+
+func (c *keysContext) addOutputFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(
+		&c.base64Output,
+		"base64",
+		false,
+		"Base64 encode the keyring (as expected by --secret-keyring-base64)")
+	cmd.Flags().StringVar(
+		&c.output,
+		"output",
+		"",
+		"A `file` to write the keyring to (defaults to stdout)")
+}
+
+func (c *keysContext) exportPublic() error {
+	secretAgent, err := c.newSecretAgent()
+	if err != nil {
+		return fmt.Errorf("load secret agent: %w", err)
+	}
+	keyring, err := secretAgent.PublicKeyring()
+	if err != nil {
+		return fmt.Errorf("export public: %w", err)
+	}
+	return c.write(keyring)
+}
+
+func (c *keysContext) generate() error {
+	keyring, err := secret.GenerateKeyring(c.name, c.comment, c.email, c.bits)
+	if err != nil {
+		return fmt.Errorf("generate: %w", err)
+	}
+	return c.write(keyring)
+}
+
+func (c *keysContext) info(args []string) error {
+	var secretAgent *secret.SecretAgent
+	var err error
+	if len(args) > 0 {
+		secretAgent, err = secret.NewSecretAgentFromFile(args[0])
+	} else {
+		secretAgent, err = c.newSecretAgent()
+	}
+	if err != nil {
+		return fmt.Errorf("load secret agent: %w", err)
+	}
+
+	infos, err := secretAgent.KeyInfo()
+	if err != nil {
+		return fmt.Errorf("key info: %w", err)
+	}
+
+	fmt.Print(formatKeyInfo(infos))
+	return nil
+}
+
+func (c *keysContext) write(keyring []byte) error {
+	if c.base64Output {
+		keyring = []byte(base64.StdEncoding.EncodeToString(keyring) + "\n")
+	}
+
+	if c.output == "" {
+		fmt.Print(string(keyring))
+		return nil
+	}
+
+	err := os.WriteFile(c.output, keyring, 0600)
+	if err != nil {
+		return fmt.Errorf("write %s: %w", c.output, err)
+	}
+	return nil
+}
+
+func formatKeyInfo(infos []secret.KeyInfo) string {
+	var builder strings.Builder
+	for _, info := range infos {
+		kind := "pub"
+		switch {
+		case info.Subkey && info.Secret:
+			kind = "ssb"
+		case info.Subkey:
+			kind = "sub"
+		case info.Secret:
+			kind = "sec"
+		}
+		fmt.Fprintf(&builder, "%s  %s  %s\n", kind, info.KeyID, info.Created.UTC().Format(time.DateOnly))
+		fmt.Fprintf(&builder, "     fingerprint: %s\n", info.Fingerprint)
+		for _, identity := range info.Identities {
+			fmt.Fprintf(&builder, "     uid: %s\n", identity)
+		}
+	}
+	return builder.String()
+}
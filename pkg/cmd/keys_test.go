@@ -0,0 +1,82 @@
+package cmd
+
+import (
+	"encoding/base64"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pastdev/clconf/v3/pkg/secret"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeysGenerate(t *testing.T) {
+	temp := t.TempDir()
+	keyFile := filepath.Join(temp, "secring.gpg")
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"keys", "generate",
+		"--bits", "1024",
+		"--base64",
+		"--output", keyFile})
+	require.NoError(t, cmd.Execute())
+
+	stat, err := os.Stat(keyFile)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), stat.Mode().Perm())
+
+	content, err := os.ReadFile(keyFile)
+	require.NoError(t, err)
+	secretAgent, err := secret.NewSecretAgentFromBase64(string(content))
+	require.NoError(t, err)
+
+	encrypted, err := secretAgent.Encrypt("foo")
+	require.NoError(t, err)
+	decrypted, err := secretAgent.Decrypt(encrypted)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", decrypted)
+}
+
+func TestKeysExportPublic(t *testing.T) {
+	temp := t.TempDir()
+	keyFile := filepath.Join("..", "..", "testdata", "test.secring.gpg")
+	publicFile := filepath.Join(temp, "pubring.gpg")
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"--ignore-env", "--secret-keyring", keyFile,
+		"keys", "export-public",
+		"--output", publicFile})
+	require.NoError(t, cmd.Execute())
+
+	publicAgent, err := secret.NewSecretAgentFromFile(publicFile)
+	require.NoError(t, err)
+	infos, err := publicAgent.KeyInfo()
+	require.NoError(t, err)
+	for _, info := range infos {
+		assert.False(t, info.Secret)
+	}
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"--ignore-env", "keys", "export-public"})
+	assert.Error(t, cmd.Execute())
+}
+
+func TestFormatKeyInfo(t *testing.T) {
+	keyFile := filepath.Join("..", "..", "testdata", "test.secring.gpg")
+	key, err := os.ReadFile(keyFile)
+	require.NoError(t, err)
+	secretAgent, err := secret.NewSecretAgentFromBase64(base64.StdEncoding.EncodeToString(key))
+	require.NoError(t, err)
+	keyInfos, err := secretAgent.KeyInfo()
+	require.NoError(t, err)
+
+	assert.Equal(t,
+		`sec  3F86F7E9706BFCED  2017-12-08
+     fingerprint: DE6D23DE7566FCF0F2BC4D913F86F7E9706BFCED
+     uid: Test (Tester key) <noreply@pastdev.com>
+ssb  9079038C39670FAB  2017-12-08
+     fingerprint: 2BEFC55126F6EA95454DBFD89079038C39670FAB
+`,
+		formatKeyInfo(keyInfos))
+}
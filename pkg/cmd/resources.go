@@ -0,0 +1,93 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pastdev/clconf/v3/pkg/template"
+	"github.com/spf13/cobra"
+)
+
+type resourcesContext struct {
+	*rootContext
+	resourceOptions template.ResourceOptions
+}
+
+func resourcesCmd(rootCmdContext *rootContext) *cobra.Command {
+	c := &resourcesContext{rootContext: rootCmdContext}
+
+	var cmd = &cobra.Command{
+		Use:   "resources <confdir>",
+		Short: "Process confd style template resources",
+		Long: `Process confd style template resources. Each <confdir>/conf.d/*.toml file
+declares a [template] resource with:
+
+  src         the template, relative to <confdir>/templates
+  dest        the file to write
+  mode        octal permissions (defaults to those of an existing dest or 0644)
+  uid, gid    ownership (defaults to unchanged)
+  prefix      prepended to all template getv/gets paths
+  keys        limit the values available to the template to these paths
+  check_cmd   run to validate the staged result ({{.src}} is its path)
+  reload_cmd  run after dest has been updated
+
+The result is staged next to dest and only when it differs from dest is it
+checked, moved into place and reloaded. See:
+
+  https://github.com/kelseyhightower/confd/blob/master/docs/template-resources.md`,
+		Example: `  # /etc/confd/conf.d/nginx.toml
+  #   [template]
+  #   src = "nginx.conf.tmpl"
+  #   dest = "/etc/nginx/nginx.conf"
+  #   keys = ["/nginx"]
+  #   check_cmd = "/usr/sbin/nginx -t -c {{.src}}"
+  #   reload_cmd = "/usr/sbin/nginx -s reload"
+  clconf --yaml /etc/config/app.yml resources /etc/confd`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return c.resources(args[0])
+		},
+	}
+
+	cmd.Flags().BoolVar(
+		&c.resourceOptions.Noop,
+		"noop",
+		false,
+		"Render and check, but do not update dest or reload")
+	cmd.Flags().BoolVar(
+		&c.resourceOptions.SyncOnly,
+		"sync-only",
+		false,
+		"Update dest without running check_cmd or reload_cmd")
+	cmd.Flags().StringVar(
+		&c.resourceOptions.LeftDelim,
+		"left-delimiter",
+		"{{",
+		"Delimiter to use when parsing templates for substitutions")
+	cmd.Flags().StringVar(
+		&c.resourceOptions.RightDelim,
+		"right-delimiter",
+		"}}",
+		"Delimiter to use when parsing templates for substitutions")
+
+	return cmd
+}
+
+func (c *resourcesContext) resources(confDir string) error {
+	secretAgent, _ := c.newSecretAgent()
+	value, err := c.getValue("/")
+	if err != nil {
+		return err
+	}
+
+	results, err := template.ProcessResources(confDir, value, secretAgent, c.resourceOptions)
+	for _, result := range results {
+		if result.Changed {
+			fmt.Fprintf(os.Stderr, "Templated: %q => %q\n", result.Src, result.Dest)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("process resources: %w", err)
+	}
+	return nil
+}
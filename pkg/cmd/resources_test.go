@@ -0,0 +1,32 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestResourcesCmd(t *testing.T) {
+	temp := t.TempDir()
+	dest := filepath.Join(temp, "hostname.txt")
+	require.NoError(t, os.MkdirAll(filepath.Join(temp, "conf.d"), 0700))
+	require.NoError(t, os.MkdirAll(filepath.Join(temp, "templates"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(temp, "conf.d", "hostname.toml"),
+		[]byte("[template]\nsrc = \"hostname.tmpl\"\ndest = \""+filepath.ToSlash(dest)+"\"\nprefix = \"/app/db\"\n"),
+		0600))
+	require.NoError(t, os.WriteFile(filepath.Join(temp, "templates", "hostname.tmpl"),
+		[]byte(`{{ getv "/hostname" }}`), 0600))
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"--ignore-env",
+		"--yaml", filepath.Join("..", "..", "testdata", "testconfig.yml"),
+		"resources", temp})
+	require.NoError(t, cmd.Execute())
+
+	actual, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "db.pastdev.com", string(actual))
+}
@@ -9,6 +9,7 @@ import (
 
 	"github.com/pastdev/clconf/v3/pkg/conf"
 	"github.com/pastdev/clconf/v3/pkg/core"
+	"github.com/pastdev/clconf/v3/pkg/secret"
 	"github.com/pastdev/clconf/v3/pkg/yamljson"
 	"github.com/spf13/cobra"
 )
@@ -16,6 +17,8 @@ import (
 type rootContext struct {
 	ignoreEnv           bool
 	prefix              optionalString
+	publicKeyring       optionalString
+	publicKeyringBase64 optionalString
 	secretKeyring       optionalString
 	secretKeyringBase64 optionalString
 	stdin               bool
@@ -24,6 +27,10 @@ type rootContext struct {
 	yamlBase64          []string
 	patch               []string
 	patchStrings        []string
+	// noDecryptTrees loads documents encrypted as a whole without
+	// decrypting them, so that their values are not exposed to untrusted
+	// templates.
+	noDecryptTrees bool
 }
 
 func (c *rootContext) getPath(valuePath string) string {
@@ -39,9 +46,10 @@ func (c *rootContext) getPath(valuePath string) string {
 	return valuePath
 }
 
-func (c *rootContext) getValue(path string) (interface{}, error) {
-	path = c.getPath(path)
-
+// confSources returns the sources of the config, with a SecretAgentLoader
+// for the secret keyring, if one is configured (and noDecryptTrees is not
+// set), so that it is only loaded if an encrypted document is read.
+func (c *rootContext) confSources() conf.ConfSources {
 	confSources := conf.ConfSources{
 		Files:        c.yaml,
 		Patches:      c.patch,
@@ -52,8 +60,23 @@ func (c *rootContext) getValue(path string) (interface{}, error) {
 	if c.stdin {
 		confSources.Stream = os.Stdin
 	}
+	if !c.noDecryptTrees {
+		confSources.SecretAgentLoader = func() (*secret.SecretAgent, error) {
+			return c.loadSecretAgent(
+				c.secretKeyringBase64,
+				c.secretKeyring,
+				"SECRET_KEYRING",
+				secret.NewSecretAgentFromBase64,
+				secret.NewSecretAgentFromFile)
+		}
+	}
+	return confSources
+}
 
-	config, err := confSources.LoadInterface()
+func (c *rootContext) getValue(path string) (interface{}, error) {
+	path = c.getPath(path)
+
+	config, err := c.confSources().LoadInterface()
 	if err != nil {
 		return nil, fmt.Errorf("load conf: %w", err)
 	}
@@ -131,6 +154,14 @@ See the README for configuration details:
 		&c.prefix,
 		"prefix",
 		"Prepended to all getv/setv paths (env: CONFIG_PREFIX)")
+	cmd.PersistentFlags().Var(
+		&c.publicKeyring,
+		"public-keyring",
+		"Path to a gpg pubring file used for encryption when no secret keyring is supplied (env: PUBLIC_KEYRING)")
+	cmd.PersistentFlags().Var(
+		&c.publicKeyringBase64,
+		"public-keyring-base64",
+		"Base64 encoded gpg pubring used for encryption when no secret keyring is supplied (env: PUBLIC_KEYRING_BASE64)")
 	cmd.PersistentFlags().Var(
 		&c.secretKeyring,
 		"secret-keyring",
@@ -185,10 +216,15 @@ takes precedence when merged`)
 	cmd.AddCommand(
 		cgetvCmd(c),
 		csetvCmd(c),
+		execCmd(c),
 		getvCmd(c),
 		jsonpathCmd(c),
+		keysCmd(c),
+		resourcesCmd(c),
+		secretsCmd(c),
 		setvCmd(c),
 		templateCmd(c),
+		testCmd(c),
 		varCmd(),
 		versionCmd())
 
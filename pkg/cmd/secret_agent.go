@@ -8,20 +8,62 @@ import (
 )
 
 func (c *rootContext) newSecretAgent() (*secret.SecretAgent, error) {
-	var secretAgent *secret.SecretAgent
-	var err error
-
-	if c.secretKeyringBase64.set {
-		secretAgent, err = secret.NewSecretAgentFromBase64(c.secretKeyringBase64.value)
-	} else if c.secretKeyring.set {
-		secretAgent, err = secret.NewSecretAgentFromFile(c.secretKeyring.value)
-	} else if keyBase64, ok := os.LookupEnv("SECRET_KEYRING_BASE64"); !c.ignoreEnv && ok {
-		secretAgent, err = secret.NewSecretAgentFromBase64(keyBase64)
-	} else if keyFile, ok := os.LookupEnv("SECRET_KEYRING"); !c.ignoreEnv && ok {
-		secretAgent, err = secret.NewSecretAgentFromFile(keyFile)
-	} else {
+	secretAgent, err := c.loadSecretAgent(
+		c.secretKeyringBase64,
+		c.secretKeyring,
+		"SECRET_KEYRING",
+		secret.NewSecretAgentFromBase64,
+		secret.NewSecretAgentFromFile)
+	if secretAgent == nil && err == nil {
 		err = errors.New("requires --secret-keyring-base64, --secret-keyring, or SECRET_KEYRING")
 	}
 
 	return secretAgent, err
 }
+
+// newEncryptingSecretAgent returns an agent suitable for encryption. The secret
+// keyring is preferred, but if none is configured, an encrypt-only agent is
+// created from the public keyring.
+func (c *rootContext) newEncryptingSecretAgent() (*secret.SecretAgent, error) {
+	secretAgent, err := c.loadSecretAgent(
+		c.secretKeyringBase64,
+		c.secretKeyring,
+		"SECRET_KEYRING",
+		secret.NewSecretAgentFromBase64,
+		secret.NewSecretAgentFromFile)
+	if secretAgent == nil && err == nil {
+		secretAgent, err = c.loadSecretAgent(
+			c.publicKeyringBase64,
+			c.publicKeyring,
+			"PUBLIC_KEYRING",
+			secret.NewEncryptOnlySecretAgentFromBase64,
+			secret.NewEncryptOnlySecretAgentFromFile)
+	}
+	if secretAgent == nil && err == nil {
+		err = errors.New("requires --secret-keyring-base64, --secret-keyring, --public-keyring-base64, --public-keyring, SECRET_KEYRING, or PUBLIC_KEYRING")
+	}
+
+	return secretAgent, err
+}
+
+// loadSecretAgent loads an agent from the first of the base64 option, the file
+// option, the <envName>_BASE64 environment variable or the <envName>
+// environment variable that is set. If none are set, a nil agent is returned.
+func (c *rootContext) loadSecretAgent(
+	keyringBase64 optionalString,
+	keyring optionalString,
+	envName string,
+	fromBase64 func(string) (*secret.SecretAgent, error),
+	fromFile func(string) (*secret.SecretAgent, error),
+) (*secret.SecretAgent, error) {
+	if keyringBase64.set {
+		return fromBase64(keyringBase64.value)
+	} else if keyring.set {
+		return fromFile(keyring.value)
+	} else if keyBase64, ok := os.LookupEnv(envName + "_BASE64"); !c.ignoreEnv && ok {
+		return fromBase64(keyBase64)
+	} else if keyFile, ok := os.LookupEnv(envName); !c.ignoreEnv && ok {
+		return fromFile(keyFile)
+	}
+	return nil, nil
+}
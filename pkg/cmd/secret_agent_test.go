@@ -81,3 +81,36 @@ func TestNewSecretAgent(t *testing.T) {
 	testNewSecretAgent(t, "base64 env var", expected, encrypted, &rootContext{})
 	assert.Nil(t, os.Unsetenv(secretKeyringEnvVar))
 }
+
+func TestNewEncryptingSecretAgent(t *testing.T) {
+	keyFile := path.Join("..", "..", "testdata", "test.secring.gpg")
+	publicKeyFile := path.Join("..", "..", "testdata", "test.pubring.gpg")
+
+	_, err := (&rootContext{ignoreEnv: true}).newEncryptingSecretAgent()
+	assert.Error(t, err)
+
+	secretAgent, err := (&rootContext{
+		ignoreEnv:     true,
+		publicKeyring: *newOptionalString(publicKeyFile, true),
+		secretKeyring: *newOptionalString(keyFile, true),
+	}).newEncryptingSecretAgent()
+	assert.NoError(t, err)
+	assert.False(t, secretAgent.EncryptOnly())
+
+	secretAgent, err = (&rootContext{
+		ignoreEnv:     true,
+		publicKeyring: *newOptionalString(publicKeyFile, true),
+	}).newEncryptingSecretAgent()
+	assert.NoError(t, err)
+	assert.True(t, secretAgent.EncryptOnly())
+
+	publicKey, err := os.ReadFile(publicKeyFile)
+	assert.NoError(t, err)
+	t.Setenv("PUBLIC_KEYRING_BASE64", base64.StdEncoding.EncodeToString(publicKey))
+	secretAgent, err = (&rootContext{}).newEncryptingSecretAgent()
+	assert.NoError(t, err)
+	assert.True(t, secretAgent.EncryptOnly())
+
+	_, err = (&rootContext{}).newSecretAgent()
+	assert.Error(t, err)
+}
@@ -0,0 +1,259 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pastdev/clconf/v3/pkg/conf"
+	"github.com/pastdev/clconf/v3/pkg/core"
+	"github.com/pastdev/clconf/v3/pkg/secret"
+	"github.com/pastdev/clconf/v3/pkg/yamljson"
+	"github.com/spf13/cobra"
+)
+
+type secretsContext struct {
+	*rootContext
+	inPlace          bool
+	recipients       []string
+	removeRecipients []string
+}
+
+func secretsCmd(rootCmdContext *rootContext) *cobra.Command {
+	var cmd = &cobra.Command{
+		Use:   "secrets",
+		Short: "Manage the encrypted values in a config file",
+	}
+
+	cmd.AddCommand(
+		secretsDecryptFileCmd(rootCmdContext),
+		secretsEncryptFileCmd(rootCmdContext),
+		secretsRotateCmd(rootCmdContext))
+
+	return cmd
+}
+
+func secretsDecryptFileCmd(rootCmdContext *rootContext) *cobra.Command {
+	var c = &secretsContext{rootContext: rootCmdContext}
+
+	var cmd = &cobra.Command{
+		Use:   "decrypt-file <file> [options]",
+		Short: "Verify and decrypt a file encrypted by encrypt-file",
+		Long: `Verify and decrypt a file encrypted by encrypt-file. The MAC recorded in the
+` + secret.MetadataKey + ` metadata is checked and decryption fails if any value was
+added, removed, modified, or moved to a different key. The decrypted yaml is
+written to stdout unless --in-place is specified.`,
+		Example: `  clconf --secret-keyring secring.gpg secrets decrypt-file config.yml`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return c.decryptFile(args[0])
+		},
+	}
+
+	cmd.Flags().BoolVar(
+		&c.inPlace,
+		"in-place",
+		false,
+		"Overwrite the file rather than writing to stdout")
+
+	return cmd
+}
+
+func secretsEncryptFileCmd(rootCmdContext *rootContext) *cobra.Command {
+	var c = &secretsContext{rootContext: rootCmdContext}
+
+	var cmd = &cobra.Command{
+		Use:   "encrypt-file <file> [options]",
+		Short: "Encrypt every value in a file with tamper detection",
+		Long: `Encrypt every value in a file. Keys remain readable, but each value is
+encrypted with the path of its key bound as associated data, and a MAC of all
+the values is stored in a top level ` + secret.MetadataKey + ` metadata block, so
+values cannot be swapped, removed, or added without detection. The data key is
+encrypted to the same recipients as csetv. Files encrypted this way are
+verified and decrypted automatically when loaded with a secret keyring. The
+encrypted yaml is written to stdout unless --in-place is specified.`,
+		Example: `  clconf --public-keyring pubring.gpg secrets encrypt-file --in-place config.yml`,
+		Args:    cobra.ExactArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return c.encryptFile(args[0])
+		},
+	}
+
+	cmd.Flags().BoolVar(
+		&c.inPlace,
+		"in-place",
+		false,
+		"Overwrite the file rather than writing to stdout")
+	cmd.Flags().StringArrayVar(
+		&c.recipients,
+		"recipient",
+		nil,
+		"A `file` containing armored public keys to encrypt to")
+
+	return cmd
+}
+
+func secretsRotateCmd(rootCmdContext *rootContext) *cobra.Command {
+	var c = &secretsContext{rootContext: rootCmdContext}
+
+	var cmd = &cobra.Command{
+		Use:   "rotate [options]",
+		Short: "Re-encrypt all encrypted values in the file indicated by the global option --yaml (must be single valued).",
+		Long: `Re-encrypt all encrypted values in the file indicated by the global option
+--yaml (must be single valued). Each value is decrypted using the secret
+keyring and encrypted to the secret keyring, the recipients found in the
+` + secret.RecipientsFile + ` file next to the config file and any --recipient,
+less any --remove-recipient. Rotation fails if a value is encrypted to a
+recipient whose public key is not supplied unless that recipient is removed.`,
+		Example: `  # Add the ops break-glass key to every encrypted value
+  clconf --secret-keyring secring.gpg --yaml config.yml \
+    secrets rotate --recipient ops.pubring.gpg
+
+  # Remove a recipient by key id
+  clconf --secret-keyring secring.gpg --yaml config.yml \
+    secrets rotate --remove-recipient 9079038C39670FAB`,
+		Args: cobra.NoArgs,
+		RunE: func(_ *cobra.Command, _ []string) error {
+			return c.rotate()
+		},
+	}
+
+	cmd.Flags().StringArrayVar(
+		&c.recipients,
+		"recipient",
+		nil,
+		"A `file` containing armored public keys to encrypt to")
+	cmd.Flags().StringArrayVar(
+		&c.removeRecipients,
+		"remove-recipient",
+		nil,
+		"A key `id` or fingerprint that should no longer be encrypted to")
+
+	return cmd
+}
+
+func (c *secretsContext) rotate() error {
+	config, file, err := conf.
+		ConfSources{Environment: true, Files: c.yaml}.
+		LoadSettableInterface()
+	if err != nil {
+		return fmt.Errorf("load config %s: %w", c.yaml, err)
+	}
+
+	secretAgent, err := c.newSecretAgent()
+	if err != nil {
+		return fmt.Errorf("load secret agent: %w", err)
+	}
+	secretAgent, err = withRecipients(secretAgent, file, c.recipients)
+	if err != nil {
+		return err
+	}
+	secretAgent = secretAgent.RemoveRecipients(c.removeRecipients...)
+
+	rotated, err := secretAgent.RotateAll(config)
+	if err != nil {
+		return fmt.Errorf("rotate: %w", err)
+	}
+
+	err = core.SaveConf(config, file)
+	if err != nil {
+		return fmt.Errorf("save config %s: %w", file, err)
+	}
+
+	for _, path := range rotated {
+		fmt.Fprintf(os.Stderr, "Rotated: %q\n", path)
+	}
+	return nil
+}
+
+func (c *secretsContext) decryptFile(file string) error {
+	config, err := loadSingleYaml(file)
+	if err != nil {
+		return err
+	}
+
+	secretAgent, err := c.newSecretAgent()
+	if err != nil {
+		return fmt.Errorf("load secret agent: %w", err)
+	}
+	err = secretAgent.DecryptTree(config)
+	if err != nil {
+		return fmt.Errorf("decrypt %s: %w", file, err)
+	}
+
+	return c.writeFile(config, file)
+}
+
+func (c *secretsContext) encryptFile(file string) error {
+	config, err := loadSingleYaml(file)
+	if err != nil {
+		return err
+	}
+
+	secretAgent, err := c.newEncryptingSecretAgent()
+	if err != nil {
+		return fmt.Errorf("load secret agent: %w", err)
+	}
+	secretAgent, err = withRecipients(secretAgent, file, c.recipients)
+	if err != nil {
+		return err
+	}
+	err = secretAgent.EncryptTree(config)
+	if err != nil {
+		return fmt.Errorf("encrypt %s: %w", file, err)
+	}
+
+	return c.writeFile(config, file)
+}
+
+func (c *secretsContext) writeFile(config interface{}, file string) error {
+	if c.inPlace {
+		err := core.SaveConf(config, file)
+		if err != nil {
+			return fmt.Errorf("save config %s: %w", file, err)
+		}
+		return nil
+	}
+
+	yamlBytes, err := yamljson.MarshalYaml(config)
+	if err != nil {
+		return fmt.Errorf("marshal: %w", err)
+	}
+	_, err = os.Stdout.Write(yamlBytes)
+	if err != nil {
+		return fmt.Errorf("write: %w", err)
+	}
+	return nil
+}
+
+func loadSingleYaml(file string) (interface{}, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", file, err)
+	}
+	configs, err := yamljson.UnmarshalAllYaml(string(content))
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal %s: %w", file, err)
+	}
+	if len(configs) != 1 {
+		return nil, fmt.Errorf("%s must contain exactly one yaml document", file)
+	}
+	return configs[0], nil
+}
+
+// withRecipients adds the recipients from the recipients file next to
+// configFile along with those in the recipients files.
+func withRecipients(
+	secretAgent *secret.SecretAgent,
+	configFile string,
+	recipients []string,
+) (*secret.SecretAgent, error) {
+	secretAgent, err := secretAgent.AddRecipientsForConfig(configFile)
+	if err != nil {
+		return nil, fmt.Errorf("load recipients for %s: %w", configFile, err)
+	}
+	secretAgent, err = secretAgent.AddRecipientsFromFiles(recipients...)
+	if err != nil {
+		return nil, fmt.Errorf("load recipients: %w", err)
+	}
+	return secretAgent, nil
+}
@@ -0,0 +1,102 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/pastdev/clconf/v3/pkg/secret"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	yaml "gopkg.in/yaml.v3"
+)
+
+func TestSecretsRotate(t *testing.T) {
+	temp := t.TempDir()
+	keyFile := filepath.Join("..", "..", "testdata", "test.secring.gpg")
+	configFile := filepath.Join(temp, "config.yml")
+
+	secretAgent, err := secret.NewSecretAgentFromFile(keyFile)
+	require.NoError(t, err)
+	recipientKeyring, err := secret.GenerateKeyring("recipient", "", "", 1024)
+	require.NoError(t, err)
+	recipient := secret.NewSecretAgent(recipientKeyring)
+	recipientPublic, err := recipient.PublicKeyring()
+	require.NoError(t, err)
+
+	encrypted, err := secretAgent.Encrypt("foo")
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(configFile, []byte("secret: "+encrypted+"\nplain: bar\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(temp, secret.RecipientsFile), recipientPublic, 0600))
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"--ignore-env",
+		"--secret-keyring", keyFile,
+		"--yaml", configFile,
+		"secrets", "rotate"})
+	require.NoError(t, cmd.Execute())
+
+	var config map[string]string
+	content, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal(content, &config))
+	assert.Equal(t, "bar", config["plain"])
+	decrypted, err := recipient.Decrypt(config["secret"])
+	require.NoError(t, err)
+	assert.Equal(t, "foo", decrypted)
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"--ignore-env",
+		"--public-keyring", filepath.Join("..", "..", "testdata", "test.pubring.gpg"),
+		"--yaml", configFile,
+		"csetv", "/other", "baz"})
+	require.NoError(t, cmd.Execute())
+	content, err = os.ReadFile(configFile)
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal(content, &config))
+	decrypted, err = recipient.Decrypt(config["other"])
+	require.NoError(t, err)
+	assert.Equal(t, "baz", decrypted)
+}
+
+func TestSecretsEncryptDecryptFile(t *testing.T) {
+	temp := t.TempDir()
+	configFile := filepath.Join(temp, "config.yml")
+	require.NoError(t, os.WriteFile(configFile, []byte("db:\n  password: foo\n  port: 5432\n"), 0600))
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"--ignore-env",
+		"--public-keyring", filepath.Join("..", "..", "testdata", "test.pubring.gpg"),
+		"secrets", "encrypt-file", "--in-place", configFile})
+	require.NoError(t, cmd.Execute())
+
+	content, err := os.ReadFile(configFile)
+	require.NoError(t, err)
+	assert.NotContains(t, string(content), "foo")
+	assert.Contains(t, string(content), secret.MetadataKey+":")
+
+	keyFile := filepath.Join("..", "..", "testdata", "test.secring.gpg")
+	context := getvContext{
+		rootContext: &rootContext{
+			ignoreEnv:     true,
+			secretKeyring: *newOptionalString(keyFile, true),
+			yaml:          []string{configFile},
+		},
+	}
+	value, err := context.getValue("/db/port")
+	require.NoError(t, err)
+	assert.Equal(t, 5432, value)
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"--ignore-env",
+		"--secret-keyring", keyFile,
+		"secrets", "decrypt-file", "--in-place", configFile})
+	require.NoError(t, cmd.Execute())
+
+	var config map[string]map[string]interface{}
+	content, err = os.ReadFile(configFile)
+	require.NoError(t, err)
+	require.NoError(t, yaml.Unmarshal(content, &config))
+	assert.Equal(t, map[string]map[string]interface{}{
+		"db": {"password": "foo", "port": 5432}}, config)
+}
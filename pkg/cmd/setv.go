@@ -7,6 +7,7 @@ import (
 
 	"github.com/pastdev/clconf/v3/pkg/conf"
 	"github.com/pastdev/clconf/v3/pkg/core"
+	"github.com/pastdev/clconf/v3/pkg/secret"
 	"github.com/pastdev/clconf/v3/pkg/yamljson"
 	"github.com/spf13/cobra"
 )
@@ -17,6 +18,7 @@ type setvContext struct {
 	encrypt        bool
 	merge          bool
 	mergeOverwrite bool
+	recipients     []string
 	yamlValue      bool
 }
 
@@ -67,6 +69,9 @@ func (c *setvContext) addFlags(cmd *cobra.Command) {
 		"Merged values should overwrite existing values (not used unless --merge)")
 	cmd.Flags().BoolVarP(&c.merge, "merge", "", false,
 		"Values should be merged rather than overwrite at path")
+	cmd.Flags().StringArrayVar(&c.recipients, "recipient", nil,
+		"A `file` containing armored public keys to also encrypt to (in addition to any found in "+
+			secret.RecipientsFile+" next to the config file)")
 	cmd.Flags().BoolVarP(&c.yamlValue, "yaml-value", "", false,
 		"The value is yaml/json")
 }
@@ -93,10 +98,14 @@ func (c *setvContext) setValue(key, value string) error {
 	}
 
 	if c.encrypt {
-		secretAgent, err := c.newSecretAgent()
+		secretAgent, err := c.newEncryptingSecretAgent()
 		if err != nil {
 			return fmt.Errorf("load secret agent: %w", err)
 		}
+		secretAgent, err = withRecipients(secretAgent, file, c.recipients)
+		if err != nil {
+			return err
+		}
 		encrypted, err := secretAgent.Encrypt(value)
 		if err != nil {
 			return fmt.Errorf("encrypt: %w", err)
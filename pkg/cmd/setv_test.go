@@ -139,4 +139,25 @@ func TestSetValue(t *testing.T) {
 	if expected != actual {
 		t.Errorf("SetValue encrypted not equal [%s] != [%s]", expected, actual)
 	}
+
+	publicKeyFile := path.Join("..", "..", "testdata", "test.pubring.gpg")
+	rootContext.secretKeyring = optionalString{}
+	rootContext.publicKeyring = *newOptionalString(publicKeyFile, true)
+	rootContext.ignoreEnv = true
+	actualYaml, err = getSetValueActual("encrypted with public keyring", "", "/foo", expected, context)
+	if err != nil {
+		t.Errorf("Unable to encrypt bar with public keyring: %v", err)
+	}
+	err = yaml.Unmarshal([]byte(actualYaml), &unmarshaled)
+	if err != nil {
+		t.Errorf("Unable to unmarshal yaml %s: %s", err, actualYaml)
+		return
+	}
+	actual, err = secretAgent.Decrypt(unmarshaled["foo"])
+	if err != nil {
+		t.Errorf("failed to decrypt: %v", err)
+	}
+	if expected != actual {
+		t.Errorf("SetValue encrypted with public keyring not equal [%s] != [%s]", expected, actual)
+	}
 }
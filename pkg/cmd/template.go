@@ -1,8 +1,19 @@
 package cmd
 
 import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/pastdev/clconf/v3/pkg/template"
 	"github.com/spf13/cobra"
@@ -11,9 +22,27 @@ import (
 type templateContext struct {
 	*rootContext
 	templateOptions template.TemplateOptions
+	check           bool
+	diff            bool
+	envFile         string
+	group           string
+	hostsFile       string
 	inPlace         bool
+	manifest        string
+	now             string
+	onChange        string
+	owner           string
+	reportUnused    bool
+	sandbox         bool
+	sandboxOptions  template.Sandbox
+	symlinks        string
+	toStdout        bool
+	toTar           string
 	unixDirMode     string
 	unixFileMode    string
+	watch           bool
+	watchDebounce   time.Duration
+	watchInterval   time.Duration
 }
 
 func templateCmd(rootCmdContext *rootContext) *cobra.Command {
@@ -30,7 +59,10 @@ of templates) and process them either in place (see --in-place) or into the
 folder specified as the last argument. It will make any folders required
 along the way. If a source is an existing file (not a folder) it will be
 treated as a template regardless of the extension (though if the extension
-matches it will still be removed).`,
+matches it will still be removed).
+
+With --to-stdout or --to-tar there is no destination folder, every argument is
+a source and the results are named by their path relative to their source.`,
 		Example: `  # Apply all templates with the .clconf extension to their relative folders in
   # /dest
   template /tmp/srcFolder1 /tmp/srcFolder2 /dest
@@ -45,7 +77,44 @@ matches it will still be removed).`,
   template /tmp/srcFile.sh.clconf --in-place
 
   # Interpret /tmp/srcFile.sh.clconf where it is (result is /tmp/srcFile.sh.clconf)
-  template /tmp/srcFile.sh.clconf --in-place --template-extension ""`,
+  template /tmp/srcFile.sh.clconf --in-place --template-extension ""
+
+  # Share the templates defined in /tmp/lib/*.tmpl with every template
+  template /tmp/srcFolder /dest --template-lib /tmp/lib
+
+  # Record the config keys each template reads and list the unused keys
+  template /tmp/srcFolder /dest --manifest /tmp/manifest.json --report-unused
+
+  # Skip editor backups and anything under a vendor folder (in addition to the
+  # patterns in any .clconfignore files)
+  template /tmp/srcFolder /dest --template-extension "" --exclude "*~" --exclude "vendor/"
+
+  # Bundle the results into a tar archive, ie: for a Dockerfile ADD
+  template /tmp/srcFolder --to-tar /tmp/rendered.tar
+
+  # Print every result, each preceded by a ==> name <== header
+  template /tmp/srcFolder --to-stdout
+
+  # Render templates supplied by another team, only allowing them to decrypt
+  # their own secrets
+  template /tmp/untrusted /dest --sandbox --sandbox-decrypt /apps/team-a
+
+  # Render reproducibly, ie: for golden tests
+  template /tmp/srcFolder /dest --now 2024-01-02T03:04:05Z \
+    --hosts-file /tmp/hosts.yml --env-file /tmp/test.env
+
+  # Render a large folder of templates 8 at a time
+  template /tmp/srcFolder /dest --jobs 8
+
+  # Show what would change without writing anything
+  template /tmp/srcFolder /dest --diff
+
+  # Fail (exit code 1) if any result would change, ie: in CI
+  template /tmp/srcFolder /dest --check
+
+  # Re-render whenever the config or templates change and reload nginx
+  template --yaml /etc/config/app.yml /etc/nginx/templates /etc/nginx/conf.d \
+    --watch --on-change "nginx -s reload"`,
 		RunE: func(_ *cobra.Command, args []string) error {
 			return c.template(args)
 		},
@@ -72,6 +141,21 @@ copy from source template).`)
 		"keep-existing-permissions",
 		false,
 		"Only apply --file-mode to new files, leave existing files as-is.")
+	cmd.Flags().StringVar(
+		&c.owner,
+		"owner",
+		"",
+		"The user `name or id` that results and new directories will be owned by (requires privileges).")
+	cmd.Flags().StringVar(
+		&c.group,
+		"group",
+		"",
+		"The group `name or id` that results and new directories will be owned by.")
+	cmd.Flags().BoolVar(
+		&c.templateOptions.CopyTemplateOwner,
+		"copy-owner",
+		false,
+		"Copy the owner and group of the template to results and new directories (unless --owner/--group).")
 	cmd.Flags().StringVar(
 		&c.unixDirMode,
 		"dir-mode",
@@ -102,13 +186,153 @@ copy from source template).`)
 		"right-delimiter",
 		"}}",
 		"Delimiter to use when parsing templates for substitutions")
+	cmd.Flags().StringArrayVar(
+		&c.templateOptions.Include,
+		"include",
+		nil,
+		"Only process templates in source folders matching this gitignore style `pattern` (repeatable)")
+	cmd.Flags().StringArrayVar(
+		&c.templateOptions.Exclude,
+		"exclude",
+		nil,
+		"Skip files and folders in source folders matching this gitignore style `pattern` (repeatable)")
+	cmd.Flags().StringVar(
+		&c.symlinks,
+		"symlinks",
+		string(template.SymlinkFollow),
+		"How to handle symlinks in source folders: follow, copy (recreate the link in the destination) or skip")
+	cmd.Flags().BoolVar(
+		&c.toStdout,
+		"to-stdout",
+		false,
+		"Print the results to stdout, each preceded by a header, instead of writing them (implies no destination)")
+	cmd.Flags().StringVar(
+		&c.toTar,
+		"to-tar",
+		"",
+		"Write the results to a tar `file` (- for stdout) instead of a folder (implies no destination)")
+	cmd.Flags().IntVar(
+		&c.templateOptions.Jobs,
+		"jobs",
+		1,
+		"The `number` of templates to render concurrently (0 for one per cpu)")
+	cmd.Flags().StringVar(
+		&c.manifest,
+		"manifest",
+		"",
+		"Write a json `file` listing the config keys and patterns each template read")
+	cmd.Flags().BoolVar(
+		&c.reportUnused,
+		"report-unused",
+		false,
+		"Print the config keys that no template read to stdout")
+	cmd.Flags().BoolVar(
+		&c.templateOptions.Strict,
+		"strict",
+		false,
+		"Fail on missing map keys, unset getenv variables without a default and DNS lookup failures")
+	cmd.Flags().BoolVar(
+		&c.sandbox,
+		"sandbox",
+		false,
+		`Render untrusted templates: getenv and the cget functions only read what the
+--sandbox-env and --sandbox-decrypt flags allow, config files encrypted as a
+whole are not decrypted, fileExists, output and the DNS lookup functions are
+unavailable and execution is limited in time and output size.`)
+	cmd.Flags().StringArrayVar(
+		&c.sandboxOptions.Funcs,
+		"sandbox-func",
+		nil,
+		"With --sandbox, only allow this template function `name` (repeatable)")
+	cmd.Flags().StringArrayVar(
+		&c.sandboxOptions.Env,
+		"sandbox-env",
+		nil,
+		"With --sandbox, allow getenv to read the environment variables matching this `pattern` (repeatable)")
+	cmd.Flags().StringArrayVar(
+		&c.sandboxOptions.Decrypt,
+		"sandbox-decrypt",
+		nil,
+		"With --sandbox, allow the cget functions to decrypt values under this key `prefix` (repeatable)")
+	cmd.Flags().DurationVar(
+		&c.sandboxOptions.Timeout,
+		"sandbox-timeout",
+		10*time.Second,
+		"With --sandbox, the maximum time to render each template (0 for no limit)")
+	cmd.Flags().IntVar(
+		&c.sandboxOptions.MaxOutput,
+		"sandbox-max-output",
+		10*1024*1024,
+		"With --sandbox, the maximum size in `bytes` of each rendered template and function result (0 for no limit)")
+	cmd.Flags().StringVar(
+		&c.now,
+		"now",
+		"",
+		"A fixed RFC 3339 `time` (ie: 2024-01-02T03:04:05Z) for datetime to return")
+	cmd.Flags().StringVar(
+		&c.hostsFile,
+		"hosts-file",
+		"",
+		"A yaml `file` of ip and srv records that the lookup functions resolve from instead of DNS")
+	cmd.Flags().StringVar(
+		&c.envFile,
+		"env-file",
+		"",
+		"A `file` of KEY=value lines that getenv reads instead of the process environment")
+	cmd.Flags().StringArrayVar(
+		&c.templateOptions.LibraryDirs,
+		"template-lib",
+		nil,
+		"A `folder` of *.tmpl files whose templates are available to every template (via template or include)")
+	cmd.Flags().BoolVar(
+		&c.templateOptions.DryRun,
+		"dry-run",
+		false,
+		"Render templates and report what would change without writing or removing any files")
+	cmd.Flags().BoolVar(
+		&c.diff,
+		"diff",
+		false,
+		"Print a unified diff of what would change to stdout (implies --dry-run)")
+	cmd.Flags().BoolVar(
+		&c.check,
+		"check",
+		false,
+		"Exit with a non-zero code if any file would change (implies --dry-run)")
+	cmd.Flags().BoolVar(
+		&c.watch,
+		"watch",
+		false,
+		`Keep running and re-render templates whenever the --yaml/YAML_FILES files, --patch files
+or template sources change. Only the affected templates are re-rendered.`)
+	cmd.Flags().DurationVar(
+		&c.watchInterval,
+		"watch-interval",
+		template.DefaultWatchInterval,
+		"How often to poll for changes when watching (in addition to file system events)")
+	cmd.Flags().DurationVar(
+		&c.watchDebounce,
+		"watch-debounce",
+		500*time.Millisecond,
+		"How long changes must settle before re-rendering when watching")
+	cmd.Flags().StringVar(
+		&c.onChange,
+		"on-change",
+		"",
+		"A shell `command` to run after templates are re-rendered when watching")
 
 	return cmd
 }
 
 func (c *templateContext) template(args []string) error {
 	var dest string
-	if !c.inPlace {
+	toArchive := c.toStdout || c.toTar != ""
+	if toArchive {
+		err := c.validateArchive()
+		if err != nil {
+			return err
+		}
+	} else if !c.inPlace {
 		if len(args) < 2 {
 			return fmt.Errorf("need at least two arguments when not using --in-place")
 		}
@@ -135,24 +359,360 @@ func (c *templateContext) template(args []string) error {
 		c.templateOptions.FileMode = mode
 	}
 
+	if c.owner != "" {
+		uid, err := template.LookupOwner(c.owner)
+		if err != nil {
+			return err
+		}
+		c.templateOptions.Uid = &uid
+	}
+	if c.group != "" {
+		gid, err := template.LookupGroup(c.group)
+		if err != nil {
+			return err
+		}
+		c.templateOptions.Gid = &gid
+	}
+
 	if len(args) < 1 {
 		return fmt.Errorf("no sources to process")
 	}
 
-	secretAgent, _ := c.newSecretAgent()
+	c.templateOptions.Symlinks, err = template.ParseSymlinkMode(c.symlinks)
+	if err != nil {
+		return err
+	}
+
+	c.templateOptions.Fixtures, err = c.fixtures()
+	if err != nil {
+		return err
+	}
+
+	if c.sandbox {
+		c.templateOptions.Sandbox = &c.sandboxOptions
+		// cget decrypts only what the sandbox allows, but a document
+		// encrypted as a whole would be decrypted for every template
+		c.noDecryptTrees = true
+	}
+
+	if c.templateOptions.Jobs < 1 {
+		c.templateOptions.Jobs = runtime.NumCPU()
+	}
+
+	if c.diff {
+		c.templateOptions.Diff = true
+		c.templateOptions.DryRun = true
+	}
+	if c.check {
+		c.templateOptions.DryRun = true
+	}
+
+	if c.watch {
+		if c.templateOptions.DryRun {
+			return errors.New("--dry-run, --diff and --check cannot be used with --watch")
+		}
+		if c.templateOptions.Rm {
+			return errors.New("--rm cannot be used with --watch")
+		}
+		if c.stdin {
+			return errors.New("--stdin cannot be used with --watch")
+		}
+		if c.manifest != "" || c.reportUnused {
+			return errors.New("--manifest and --report-unused cannot be used with --watch")
+		}
+		ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+		defer stop()
+		return c.watchTemplates(ctx, args, dest)
+	}
+
 	value, err := c.getValue("/")
 	if err != nil {
 		return err
 	}
+	var results []template.TemplateResult
+	if toArchive {
+		results, err = c.archiveTemplates(args, value)
+	} else {
+		results, err = c.processTemplates(args, dest, value, nil)
+	}
+	if err != nil {
+		return err
+	}
+	unused := template.UnusedKeys(value, results)
+	if c.manifest != "" {
+		err = writeManifest(c.manifest, results, unused)
+		if err != nil {
+			return err
+		}
+	}
+	if c.reportUnused {
+		for _, key := range unused {
+			fmt.Println(key)
+		}
+	}
+	if c.check && changedTemplateResults(results) {
+		return NewExitError(1, "templates would change")
+	}
+	return nil
+}
+
+// fixtures returns the template.Fixtures from --now, --hosts-file and
+// --env-file, or nil if none are set.
+func (c *templateContext) fixtures() (*template.Fixtures, error) {
+	if c.now == "" && c.hostsFile == "" && c.envFile == "" {
+		return nil, nil
+	}
 
-	results, err := template.ProcessTemplates(args, dest, value, secretAgent,
-		c.templateOptions)
+	fixtures := &template.Fixtures{}
+	var err error
+	if c.now != "" {
+		fixtures.Now, err = template.ParseNow(c.now)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.hostsFile != "" {
+		fixtures.Hosts, err = template.LoadHostsFile(c.hostsFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if c.envFile != "" {
+		fixtures.Env, err = template.LoadEnvFile(c.envFile)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return fixtures, nil
+}
+
+// validateArchive returns an error if --to-stdout or --to-tar is combined
+// with options that only apply to writing to a folder.
+func (c *templateContext) validateArchive() error {
+	switch {
+	case c.toStdout && c.toTar != "":
+		return errors.New("--to-stdout and --to-tar cannot be used together")
+	case c.inPlace:
+		return errors.New("--in-place cannot be used with --to-stdout or --to-tar")
+	case c.watch:
+		return errors.New("--watch cannot be used with --to-stdout or --to-tar")
+	case c.templateOptions.DryRun || c.diff || c.check:
+		return errors.New("--dry-run, --diff and --check cannot be used with --to-stdout or --to-tar")
+	case c.templateOptions.Rm:
+		return errors.New("--rm cannot be used with --to-stdout or --to-tar")
+	case c.reportUnused && (c.toStdout || c.toTar == "-"):
+		return errors.New("--report-unused cannot be used when writing results to stdout")
+	}
+	return nil
+}
+
+// archiveTemplates renders the templates into the --to-stdout or --to-tar
+// archive. Nothing is written if any template fails.
+func (c *templateContext) archiveTemplates(srcs []string, value interface{}) ([]template.TemplateResult, error) {
+	var buffer bytes.Buffer
+	var closer func() error
+	if c.toStdout {
+		c.templateOptions.Archive = template.NewConcatArchive(&buffer)
+	} else {
+		archive := template.NewTarArchive(&buffer, c.templateOptions.DirMode)
+		c.templateOptions.Archive = archive
+		closer = archive.Close
+	}
+
+	results, err := c.processTemplates(srcs, "", value, nil)
 	if err != nil {
-		return fmt.Errorf("process templates: %w", err)
+		return nil, err
 	}
+	if closer != nil {
+		err = closer()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if c.toStdout || c.toTar == "-" {
+		_, err = os.Stdout.Write(buffer.Bytes())
+		if err != nil {
+			return nil, fmt.Errorf("write to stdout: %w", err)
+		}
+		return results, nil
+	}
+	err = template.WriteFileAtomic(c.toTar, buffer.Bytes(), 0644)
+	if err != nil {
+		return nil, fmt.Errorf("write tar: %w", err)
+	}
+	return results, nil
+}
+
+func (c *templateContext) processTemplates(
+	srcs []string,
+	dest string,
+	value interface{},
+	filter func(string) bool,
+) ([]template.TemplateResult, error) {
+	secretAgent, _ := c.newSecretAgent()
+	options := c.templateOptions
+	options.Filter = filter
+
+	results, err := template.ProcessTemplates(srcs, dest, value, secretAgent, options)
+	logTemplateResults(results, options.DryRun)
+	for _, result := range results {
+		fmt.Print(result.Diff)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("process templates: %w", err)
+	}
+	return results, nil
+}
 
+// templateManifest is the --manifest file format.
+type templateManifest struct {
+	Templates []templateManifestEntry `json:"templates"`
+	Unused    []string                `json:"unused"`
+}
+
+type templateManifestEntry struct {
+	Src  string `json:"src"`
+	Dest string `json:"dest"`
+	template.Dependencies
+}
+
+func writeManifest(file string, results []template.TemplateResult, unused []string) error {
+	manifest := templateManifest{
+		Templates: make([]templateManifestEntry, 0, len(results)),
+		Unused:    unused,
+	}
 	for _, result := range results {
-		fmt.Fprintf(os.Stderr, "Templated: %q => %q\n", result.Src, result.Dest)
+		manifest.Templates = append(manifest.Templates, templateManifestEntry{
+			Src:          result.Src,
+			Dest:         result.Dest,
+			Dependencies: result.Dependencies,
+		})
+	}
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("marshal manifest: %w", err)
+	}
+	err = template.WriteFileAtomic(file, append(content, '\n'), 0644)
+	if err != nil {
+		return fmt.Errorf("write manifest: %w", err)
 	}
 	return nil
 }
+
+func logTemplateResults(results []template.TemplateResult, dryRun bool) {
+	verb := "Templated"
+	if dryRun {
+		verb = "Would template"
+	}
+	for _, result := range results {
+		fmt.Fprintf(os.Stderr, "%s: %q => %q (%s)\n", verb, result.Src, result.Dest, result.Status)
+	}
+}
+
+func changedTemplateResults(results []template.TemplateResult) bool {
+	for _, result := range results {
+		if result.Status != template.StatusUnchanged {
+			return true
+		}
+	}
+	return false
+}
+
+// watchTemplates renders all templates then re-renders them as their
+// sources change until ctx is done. Failures after the initial render are
+// reported but do not stop watching so that a bad edit can be corrected.
+func (c *templateContext) watchTemplates(ctx context.Context, srcs []string, dest string) error {
+	confSources := c.confSources()
+	configFiles := map[string]bool{}
+	watched := []string{}
+	for _, file := range confSources.SourceFiles() {
+		configFiles[filepath.Clean(file)] = true
+		watched = append(watched, file)
+	}
+	watched = append(watched, c.templateOptions.LibraryDirs...)
+	watcher := template.NewWatcher(append(watched, srcs...), c.watchInterval, c.watchDebounce)
+	defer func() { _ = watcher.Close() }()
+
+	value, err := c.getValue("/")
+	if err != nil {
+		return err
+	}
+	_, err = c.processTemplates(srcs, dest, value, nil)
+	if err != nil {
+		return err
+	}
+
+	for {
+		changed, err := watcher.Wait(ctx)
+		if err != nil {
+			return nil //nolint:nilerr // context done is a normal exit
+		}
+
+		var filter func(string) bool
+		changedTemplates := map[string]bool{}
+		configChanged := false
+		libraryChanged := false
+		for _, path := range changed {
+			switch {
+			case configFiles[path]:
+				configChanged = true
+			case c.isLibraryFile(path):
+				libraryChanged = true
+			default:
+				changedTemplates[path] = true
+			}
+		}
+
+		if configChanged {
+			newValue, err := c.getValue("/")
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "Reload config failed: %v\n", err)
+				continue
+			}
+			configChanged = !reflect.DeepEqual(value, newValue)
+			value = newValue
+		}
+		if !configChanged && !libraryChanged {
+			if len(changedTemplates) == 0 {
+				continue
+			}
+			filter = func(path string) bool {
+				return changedTemplates[filepath.Clean(path)]
+			}
+		}
+
+		results, err := c.processTemplates(srcs, dest, value, filter)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Re-render failed: %v\n", err)
+			continue
+		}
+		if changedTemplateResults(results) {
+			c.runOnChange()
+		}
+	}
+}
+
+// isLibraryFile returns true if path is under one of the template library
+// folders.
+func (c *templateContext) isLibraryFile(path string) bool {
+	for _, dir := range c.templateOptions.LibraryDirs {
+		rel, err := filepath.Rel(filepath.Clean(dir), path)
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *templateContext) runOnChange() {
+	if c.onChange == "" {
+		return
+	}
+	cmd := template.ShellCommand(c.onChange)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		fmt.Fprintf(os.Stderr, "On change %q failed: %v\n", c.onChange, err)
+	}
+}
@@ -1,9 +1,19 @@
 package cmd
 
 import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestTemplateCmd(t *testing.T) {
@@ -55,3 +65,276 @@ func TestTemplateCmdDelims(t *testing.T) {
 		t.Errorf("Content of %q was not as expected, %q != %q", resultPath, actual, expected)
 	}
 }
+
+func TestTemplateWatch(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("on change command uses sh syntax")
+	}
+	temp := t.TempDir()
+	src := filepath.Join(temp, "src")
+	dest := filepath.Join(temp, "dest")
+	configFile := filepath.Join(temp, "config.yml")
+	onChangeFile := filepath.Join(temp, "changes")
+	require.NoError(t, os.Mkdir(src, 0700))
+	require.NoError(t, os.WriteFile(configFile, []byte("a: one\nb: two\n"), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.clconf"), []byte(`{{ getv "/a" }}`), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "b.clconf"), []byte(`{{ getv "/b" }}`), 0600))
+
+	c := &templateContext{
+		rootContext:   &rootContext{ignoreEnv: true, yaml: []string{configFile}},
+		onChange:      "echo changed >> " + onChangeFile,
+		unixDirMode:   "700",
+		watch:         true,
+		watchDebounce: 20 * time.Millisecond,
+		watchInterval: 10 * time.Millisecond,
+	}
+	c.templateOptions.Extension = ".clconf"
+	c.templateOptions.CopyTemplatePerms = true
+	c.templateOptions.DirMode = 0700
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() { done <- c.watchTemplates(ctx, []string{src}, dest) }()
+
+	readDest := func(name string) string {
+		content, _ := os.ReadFile(filepath.Join(dest, name))
+		return string(content)
+	}
+	assert.Eventually(t, func() bool { return readDest("a") == "one" && readDest("b") == "two" },
+		5*time.Second, 10*time.Millisecond)
+
+	// only the changed template is re-rendered
+	require.NoError(t, os.Remove(filepath.Join(dest, "b")))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.clconf"), []byte(`A{{ getv "/a" }}`), 0600))
+	assert.Eventually(t, func() bool { return readDest("a") == "Aone" },
+		5*time.Second, 10*time.Millisecond)
+	assert.Equal(t, "", readDest("b"))
+
+	// config changes re-render everything and run on change
+	require.NoError(t, os.WriteFile(configFile, []byte("a: uno\nb: dos\n"), 0600))
+	assert.Eventually(t, func() bool { return readDest("a") == "Auno" && readDest("b") == "dos" },
+		5*time.Second, 10*time.Millisecond)
+	assert.Eventually(t, func() bool {
+		content, _ := os.ReadFile(onChangeFile)
+		return string(content) == "changed\nchanged\n"
+	}, 5*time.Second, 10*time.Millisecond)
+
+	cancel()
+	assert.NoError(t, <-done)
+}
+
+func TestTemplateCmdCheck(t *testing.T) {
+	temp := t.TempDir()
+	testDataPath := filepath.Join("..", "..", "testdata")
+	args := []string{"template",
+		"--yaml", filepath.Join(testDataPath, "testconfig.yml"),
+		filepath.Join(testDataPath, "testtemplate.txt.clconf"), temp}
+	resultPath := filepath.Join(temp, "testtemplate.txt")
+
+	for _, flag := range []string{"--dry-run", "--diff", "--check"} {
+		cmd := rootCmd()
+		cmd.SetArgs(append(args, flag))
+		err := cmd.Execute()
+		if flag == "--check" {
+			var exitErr *exitError
+			require.True(t, errors.As(err, &exitErr), "%s: %v", flag, err)
+			assert.Equal(t, 1, exitErr.exitCode)
+		} else {
+			require.NoError(t, err, flag)
+		}
+		assert.NoFileExists(t, resultPath, flag)
+	}
+
+	cmd := rootCmd()
+	cmd.SetArgs(args)
+	require.NoError(t, cmd.Execute())
+	assert.FileExists(t, resultPath)
+
+	cmd = rootCmd()
+	cmd.SetArgs(append(args, "--check"))
+	assert.NoError(t, cmd.Execute())
+}
+
+func TestTemplateCmdLibrary(t *testing.T) {
+	temp := t.TempDir()
+	src := filepath.Join(temp, "src")
+	lib := filepath.Join(src, "lib")
+	dest := filepath.Join(temp, "dest")
+	require.NoError(t, os.MkdirAll(lib, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(lib, "db.tmpl"),
+		[]byte(`{{ define "host" }}{{ getv "/app/db/hostname" }}{{ end }}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "host.txt.clconf"),
+		[]byte(`{{ include "host" . | toUpper }}`), 0644))
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"template",
+		"--yaml", filepath.Join("..", "..", "testdata", "testconfig.yml"),
+		"--template-lib", lib,
+		"--template-extension", "",
+		src, dest})
+	require.NoError(t, cmd.Execute())
+
+	content, err := os.ReadFile(filepath.Join(dest, "host.txt.clconf"))
+	require.NoError(t, err)
+	assert.Equal(t, "DB.PASTDEV.COM", string(content))
+	assert.NoFileExists(t, filepath.Join(dest, "lib", "db.tmpl"))
+}
+
+func TestTemplateCmdStrict(t *testing.T) {
+	temp := t.TempDir()
+	src := filepath.Join(temp, "env.txt.clconf")
+	require.NoError(t, os.WriteFile(src, []byte("{{ getenv \"CLCONF_STRICT_UNSET\" }}"), 0644))
+	args := []string{"template",
+		"--yaml", filepath.Join("..", "..", "testdata", "testconfig.yml"),
+		src, filepath.Join(temp, "dest")}
+
+	cmd := rootCmd()
+	cmd.SetArgs(args)
+	require.NoError(t, cmd.Execute())
+
+	cmd = rootCmd()
+	cmd.SetArgs(append(args, "--strict"))
+	err := cmd.Execute()
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), src)
+	assert.Contains(t, err.Error(), "env.txt.clconf:1:3")
+}
+
+func TestTemplateCmdManifest(t *testing.T) {
+	temp := t.TempDir()
+	testDataPath := filepath.Join("..", "..", "testdata")
+	src := filepath.Join(testDataPath, "testtemplate.txt.clconf")
+	manifestFile := filepath.Join(temp, "manifest.json")
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"template",
+		"--yaml", filepath.Join(testDataPath, "testconfig.yml"),
+		"--manifest", manifestFile,
+		"--dry-run",
+		src, temp})
+	require.NoError(t, cmd.Execute())
+
+	content, err := os.ReadFile(manifestFile)
+	require.NoError(t, err)
+	var manifest templateManifest
+	require.NoError(t, json.Unmarshal(content, &manifest))
+	require.Len(t, manifest.Templates, 1)
+	assert.Equal(t, src, manifest.Templates[0].Src)
+	assert.Equal(t, []string{"/app/db/hostname"}, manifest.Templates[0].Keys)
+	assert.Contains(t, manifest.Unused, "/app/db/port")
+	assert.NotContains(t, manifest.Unused, "/app/db/hostname")
+}
+
+func TestTemplateCmdToTar(t *testing.T) {
+	temp := t.TempDir()
+	testDataPath := filepath.Join("..", "..", "testdata")
+	tarFile := filepath.Join(temp, "out.tar")
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"template",
+		"--yaml", filepath.Join(testDataPath, "testconfig.yml"),
+		"--file-mode", "600",
+		"--to-tar", tarFile,
+		filepath.Join(testDataPath, "testtemplate.txt.clconf")})
+	require.NoError(t, cmd.Execute())
+
+	file, err := os.Open(tarFile)
+	require.NoError(t, err)
+	defer func() { _ = file.Close() }()
+	reader := tar.NewReader(file)
+	header, err := reader.Next()
+	require.NoError(t, err)
+	assert.Equal(t, "testtemplate.txt", header.Name)
+	assert.Equal(t, int64(0600), header.Mode)
+	content, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "db.pastdev.com", string(content))
+	_, err = reader.Next()
+	assert.Equal(t, io.EOF, err)
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"template", "--to-tar", tarFile, "--to-stdout", testDataPath})
+	assert.Error(t, cmd.Execute())
+}
+
+func TestTemplateCmdFixtures(t *testing.T) {
+	temp := t.TempDir()
+	src := filepath.Join(temp, "fixtures.txt.clconf")
+	dest := filepath.Join(temp, "dest")
+	hostsFile := filepath.Join(temp, "hosts.yml")
+	envFile := filepath.Join(temp, "test.env")
+	require.NoError(t, os.WriteFile(src, []byte(
+		`{{ (datetime).Format "2006-01-02" }} {{ getenv "STAGE" }} {{ join (lookupIP "db") "," }}`), 0644))
+	require.NoError(t, os.WriteFile(hostsFile, []byte("ip:\n  db: [10.0.0.1]\n"), 0644))
+	require.NoError(t, os.WriteFile(envFile, []byte("STAGE=test\n"), 0644))
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"template",
+		"--yaml", filepath.Join("..", "..", "testdata", "testconfig.yml"),
+		"--now", "2024-01-02T03:04:05Z",
+		"--hosts-file", hostsFile,
+		"--env-file", envFile,
+		src, dest})
+	require.NoError(t, cmd.Execute())
+
+	content, err := os.ReadFile(filepath.Join(dest, "fixtures.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "2024-01-02 test 10.0.0.1", string(content))
+}
+
+func TestTemplateCmdSandboxEncryptedFile(t *testing.T) {
+	temp := t.TempDir()
+	configFile := filepath.Join(temp, "config.yml")
+	require.NoError(t, os.WriteFile(configFile, []byte("db:\n  password: hunter2\n"), 0600))
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"--ignore-env",
+		"--public-keyring", filepath.Join("..", "..", "testdata", "test.pubring.gpg"),
+		"secrets", "encrypt-file", "--in-place", configFile})
+	require.NoError(t, cmd.Execute())
+
+	src := filepath.Join(temp, "password.txt.clconf")
+	dest := filepath.Join(temp, "dest")
+	require.NoError(t, os.WriteFile(src, []byte(`{{ getv "/db/password" }}`), 0644))
+	args := []string{"--ignore-env",
+		"--secret-keyring", filepath.Join("..", "..", "testdata", "test.secring.gpg"),
+		"template", "--yaml", configFile, src, dest}
+
+	cmd = rootCmd()
+	cmd.SetArgs(args)
+	require.NoError(t, cmd.Execute())
+	content, err := os.ReadFile(filepath.Join(dest, "password.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", string(content))
+
+	cmd = rootCmd()
+	cmd.SetArgs(append(args, "--sandbox"))
+	require.NoError(t, cmd.Execute())
+	content, err = os.ReadFile(filepath.Join(dest, "password.txt"))
+	require.NoError(t, err)
+	assert.NotEqual(t, "hunter2", string(content), "sandbox should not decrypt whole files")
+}
+
+func TestTemplateCmdSandbox(t *testing.T) {
+	t.Setenv("CLCONF_SANDBOX_SECRET", "secret")
+	t.Setenv("CLCONF_SANDBOX_NAME", "name")
+	temp := t.TempDir()
+	src := filepath.Join(temp, "env.txt.clconf")
+	dest := filepath.Join(temp, "dest")
+	require.NoError(t, os.WriteFile(src, []byte(
+		`[{{ getenv "CLCONF_SANDBOX_SECRET" }}][{{ getenv "CLCONF_SANDBOX_NAME" }}]`), 0644))
+	args := []string{"template",
+		"--yaml", filepath.Join("..", "..", "testdata", "testconfig.yml"),
+		"--sandbox", "--sandbox-env", "CLCONF_SANDBOX_N*"}
+
+	cmd := rootCmd()
+	cmd.SetArgs(append(args, src, dest))
+	require.NoError(t, cmd.Execute())
+	content, err := os.ReadFile(filepath.Join(dest, "env.txt"))
+	require.NoError(t, err)
+	assert.Equal(t, "[][name]", string(content))
+
+	require.NoError(t, os.WriteFile(src, []byte(`{{ fileExists "/etc/passwd" }}`), 0644))
+	cmd = rootCmd()
+	cmd.SetArgs(append(args, src, dest))
+	assert.ErrorContains(t, cmd.Execute(), `function "fileExists" not defined`)
+}
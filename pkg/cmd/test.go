@@ -0,0 +1,114 @@
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/pastdev/clconf/v3/pkg/template"
+	"github.com/spf13/cobra"
+)
+
+type testContext struct {
+	*rootContext
+	testOptions template.TestOptions
+	format      string
+}
+
+func testCmd(rootCmdContext *rootContext) *cobra.Command {
+	c := &testContext{rootContext: rootCmdContext}
+
+	var cmd = &cobra.Command{
+		Use:   "test <dir> [dir2...]",
+		Short: "Run template golden tests",
+		Long: `Render the template test cases found under each dir and compare the results
+with the expected output (or error). The process environment is never read
+by getenv, each test case supplies its own. A test case is either:
+
+  a folder containing template.clconf, along with input.yml (the config,
+  optional) and either expected (the expected output) or error (a substring
+  of the expected error)
+
+  an entry in the tests list of a *.test.yml file:
+    name            the test name (defaults to its index)
+    template        the template text (or template_file)
+    config          config merged over the config_files
+    prefix          prepended to all template getv/gets paths
+    expected        the expected output (or expected_file)
+    error           a substring of the expected error
+    env             the environment read by getenv
+    now             the RFC 3339 time returned by datetime
+    hosts           the ip and srv records resolved by the lookup functions
+
+Files are relative to the test folder or spec. Exits with code 1 if any test
+fails.`,
+		Example: `  # tests/nginx.test.yml
+  #   tests:
+  #   - name: default port
+  #     template_file: ../templates/nginx.conf.clconf
+  #     config: {server: {host: example.com}}
+  #     expected_file: nginx-default.conf
+  #   - name: missing host
+  #     template: '{{ getv "/server/host" }}'
+  #     error: key does not exist
+  clconf test tests
+
+  # Report to a CI server
+  clconf test tests --format junit > report.xml`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(_ *cobra.Command, args []string) error {
+			return c.test(args)
+		},
+	}
+
+	cmd.Flags().StringVar(
+		&c.format,
+		"format",
+		string(template.TestReportText),
+		"The report format: text, tap or junit")
+	cmd.Flags().StringArrayVar(
+		&c.testOptions.LibraryDirs,
+		"template-lib",
+		nil,
+		"A `folder` of *.tmpl files whose templates are available to every template (via template or include)")
+	cmd.Flags().BoolVar(
+		&c.testOptions.Strict,
+		"strict",
+		false,
+		"Fail on missing map keys, unset getenv variables without a default and DNS lookup failures")
+
+	return cmd
+}
+
+func (c *testContext) test(dirs []string) error {
+	format, err := template.ParseTestReportFormat(c.format)
+	if err != nil {
+		return err
+	}
+
+	cases := []template.TestCase{}
+	for _, dir := range dirs {
+		found, err := template.DiscoverTests(dir)
+		if err != nil {
+			return err
+		}
+		cases = append(cases, found...)
+	}
+	if len(cases) == 0 {
+		return fmt.Errorf("no tests found in %v", dirs)
+	}
+
+	c.testOptions.SecretAgent, _ = c.newSecretAgent()
+	results, err := template.RunTests(cases, c.testOptions)
+	if err != nil {
+		return fmt.Errorf("run tests: %w", err)
+	}
+	err = template.WriteTestReport(os.Stdout, format, "clconf", results)
+	if err != nil {
+		return err
+	}
+
+	if failed := template.FailedTests(results); failed > 0 {
+		return NewExitError(1, fmt.Sprintf("%d of %d tests failed", failed, len(results)))
+	}
+	return nil
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTestCmd(t *testing.T) {
+	temp := t.TempDir()
+	spec := filepath.Join(temp, "host.test.yml")
+	require.NoError(t, os.WriteFile(spec, []byte(`tests:
+- name: host
+  template: '{{ getv "/app/db/hostname" }}'
+  config: {app: {db: {hostname: db.example.com}}}
+  expected: db.example.com
+`), 0644))
+
+	cmd := rootCmd()
+	cmd.SetArgs([]string{"test", "--format", "tap", temp})
+	require.NoError(t, cmd.Execute())
+
+	require.NoError(t, os.WriteFile(spec, []byte(`tests:
+- template: '{{ getv "/app/db/hostname" }}'
+  expected: db.example.com
+`), 0644))
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"test", temp})
+	var exitErr *exitError
+	require.True(t, errors.As(cmd.Execute(), &exitErr))
+	assert.Equal(t, 1, exitErr.exitCode)
+
+	cmd = rootCmd()
+	cmd.SetArgs([]string{"test", t.TempDir()})
+	assert.ErrorContains(t, cmd.Execute(), "no tests found")
+}
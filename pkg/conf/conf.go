@@ -8,6 +8,7 @@ import (
 	"os"
 	"regexp"
 
+	"github.com/pastdev/clconf/v3/pkg/secret"
 	"github.com/pastdev/clconf/v3/pkg/yamljson"
 )
 
@@ -35,6 +36,17 @@ type ConfSources struct { //nolint:revive
 	// An optional (can be nil) stream to read raw yaml (potentially multiple
 	// inline documents)
 	Stream io.Reader
+	// SecretAgent is optional (can be nil). If supplied, any document that
+	// was encrypted as a whole (see secret.SecretAgent.EncryptTree) will be
+	// verified and decrypted prior to merging. Encrypt-only agents are
+	// ignored.
+	SecretAgent *secret.SecretAgent
+	// SecretAgentLoader is optional (can be nil). If supplied, and
+	// SecretAgent is nil, it is called for the SecretAgent only once a
+	// document that was encrypted as a whole is read, so that a keyring that
+	// can not be loaded only fails loading the configs that need it. It may
+	// return a nil agent, in which case encrypted documents are merged as is.
+	SecretAgentLoader func() (*secret.SecretAgent, error)
 }
 
 // LoadInterface will load the config determined by settings in the struct. In order
@@ -52,17 +64,30 @@ func (s ConfSources) LoadSettableInterface() (interface{}, string, error) {
 	return s.loadInterface(true)
 }
 
+// SourceFiles returns all the files that config is loaded from: Files, the
+// YAML_FILES env var (if Environment) and Patches.
+func (s ConfSources) SourceFiles() []string {
+	return append(s.files(), s.Patches...)
+}
+
+func (s ConfSources) files() []string {
+	files := append([]string{}, s.Files...)
+	if s.Environment {
+		if yamlFiles, ok := os.LookupEnv("YAML_FILES"); ok && len(yamlFiles) > 0 {
+			files = append(files, Splitter.Split(yamlFiles, -1)...)
+		}
+	}
+	return files
+}
+
 // LoadInterface will load the config determined by settings in the struct. In order
 // of precedence (highest last), Files, YAML_FILES env var, Overrides,
 // YAML_VARS env var, Stream.
 func (s ConfSources) loadInterface(settable bool) (interface{}, string, error) {
-	files := s.Files
+	files := s.files()
 	overrides := s.Overrides
 
 	if s.Environment {
-		if yamlFiles, ok := os.LookupEnv("YAML_FILES"); ok && len(yamlFiles) > 0 {
-			files = append(files, Splitter.Split(yamlFiles, -1)...)
-		}
 		if yamlVars, ok := os.LookupEnv("YAML_VARS"); ok && len(yamlVars) > 0 {
 			envVars, err := ReadEnvVars(Splitter.Split(yamlVars, -1)...)
 			if err != nil {
@@ -108,9 +133,9 @@ func (s ConfSources) loadInterface(settable bool) (interface{}, string, error) {
 		yamls = append(yamls, string(streamYaml))
 	}
 
-	merged, err := yamljson.UnmarshalYamlInterface(yamls...)
+	merged, err := s.unmarshal(yamls)
 	if err != nil {
-		return nil, "", fmt.Errorf("unmarshal: %w", err)
+		return nil, "", err
 	}
 
 	if len(s.Patches) > 0 {
@@ -140,6 +165,53 @@ func (s ConfSources) loadInterface(settable bool) (interface{}, string, error) {
 	return merged, "", nil
 }
 
+// unmarshal will unmarshal and merge yamls decrypting any encrypted documents
+// if a SecretAgent is available.
+func (s ConfSources) unmarshal(yamls []string) (interface{}, error) {
+	if (s.SecretAgent == nil && s.SecretAgentLoader == nil) ||
+		(s.SecretAgent != nil && s.SecretAgent.EncryptOnly()) {
+		merged, err := yamljson.UnmarshalYamlInterface(yamls...)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal: %w", err)
+		}
+		return merged, nil
+	}
+
+	secretAgent := s.SecretAgent
+	loaded := secretAgent != nil
+	var docs []interface{}
+	for _, yaml := range yamls {
+		moreDocs, err := yamljson.UnmarshalAllYaml(yaml)
+		if err != nil {
+			return nil, fmt.Errorf("unmarshal: %w", err)
+		}
+		for _, doc := range moreDocs {
+			if secret.IsEncryptedTree(doc) {
+				if !loaded {
+					secretAgent, err = s.SecretAgentLoader()
+					if err != nil {
+						return nil, fmt.Errorf("load secret agent: %w", err)
+					}
+					loaded = true
+				}
+				if secretAgent != nil && !secretAgent.EncryptOnly() {
+					err = secretAgent.DecryptTree(doc)
+					if err != nil {
+						return nil, fmt.Errorf("decrypt: %w", err)
+					}
+				}
+			}
+			docs = append(docs, doc)
+		}
+	}
+
+	merged, err := yamljson.MergeInterfaces(docs...)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal: %w", err)
+	}
+	return merged, nil
+}
+
 // DecodeBase64Strings will decode all the base64 strings supplied
 func DecodeBase64Strings(values ...string) ([]string, error) {
 	var contents []string
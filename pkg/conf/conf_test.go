@@ -2,14 +2,17 @@ package conf_test
 
 import (
 	"encoding/base64"
+	"errors"
 	"os"
 	"path"
 	"reflect"
 	"testing"
 
 	"github.com/pastdev/clconf/v3/pkg/conf"
+	"github.com/pastdev/clconf/v3/pkg/secret"
 	"github.com/pastdev/clconf/v3/pkg/yamljson"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestBase64Strings(t *testing.T) {
@@ -164,6 +167,68 @@ func TestLoadConf(t *testing.T) {
 	assert.Nil(t, os.Unsetenv("YAML_VAR"))
 }
 
+func TestLoadConfEncrypted(t *testing.T) {
+	tempDir := t.TempDir()
+	secretAgent, err := secret.NewTestSecretAgent()
+	require.NoError(t, err)
+
+	encrypted, err := yamljson.UnmarshalSingleYaml("a: secret\nb:\n  c: 1")
+	require.NoError(t, err)
+	require.NoError(t, secretAgent.EncryptTree(encrypted))
+	encryptedYaml, err := yamljson.MarshalYaml(encrypted)
+	require.NoError(t, err)
+	encryptedFile := path.Join(tempDir, "encrypted")
+	require.NoError(t, os.WriteFile(encryptedFile, encryptedYaml, 0600))
+	b64Arg := base64.StdEncoding.EncodeToString([]byte("a: b64Arg"))
+
+	expected, _ := yamljson.UnmarshalYamlInterface("a: b64Arg\nb:\n  c: 1")
+	actual, err := conf.ConfSources{
+		Files:       []string{encryptedFile},
+		Overrides:   []string{b64Arg},
+		SecretAgent: secretAgent,
+	}.LoadInterface()
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+
+	// without an agent the file is loaded as is
+	actual, err = conf.ConfSources{Files: []string{encryptedFile}}.LoadInterface()
+	require.NoError(t, err)
+	assert.True(t, secret.IsEncryptedTree(actual))
+
+	// the loader is only called for encrypted documents
+	loads := 0
+	loader := func() (*secret.SecretAgent, error) {
+		loads++
+		return secretAgent, nil
+	}
+	_, err = conf.ConfSources{Overrides: []string{b64Arg}, SecretAgentLoader: loader}.LoadInterface()
+	require.NoError(t, err)
+	assert.Equal(t, 0, loads)
+	actual, err = conf.ConfSources{
+		Files:             []string{encryptedFile},
+		Overrides:         []string{b64Arg},
+		SecretAgentLoader: loader,
+	}.LoadInterface()
+	require.NoError(t, err)
+	assert.Equal(t, expected, actual)
+	assert.Equal(t, 1, loads)
+	_, err = conf.ConfSources{
+		Files: []string{encryptedFile},
+		SecretAgentLoader: func() (*secret.SecretAgent, error) {
+			return nil, errors.New("no keyring")
+		},
+	}.LoadInterface()
+	assert.ErrorContains(t, err, "no keyring")
+
+	tampered := append(encryptedYaml, []byte("d: plain\n")...)
+	require.NoError(t, os.WriteFile(encryptedFile, tampered, 0600))
+	_, err = conf.ConfSources{
+		Files:       []string{encryptedFile},
+		SecretAgent: secretAgent,
+	}.LoadInterface()
+	assert.Error(t, err)
+}
+
 func TestReadEnvVars(t *testing.T) {
 	actual, err := conf.ReadEnvVars()
 	if err != nil {
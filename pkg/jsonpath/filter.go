@@ -0,0 +1,185 @@
+package jsonpath
+
+import (
+	"reflect"
+	"regexp"
+)
+
+// filterExpr is a filter expression tested on each child.
+type filterExpr interface {
+	test(current Match, root interface{}) bool
+}
+
+type orExpr struct {
+	left, right filterExpr
+}
+
+func (e orExpr) test(current Match, root interface{}) bool {
+	return e.left.test(current, root) || e.right.test(current, root)
+}
+
+type andExpr struct {
+	left, right filterExpr
+}
+
+func (e andExpr) test(current Match, root interface{}) bool {
+	return e.left.test(current, root) && e.right.test(current, root)
+}
+
+type notExpr struct {
+	expr filterExpr
+}
+
+func (e notExpr) test(current Match, root interface{}) bool {
+	return !e.expr.test(current, root)
+}
+
+// existsExpr is true if path matches anything.
+type existsExpr struct {
+	path pathOperand
+}
+
+func (e existsExpr) test(current Match, root interface{}) bool {
+	return len(e.path.values(current, root)) > 0
+}
+
+// constExpr is a true or false literal.
+type constExpr bool
+
+func (e constExpr) test(Match, interface{}) bool {
+	return bool(e)
+}
+
+// compareExpr is true if any of the left values compares to any of the right
+// values with op.
+type compareExpr struct {
+	op          string
+	left, right operand
+}
+
+func (e compareExpr) test(current Match, root interface{}) bool {
+	rights := e.right.values(current, root)
+	for _, left := range e.left.values(current, root) {
+		for _, right := range rights {
+			if compare(e.op, left, right) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// regexExpr is true if any of the values is a string matching re.
+type regexExpr struct {
+	value operand
+	re    *regexp.Regexp
+}
+
+func (e regexExpr) test(current Match, root interface{}) bool {
+	for _, value := range e.value.values(current, root) {
+		if s, ok := value.(string); ok && e.re.MatchString(s) {
+			return true
+		}
+	}
+	return false
+}
+
+// operand is a side of a comparison.
+type operand interface {
+	values(current Match, root interface{}) []interface{}
+}
+
+// pathOperand is the values matching a path from the current node (@) or the
+// root ($).
+type pathOperand struct {
+	root     bool
+	segments []segment
+}
+
+func (o pathOperand) values(current Match, root interface{}) []interface{} {
+	start := current
+	if o.root {
+		start = Match{Path: []interface{}{}, Value: root}
+	}
+	matches := find(o.segments, start, root)
+	result := make([]interface{}, 0, len(matches))
+	for _, match := range matches {
+		result = append(result, match.Value)
+	}
+	return result
+}
+
+type literalOperand struct {
+	value interface{}
+}
+
+func (o literalOperand) values(Match, interface{}) []interface{} {
+	return []interface{}{o.value}
+}
+
+// compare compares numbers numerically and strings lexically, other values
+// can only be equal.
+func compare(op string, left, right interface{}) bool {
+	if op == "!=" {
+		return !compare("==", left, right)
+	}
+	if l, ok := toFloat(left); ok {
+		if r, ok := toFloat(right); ok {
+			return compareOrdered(op, l, r)
+		}
+		return false
+	}
+	if l, ok := left.(string); ok {
+		if r, ok := right.(string); ok {
+			return compareOrdered(op, l, r)
+		}
+		return false
+	}
+	return op == "==" && reflect.DeepEqual(left, right)
+}
+
+func compareOrdered[T float64 | string](op string, left, right T) bool {
+	switch op {
+	case "==":
+		return left == right
+	case "<":
+		return left < right
+	case "<=":
+		return left <= right
+	case ">":
+		return left > right
+	case ">=":
+		return left >= right
+	}
+	return false
+}
+
+func toFloat(value interface{}) (float64, bool) {
+	switch typed := value.(type) {
+	case int:
+		return float64(typed), true
+	case int8:
+		return float64(typed), true
+	case int16:
+		return float64(typed), true
+	case int32:
+		return float64(typed), true
+	case int64:
+		return float64(typed), true
+	case uint:
+		return float64(typed), true
+	case uint8:
+		return float64(typed), true
+	case uint16:
+		return float64(typed), true
+	case uint32:
+		return float64(typed), true
+	case uint64:
+		return float64(typed), true
+	case float32:
+		return float64(typed), true
+	case float64:
+		return typed, true
+	}
+	return 0, false
+}
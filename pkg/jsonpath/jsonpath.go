@@ -0,0 +1,271 @@
+// Package jsonpath finds values in the trees of maps and lists unmarshaled
+// from yaml or json (ie: map[interface{}]interface{}, map[string]interface{}
+// and []interface{}) using jsonpath expressions, without converting them.
+//
+// Supported are the root ($), child names (.name, ['name'], ['a','b']),
+// wildcards (.*, [*]), recursive descent (..name, ..*, ..[0]), list indexes
+// ([0], [-1], [0,2]), list slices ([1:3], [::2]) and filters
+// ([?(expression)]). Filter expressions compare paths relative to the
+// current node (@) or the root ($) with literals (numbers, 'strings', true,
+// false and null) using ==, !=, <, <=, >, >= and =~ (a regular expression
+// written /pattern/ or /pattern/i), combined with &&, ||, ! and parentheses.
+// A path alone tests that it exists. The leading $ is optional (ie: a.b and
+// .a.b are $.a.b).
+//
+// Map keys are matched by their string form (ie: .3 and [3] match the yaml
+// key 3) and maps are traversed in sorted key order.
+package jsonpath
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ErrSyntax is returned by Compile for invalid expressions.
+var ErrSyntax = errors.New("jsonpath syntax error")
+
+// Path is a compiled jsonpath expression.
+type Path struct {
+	expr     string
+	segments []segment
+}
+
+// Match is a value found by a Path.
+type Match struct {
+	// Path is where Value was found: the map keys (as they are in the map)
+	// and list indexes (as int) from the root.
+	Path  []interface{}
+	Value interface{}
+}
+
+// Key returns the clconf key path of the match (ie: /images/0/tag).
+func (m Match) Key() string {
+	elements := make([]string, 0, len(m.Path))
+	for _, element := range m.Path {
+		elements = append(elements, fmt.Sprintf("%v", element))
+	}
+	return "/" + strings.Join(elements, "/")
+}
+
+// Compile parses a jsonpath expression.
+func Compile(expr string) (*Path, error) {
+	p := &parser{expr: expr}
+	segments, err := p.parse()
+	if err != nil {
+		return nil, err
+	}
+	return &Path{expr: expr, segments: segments}, nil
+}
+
+// String returns the expression the path was compiled from.
+func (p *Path) String() string {
+	return p.expr
+}
+
+// Find returns the values in data matching the path in document order.
+func (p *Path) Find(data interface{}) []Match {
+	return find(p.segments, Match{Path: []interface{}{}, Value: data}, data)
+}
+
+func find(segments []segment, start Match, root interface{}) []Match {
+	nodes := []Match{start}
+	for _, segment := range segments {
+		next := []Match{}
+		for _, node := range nodes {
+			if !segment.recursive {
+				next = segment.selectFrom(node, root, next)
+				continue
+			}
+			for _, descendant := range descendants(node, nil) {
+				next = segment.selectFrom(descendant, root, next)
+			}
+		}
+		nodes = next
+	}
+	return nodes
+}
+
+// segment is a step of a path selecting the union of its selectors from
+// each node, or from each node and all of its descendants if recursive.
+type segment struct {
+	recursive bool
+	selectors []selector
+}
+
+func (s segment) selectFrom(node Match, root interface{}, out []Match) []Match {
+	for _, selector := range s.selectors {
+		out = selector.selectFrom(node, root, out)
+	}
+	return out
+}
+
+type selector interface {
+	// selectFrom returns out with the children of node it selects appended.
+	selectFrom(node Match, root interface{}, out []Match) []Match
+}
+
+// child returns the match for the value at key under node.
+func child(node Match, key interface{}, value interface{}) Match {
+	// the full slice expression makes append copy rather than share the
+	// parent path between siblings
+	return Match{Path: append(node.Path[:len(node.Path):len(node.Path)], key), Value: value}
+}
+
+// children returns the values of a map (in key order) or list.
+func children(node Match) []Match {
+	result := []Match{}
+	switch typed := node.Value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for k := range typed {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			result = append(result, child(node, k, typed[k]))
+		}
+	case map[interface{}]interface{}:
+		keys := make([]interface{}, 0, len(typed))
+		for k := range typed {
+			keys = append(keys, k)
+		}
+		sort.SliceStable(keys, func(i, j int) bool { return lessKey(keys[i], keys[j]) })
+		for _, k := range keys {
+			result = append(result, child(node, k, typed[k]))
+		}
+	case []interface{}:
+		for i, v := range typed {
+			result = append(result, child(node, i, v))
+		}
+	}
+	return result
+}
+
+// lessKey orders numbers (numerically) before other keys (by string form).
+func lessKey(a, b interface{}) bool {
+	af, aNumber := toFloat(a)
+	bf, bNumber := toFloat(b)
+	switch {
+	case aNumber && bNumber:
+		return af < bf
+	case aNumber != bNumber:
+		return aNumber
+	}
+	return fmt.Sprintf("%v", a) < fmt.Sprintf("%v", b)
+}
+
+// descendants returns out with node and all of its descendants appended in
+// document order.
+func descendants(node Match, out []Match) []Match {
+	out = append(out, node)
+	for _, c := range children(node) {
+		out = descendants(c, out)
+	}
+	return out
+}
+
+// nameSelector selects the map value whose key is, or has the string form,
+// name.
+type nameSelector string
+
+func (name nameSelector) selectFrom(node Match, _ interface{}, out []Match) []Match {
+	switch typed := node.Value.(type) {
+	case map[string]interface{}:
+		if v, ok := typed[string(name)]; ok {
+			out = append(out, child(node, string(name), v))
+		}
+	case map[interface{}]interface{}:
+		if v, ok := typed[string(name)]; ok {
+			return append(out, child(node, string(name), v))
+		}
+		for _, c := range children(node) {
+			if fmt.Sprintf("%v", c.Path[len(c.Path)-1]) == string(name) {
+				return append(out, c)
+			}
+		}
+	}
+	return out
+}
+
+// wildcardSelector selects all of the values of a map or list.
+type wildcardSelector struct{}
+
+func (wildcardSelector) selectFrom(node Match, _ interface{}, out []Match) []Match {
+	return append(out, children(node)...)
+}
+
+// indexSelector selects a list element, counting from the end if negative,
+// or the map value whose key has the string form of the index.
+type indexSelector int
+
+func (index indexSelector) selectFrom(node Match, root interface{}, out []Match) []Match {
+	list, ok := node.Value.([]interface{})
+	if !ok {
+		return nameSelector(strconv.Itoa(int(index))).selectFrom(node, root, out)
+	}
+	i := int(index)
+	if i < 0 {
+		i += len(list)
+	}
+	if i < 0 || i >= len(list) {
+		return out
+	}
+	return append(out, child(node, i, list[i]))
+}
+
+// sliceSelector selects the list elements from start (inclusive) to end
+// (exclusive) by step as python slices do.
+type sliceSelector struct {
+	start, end *int
+	step       int
+}
+
+func (s sliceSelector) selectFrom(node Match, _ interface{}, out []Match) []Match {
+	list, ok := node.Value.([]interface{})
+	if !ok {
+		return out
+	}
+	length := len(list)
+	normalize := func(bound *int, defaultValue, lower, upper int) int {
+		if bound == nil {
+			return defaultValue
+		}
+		i := *bound
+		if i < 0 {
+			i += length
+		}
+		return min(max(i, lower), upper)
+	}
+	if s.step > 0 {
+		start := normalize(s.start, 0, 0, length)
+		end := normalize(s.end, length, 0, length)
+		for i := start; i < end; i += s.step {
+			out = append(out, child(node, i, list[i]))
+		}
+		return out
+	}
+	start := normalize(s.start, length-1, -1, length-1)
+	end := normalize(s.end, -1, -1, length-1)
+	for i := start; i > end; i += s.step {
+		out = append(out, child(node, i, list[i]))
+	}
+	return out
+}
+
+// filterSelector selects the values of a map or list for which test is
+// true.
+type filterSelector struct {
+	test filterExpr
+}
+
+func (s filterSelector) selectFrom(node Match, root interface{}, out []Match) []Match {
+	for _, c := range children(node) {
+		if s.test.test(c, root) {
+			out = append(out, c)
+		}
+	}
+	return out
+}
@@ -0,0 +1,128 @@
+package jsonpath_test
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/pastdev/clconf/v3/pkg/jsonpath"
+	"github.com/pastdev/clconf/v3/pkg/yamljson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const storeYml = `---
+store:
+  book:
+  - {category: reference, author: Nigel Rees, title: Sayings, price: 8.95}
+  - {category: fiction, author: Evelyn Waugh, title: Sword, price: 12}
+  - {category: fiction, author: Herman Melville, title: Moby Dick, isbn: 0-553, price: 8.99}
+  - {category: fiction, author: Tolkien, title: The Lord, isbn: 0-395, price: 22.99}
+  bicycle: {color: red, price: 19.95}
+expensive: 10
+ports:
+  80: http
+  443: https
+`
+
+func TestFind(t *testing.T) {
+	data, err := yamljson.UnmarshalSingleYaml(storeYml)
+	require.NoError(t, err)
+
+	tester := func(name, expr string, expectedKeys []string) {
+		t.Run(name, func(t *testing.T) {
+			path, err := jsonpath.Compile(expr)
+			require.NoError(t, err)
+			keys := []string{}
+			for _, match := range path.Find(data) {
+				keys = append(keys, match.Key())
+			}
+			assert.Equal(t, expectedKeys, keys)
+		})
+	}
+
+	tester("root", "$", []string{"/"})
+	tester("child", "$.store.bicycle.color", []string{"/store/bicycle/color"})
+	tester("implicit root", "store.bicycle.color", []string{"/store/bicycle/color"})
+	tester("implicit root dot", ".store.bicycle.color", []string{"/store/bicycle/color"})
+	tester("implicit root bracket", "['store'].bicycle.color", []string{"/store/bicycle/color"})
+	tester("implicit root recursive", "..bicycle.color", []string{"/store/bicycle/color"})
+	tester("implicit root empty", "", []string{"/"})
+	tester("bracket child", `$['store']["bicycle"]['color', 'price']`,
+		[]string{"/store/bicycle/color", "/store/bicycle/price"})
+	tester("missing", "$.store.car", []string{})
+	tester("wildcard in key order", "$.store.*", []string{"/store/bicycle", "/store/book"})
+	tester("recursive", "$..price", []string{
+		"/store/bicycle/price",
+		"/store/book/0/price",
+		"/store/book/1/price",
+		"/store/book/2/price",
+		"/store/book/3/price",
+	})
+	tester("recursive bracket", "$..book[0].title", []string{"/store/book/0/title"})
+	tester("negative index", "$.store.book[-1].title", []string{"/store/book/3/title"})
+	tester("index out of range", "$.store.book[4]", []string{})
+	tester("union", "$.store.book[0,2].title", []string{"/store/book/0/title", "/store/book/2/title"})
+	tester("slice", "$.store.book[1:3].title", []string{"/store/book/1/title", "/store/book/2/title"})
+	tester("slice open", "$.store.book[-2:].title", []string{"/store/book/2/title", "/store/book/3/title"})
+	tester("slice step", "$.store.book[::-2].title", []string{"/store/book/3/title", "/store/book/1/title"})
+	tester("integer keys", "$.ports.*", []string{"/ports/80", "/ports/443"})
+	tester("integer key name", "$.ports.443", []string{"/ports/443"})
+	tester("integer key index", "$.ports[80]", []string{"/ports/80"})
+	tester("filter exists", "$.store.book[?(@.isbn)].title", []string{"/store/book/2/title", "/store/book/3/title"})
+	tester("filter not exists", "$.store.book[?(!@.isbn)].title", []string{"/store/book/0/title", "/store/book/1/title"})
+	tester("filter number", "$..book[?(@.price < 10)].title", []string{"/store/book/0/title", "/store/book/2/title"})
+	tester("filter int and float", "$..book[?(@.price == 12.0)].title", []string{"/store/book/1/title"})
+	tester("filter root", "$..book[?(@.price > $.expensive)].title", []string{"/store/book/1/title", "/store/book/3/title"})
+	tester("filter string", `$..book[?(@.category == "reference")].title`, []string{"/store/book/0/title"})
+	tester("filter and or",
+		"$..book[?(@.category == 'fiction' && (@.price < 10 || @.price > 20))].title",
+		[]string{"/store/book/2/title", "/store/book/3/title"})
+	tester("filter regex", "$..book[?(@.author =~ /^t/i)].title", []string{"/store/book/3/title"})
+	tester("filter map values", "$.store[?(@.color)]", []string{"/store/bicycle"})
+	tester("filter no parentheses", "$..book[?@.isbn == '0-395'].title", []string{"/store/book/3/title"})
+}
+
+func TestFindValues(t *testing.T) {
+	var data interface{}
+	require.NoError(t, json.Unmarshal([]byte(`{"a": [{"b": 1}, {"b": "2"}, {"c": null}]}`), &data))
+
+	path, err := jsonpath.Compile("$.a[*].*")
+	require.NoError(t, err)
+	assert.Equal(t,
+		[]jsonpath.Match{
+			{Path: []interface{}{"a", 0, "b"}, Value: float64(1)},
+			{Path: []interface{}{"a", 1, "b"}, Value: "2"},
+			{Path: []interface{}{"a", 2, "c"}, Value: nil},
+		},
+		path.Find(data))
+
+	path, err = jsonpath.Compile("$.a[?(@.c == null)]")
+	require.NoError(t, err)
+	assert.Equal(t,
+		[]jsonpath.Match{{Path: []interface{}{"a", 2}, Value: map[string]interface{}{"c": nil}}},
+		path.Find(data))
+}
+
+func TestCompileInvalid(t *testing.T) {
+	for _, expr := range []string{
+		"*store",
+		"store.",
+		"$.",
+		"$..",
+		"$[",
+		"$['a'",
+		"$[a]",
+		"$[::0]",
+		"$[?(@.a ==)]",
+		"$[?(@.a =~ 'a')]",
+		"$[?(@.a =~ /(/)]",
+		"$[?('a')]",
+		"$.a b",
+	} {
+		t.Run(expr, func(t *testing.T) {
+			_, err := jsonpath.Compile(expr)
+			assert.True(t, errors.Is(err, jsonpath.ErrSyntax), "%v", err)
+		})
+	}
+}
@@ -0,0 +1,433 @@
+package jsonpath
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// nameDelimiters end a dot notation name.
+const nameDelimiters = ".[]()'\"=!<>&|,~*?@$ \t\r\n"
+
+type parser struct {
+	expr string
+	pos  int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%w at offset %d of %q: %s", ErrSyntax, p.pos, p.expr, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.expr)
+}
+
+func (p *parser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.expr[p.pos]
+}
+
+// consume advances past prefix if the expression continues with it.
+func (p *parser) consume(prefix string) bool {
+	if strings.HasPrefix(p.expr[p.pos:], prefix) {
+		p.pos += len(prefix)
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(prefix string) error {
+	if !p.consume(prefix) {
+		return p.errorf("expected %q", prefix)
+	}
+	return nil
+}
+
+func (p *parser) skipSpace() {
+	for !p.done() && strings.IndexByte(" \t\r\n", p.peek()) >= 0 {
+		p.pos++
+	}
+}
+
+// parse parses the whole expression: $ followed by segments. The $ is
+// optional so a.b and .a.b are both $.a.b.
+func (p *parser) parse() ([]segment, error) {
+	p.skipSpace()
+	segments := []segment{}
+	if !p.consume("$") && !p.done() && p.peek() != '.' && p.peek() != '[' {
+		selectors, err := p.parseDotSelector()
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment{selectors: selectors})
+	}
+	rest, err := p.parseSegments()
+	if err != nil {
+		return nil, err
+	}
+	segments = append(segments, rest...)
+	p.skipSpace()
+	if !p.done() {
+		return nil, p.errorf("unexpected %q", p.peek())
+	}
+	return segments, nil
+}
+
+func (p *parser) parseSegments() ([]segment, error) {
+	segments := []segment{}
+	for {
+		var segment segment
+		var err error
+		switch {
+		case p.consume(".."):
+			segment.recursive = true
+			if p.peek() == '[' {
+				segment.selectors, err = p.parseBracket()
+			} else {
+				segment.selectors, err = p.parseDotSelector()
+			}
+		case p.consume("."):
+			segment.selectors, err = p.parseDotSelector()
+		case p.peek() == '[':
+			segment.selectors, err = p.parseBracket()
+		default:
+			return segments, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, segment)
+	}
+}
+
+// parseDotSelector parses the * or name following a dot.
+func (p *parser) parseDotSelector() ([]selector, error) {
+	if p.consume("*") {
+		return []selector{wildcardSelector{}}, nil
+	}
+	start := p.pos
+	for !p.done() && strings.IndexByte(nameDelimiters, p.peek()) < 0 {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, p.errorf("expected a name or *")
+	}
+	return []selector{nameSelector(p.expr[start:p.pos])}, nil
+}
+
+// parseBracket parses a filter or the comma separated names, indexes,
+// slices and wildcards in brackets.
+func (p *parser) parseBracket() ([]selector, error) {
+	err := p.expect("[")
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.consume("?") {
+		test, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		err = p.expect("]")
+		if err != nil {
+			return nil, err
+		}
+		return []selector{filterSelector{test: test}}, nil
+	}
+
+	selectors := []selector{}
+	for {
+		p.skipSpace()
+		var selector selector
+		switch c := p.peek(); {
+		case c == '\'' || c == '"':
+			name, err := p.parseString()
+			if err != nil {
+				return nil, err
+			}
+			selector = nameSelector(name)
+		case c == '*':
+			p.pos++
+			selector = wildcardSelector{}
+		case c == '-' || c == ':' || (c >= '0' && c <= '9'):
+			selector, err = p.parseIndexOrSlice()
+			if err != nil {
+				return nil, err
+			}
+		default:
+			return nil, p.errorf("expected a name, index, slice, * or filter")
+		}
+		selectors = append(selectors, selector)
+
+		p.skipSpace()
+		if p.consume("]") {
+			return selectors, nil
+		}
+		err = p.expect(",")
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseString parses a single or double quoted string in which \ escapes
+// the following character.
+func (p *parser) parseString() (string, error) {
+	quote := p.peek()
+	p.pos++
+	var value strings.Builder
+	for !p.done() {
+		c := p.peek()
+		p.pos++
+		switch c {
+		case quote:
+			return value.String(), nil
+		case '\\':
+			if p.done() {
+				return "", p.errorf("unterminated string")
+			}
+			value.WriteByte(p.peek())
+			p.pos++
+		default:
+			value.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+// parseInt parses an optional integer, returning nil if there is none.
+func (p *parser) parseInt() (*int, error) {
+	start := p.pos
+	p.consume("-")
+	for !p.done() && p.peek() >= '0' && p.peek() <= '9' {
+		p.pos++
+	}
+	if p.pos == start {
+		return nil, nil
+	}
+	i, err := strconv.Atoi(p.expr[start:p.pos])
+	if err != nil {
+		return nil, p.errorf("invalid integer %q", p.expr[start:p.pos])
+	}
+	return &i, nil
+}
+
+func (p *parser) parseIndexOrSlice() (selector, error) {
+	start, err := p.parseInt()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if !p.consume(":") {
+		if start == nil {
+			return nil, p.errorf("expected an index")
+		}
+		return indexSelector(*start), nil
+	}
+
+	slice := sliceSelector{start: start, step: 1}
+	p.skipSpace()
+	slice.end, err = p.parseInt()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	if p.consume(":") {
+		p.skipSpace()
+		step, err := p.parseInt()
+		if err != nil {
+			return nil, err
+		}
+		if step != nil {
+			slice.step = *step
+		}
+	}
+	if slice.step == 0 {
+		return nil, p.errorf("slice step can not be 0")
+	}
+	return slice, nil
+}
+
+func (p *parser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !p.consume("||") {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = orExpr{left: left, right: right}
+	}
+}
+
+func (p *parser) parseAnd() (filterExpr, error) {
+	left, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpace()
+		if !p.consume("&&") {
+			return left, nil
+		}
+		right, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		left = andExpr{left: left, right: right}
+	}
+}
+
+func (p *parser) parseUnary() (filterExpr, error) {
+	p.skipSpace()
+	switch {
+	case p.peek() == '!' && !strings.HasPrefix(p.expr[p.pos:], "!="):
+		p.pos++
+		expr, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notExpr{expr: expr}, nil
+	case p.consume("("):
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpace()
+		err = p.expect(")")
+		if err != nil {
+			return nil, err
+		}
+		return expr, nil
+	}
+	return p.parseComparison()
+}
+
+// comparisonOperators are ordered so that no operator is matched by the
+// prefix of another.
+var comparisonOperators = []string{"==", "!=", "<=", ">=", "=~", "<", ">"}
+
+func (p *parser) parseComparison() (filterExpr, error) {
+	left, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	p.skipSpace()
+	op := ""
+	for _, candidate := range comparisonOperators {
+		if p.consume(candidate) {
+			op = candidate
+			break
+		}
+	}
+
+	switch op {
+	case "":
+		switch typed := left.(type) {
+		case pathOperand:
+			return existsExpr{path: typed}, nil
+		case literalOperand:
+			if b, ok := typed.value.(bool); ok {
+				return constExpr(b), nil
+			}
+		}
+		return nil, p.errorf("expected a comparison")
+	case "=~":
+		p.skipSpace()
+		if p.peek() != '/' {
+			return nil, p.errorf("expected a /regular expression/")
+		}
+		re, err := p.parseRegex()
+		if err != nil {
+			return nil, err
+		}
+		return regexExpr{value: left, re: re}, nil
+	}
+
+	right, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return compareExpr{op: op, left: left, right: right}, nil
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	p.skipSpace()
+	switch c := p.peek(); {
+	case c == '@' || c == '$':
+		p.pos++
+		segments, err := p.parseSegments()
+		if err != nil {
+			return nil, err
+		}
+		return pathOperand{root: c == '$', segments: segments}, nil
+	case c == '\'' || c == '"':
+		value, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return literalOperand{value: value}, nil
+	case c == '-' || (c >= '0' && c <= '9'):
+		start := p.pos
+		p.pos++
+		for !p.done() && strings.IndexByte("0123456789.eE+-", p.peek()) >= 0 {
+			p.pos++
+		}
+		value, err := strconv.ParseFloat(p.expr[start:p.pos], 64)
+		if err != nil {
+			return nil, p.errorf("invalid number %q", p.expr[start:p.pos])
+		}
+		return literalOperand{value: value}, nil
+	case p.consume("true"):
+		return literalOperand{value: true}, nil
+	case p.consume("false"):
+		return literalOperand{value: false}, nil
+	case p.consume("null"):
+		return literalOperand{value: nil}, nil
+	}
+	return nil, p.errorf("expected a path or literal")
+}
+
+// parseRegex parses /pattern/ optionally followed by i for case
+// insensitive, in which \/ is a literal /.
+func (p *parser) parseRegex() (*regexp.Regexp, error) {
+	p.pos++
+	var pattern strings.Builder
+	for {
+		if p.done() {
+			return nil, p.errorf("unterminated regular expression")
+		}
+		c := p.peek()
+		p.pos++
+		if c == '/' {
+			break
+		}
+		if c == '\\' && p.peek() == '/' {
+			c = '/'
+			p.pos++
+		}
+		pattern.WriteByte(c)
+	}
+	if p.consume("i") {
+		return p.compileRegex("(?i)" + pattern.String())
+	}
+	return p.compileRegex(pattern.String())
+}
+
+func (p *parser) compileRegex(pattern string) (*regexp.Regexp, error) {
+	re, err := regexp.Compile(pattern)
+	if err != nil {
+		return nil, p.errorf("invalid regular expression: %v", err)
+	}
+	return re, nil
+}
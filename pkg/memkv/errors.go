@@ -9,6 +9,7 @@ import (
 var (
 	ErrNotExist   = errors.New("key does not exist")
 	ErrBadPattern = path.ErrBadPattern
+	ErrWrongType  = errors.New("value is the wrong type")
 )
 
 type KeyError struct {
@@ -32,6 +33,10 @@ func IsNotExists(err error) bool {
 	return errors.Is(err, ErrNotExist)
 }
 
+func IsWrongType(err error) bool {
+	return errors.Is(err, ErrWrongType)
+}
+
 func NewKeyError(key string, err error) error {
 	return &KeyError{Key: key, Err: err}
 }
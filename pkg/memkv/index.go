@@ -0,0 +1,58 @@
+package memkv
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// keyIndex holds the keys of a Store sorted so that the keys under a prefix
+// are found by binary search rather than by scanning every key. As a store is
+// usually filled once then read many times, the index is rebuilt by the first
+// lookup after keys are added or removed rather than on each change.
+type keyIndex struct {
+	// mu serializes the rebuild by concurrent readers, writers hold the
+	// store write lock.
+	mu    sync.Mutex
+	keys  []string
+	stale bool
+}
+
+// sortedKeys returns the sorted keys, rebuilding the index if stale. It must
+// be called with the store lock held.
+func (s Store) sortedKeys() []string {
+	s.index.mu.Lock()
+	defer s.index.mu.Unlock()
+	if s.index.stale {
+		keys := make([]string, 0, len(s.kv))
+		for k := range s.kv {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		s.index.keys = keys
+		s.index.stale = false
+	}
+	return s.index.keys
+}
+
+// keysWithPrefix returns the sorted keys starting with prefix.
+func (s Store) keysWithPrefix(prefix string) []string {
+	keys := s.sortedKeys()
+	start := sort.SearchStrings(keys, prefix)
+	end := start + sort.Search(len(keys)-start, func(i int) bool {
+		return !strings.HasPrefix(keys[start+i], prefix)
+	})
+	return keys[start:end]
+}
+
+// matching returns the sorted keys starting with prefix for which match
+// returns true.
+func (s Store) matching(prefix string, match func(string) bool) []string {
+	result := []string{}
+	for _, k := range s.keysWithPrefix(prefix) {
+		if match(k) {
+			result = append(result, k)
+		}
+	}
+	return result
+}
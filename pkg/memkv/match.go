@@ -0,0 +1,105 @@
+package memkv
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// glob is a compiled Match pattern.
+type glob struct {
+	pattern string
+	// elements is the pattern split on /, or nil if the pattern has no **
+	// element and is matched by path.Match.
+	elements []string
+}
+
+func compileGlob(pattern string) (glob, error) {
+	// path.Match reports a malformed pattern even if it does not match
+	if _, err := path.Match(pattern, ""); err != nil {
+		return glob{}, NewKeyError(pattern, ErrBadPattern)
+	}
+	g := glob{pattern: pattern}
+	elements := strings.Split(pattern, "/")
+	for _, element := range elements {
+		if element == "**" {
+			g.elements = elements
+			break
+		}
+	}
+	return g, nil
+}
+
+func (g glob) match(key string) bool {
+	if g.elements == nil {
+		matched, _ := path.Match(g.pattern, key)
+		return matched
+	}
+	return matchElements(g.elements, strings.Split(key, "/"))
+}
+
+func matchElements(patterns, elements []string) bool {
+	for len(patterns) > 0 {
+		if patterns[0] == "**" {
+			for len(patterns) > 0 && patterns[0] == "**" {
+				patterns = patterns[1:]
+			}
+			for i := 0; i <= len(elements); i++ {
+				if matchElements(patterns, elements[i:]) {
+					return true
+				}
+			}
+			return false
+		}
+		if len(elements) == 0 {
+			return false
+		}
+		if matched, _ := path.Match(patterns[0], elements[0]); !matched {
+			return false
+		}
+		patterns, elements = patterns[1:], elements[1:]
+	}
+	return len(elements) == 0
+}
+
+// globPrefix returns the part of pattern before its first special character,
+// which every key it matches starts with. If that character is in a **
+// element, which also matches no elements, the prefix ends before the /
+// preceding it (ie: /app for /app/** which matches /app).
+func globPrefix(pattern string) string {
+	i := strings.IndexAny(pattern, `*?[\`)
+	if i < 0 {
+		return pattern
+	}
+	start := strings.LastIndex(pattern[:i], "/") + 1
+	element, _, _ := strings.Cut(pattern[start:], "/")
+	if element == "**" {
+		return pattern[:max(start-1, 0)]
+	}
+	return pattern[:i]
+}
+
+// Match reports whether key matches the glob pattern as used by gets and
+// getvs. Patterns are those of path.Match (ie: * does not match /) except
+// that a ** element matches any number of elements, including none (ie:
+// /app/**/port matches /app/port and /app/db/main/port).
+func Match(pattern, key string) (bool, error) {
+	g, err := compileGlob(pattern)
+	if err != nil {
+		return false, err
+	}
+	return g.match(key), nil
+}
+
+// CompileRegex compiles expr as used by getsRegex and getvsRegex: it must
+// match the whole key.
+func CompileRegex(expr string) (*regexp.Regexp, error) {
+	// expr is compiled alone first so that unbalanced parentheses can not
+	// escape the anchoring (ie: a)|(.*)
+	_, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, NewKeyError(expr, fmt.Errorf("%w: %w", ErrBadPattern, err))
+	}
+	return regexp.MustCompile("^(?:" + expr + ")$"), nil
+}
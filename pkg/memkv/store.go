@@ -4,21 +4,55 @@ package memkv
 
 import (
 	"fmt"
-	"path"
+	"slices"
 	"sort"
 	"strconv"
 	"strings"
+	"sync"
 )
 
 type Option func(s *Store)
 
+// AccessKind describes how a key was accessed.
+type AccessKind int
+
+const (
+	// AccessKey is a lookup of an exact key (exists, get, getv).
+	AccessKey AccessKind = iota
+	// AccessPattern is a lookup of the keys matching a glob pattern (gets,
+	// getvs).
+	AccessPattern
+	// AccessRegex is a lookup of the keys matching a regular expression
+	// (getsRegex, getvsRegex).
+	AccessRegex
+	// AccessList is a listing of the names under a path (ls, lsdir).
+	AccessList
+	// AccessTree is a lookup of a key and everything under it (getlist,
+	// getmap).
+	AccessTree
+)
+
+// Store is safe for concurrent use. Copies of a Store share its keys.
 type Store struct {
 	FuncMap map[string]interface{}
 	kv      map[string]string
+	// typed holds the native value of each key (see Fill), including the
+	// lists and maps that are not in kv.
+	typed    map[string]interface{}
+	index    *keyIndex
+	mu       *sync.RWMutex
+	watchers map[*watcher]bool
+	record   func(kind AccessKind, key string)
 }
 
 func New(opts ...Option) Store {
-	s := Store{kv: map[string]string{}}
+	s := Store{
+		kv:       map[string]string{},
+		typed:    map[string]interface{}{},
+		index:    &keyIndex{},
+		mu:       &sync.RWMutex{},
+		watchers: map[*watcher]bool{},
+	}
 	for _, opt := range opts {
 		opt(&s)
 	}
@@ -30,20 +64,37 @@ func New(opts ...Option) Store {
 		"gets":   s.GetAll,
 		"getv":   s.GetValue,
 		"getvs":  s.GetAllValues,
+
+		"getsRegex":  s.GetAllRegex,
+		"getvsRegex": s.GetAllValuesRegex,
+
+		"getbool":  s.GetBool,
+		"getfloat": s.GetFloat,
+		"getint":   s.GetInt,
+		"getlist":  s.GetList,
+		"getmap":   s.GetMap,
 	}
 	return s
 }
 
 func (s Store) Del(key string) {
-	delete(s.kv, key)
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.publish(s.delLocked(key, nil))
 }
 
 func (s Store) Exists(key string) bool {
+	s.recordAccess(AccessKey, key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	_, ok := s.kv[key]
 	return ok
 }
 
 func (s Store) Get(key string) (KVPair, error) {
+	s.recordAccess(AccessKey, key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	result := KVPair{Key: key}
 	var ok bool
 	result.Value, ok = s.kv[key]
@@ -53,37 +104,96 @@ func (s Store) Get(key string) (KVPair, error) {
 	return result, nil
 }
 
+// GetAll returns the pairs whose key matches pattern (see Match), sorted by
+// key.
 func (s Store) GetAll(pattern string) (KVPairs, error) {
-	result := KVPairs{}
-	for k, v := range s.kv {
-		matches, err := path.Match(pattern, k)
-		if err != nil {
-			return result, NewKeyError(pattern, ErrBadPattern)
-		}
-		if matches {
-			result = append(result, KVPair{Key: k, Value: v})
-		}
+	s.recordAccess(AccessPattern, pattern)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys, err := s.matchingGlob(pattern)
+	if err != nil {
+		return KVPairs{}, err
 	}
-	sort.Sort(result)
-	return result, nil
+	return s.pairs(keys), nil
 }
 
+// GetAllValues returns the values of the keys matching pattern (see Match),
+// sorted.
 func (s Store) GetAllValues(pattern string) ([]string, error) {
-	result := []string{}
-	for k, v := range s.kv {
-		matches, err := path.Match(pattern, k)
-		if err != nil {
-			return result, NewKeyError(pattern, ErrBadPattern)
-		}
-		if matches {
-			result = append(result, v)
-		}
+	s.recordAccess(AccessPattern, pattern)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys, err := s.matchingGlob(pattern)
+	if err != nil {
+		return []string{}, err
+	}
+	return s.values(keys), nil
+}
+
+// GetAllRegex returns the pairs whose key matches the regular expression expr
+// (see CompileRegex), sorted by key.
+func (s Store) GetAllRegex(expr string) (KVPairs, error) {
+	s.recordAccess(AccessRegex, expr)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys, err := s.matchingRegex(expr)
+	if err != nil {
+		return KVPairs{}, err
+	}
+	return s.pairs(keys), nil
+}
+
+// GetAllValuesRegex returns the values of the keys matching the regular
+// expression expr (see CompileRegex), sorted.
+func (s Store) GetAllValuesRegex(expr string) ([]string, error) {
+	s.recordAccess(AccessRegex, expr)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	keys, err := s.matchingRegex(expr)
+	if err != nil {
+		return []string{}, err
+	}
+	return s.values(keys), nil
+}
+
+func (s Store) matchingGlob(pattern string) ([]string, error) {
+	g, err := compileGlob(pattern)
+	if err != nil {
+		return nil, err
+	}
+	return s.matching(globPrefix(pattern), g.match), nil
+}
+
+func (s Store) matchingRegex(expr string) ([]string, error) {
+	re, err := CompileRegex(expr)
+	if err != nil {
+		return nil, err
+	}
+	prefix, _ := re.LiteralPrefix()
+	return s.matching(prefix, re.MatchString), nil
+}
+
+func (s Store) pairs(keys []string) KVPairs {
+	result := make(KVPairs, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, KVPair{Key: k, Value: s.kv[k]})
+	}
+	return result
+}
+
+func (s Store) values(keys []string) []string {
+	result := make([]string, 0, len(keys))
+	for _, k := range keys {
+		result = append(result, s.kv[k])
 	}
 	sort.Strings(result)
-	return result, nil
+	return result
 }
 
 func (s Store) GetValue(key string, defaultValue ...string) (string, error) {
+	s.recordAccess(AccessKey, key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	v, ok := s.kv[key]
 	if !ok {
 		if len(defaultValue) == 1 {
@@ -98,55 +208,33 @@ func (s Store) GetValue(key string, defaultValue ...string) (string, error) {
 // list implements path listings similar to the way unix ls command works
 // see the template.md for more detail
 func (s Store) list(filePath string, dir bool) []string {
+	s.recordAccess(AccessList, filePath)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	filePath = strings.TrimSuffix(filePath, "/")
 
 	result := []string{}
-	seen := map[string]interface{}{}
-	for k := range s.kv {
-		fullPathMatch := false
-		switch {
-		case filePath == "":
-			// matches all entries
-		case strings.HasPrefix(k, filePath):
-			switch {
-			case len(k) == len(filePath):
-				fullPathMatch = true
-				// exact match
-			case k[len(filePath)] == '/':
-				// has subpath
-			default:
-				// name prefix, but not full name
-				continue
-			}
-		default:
-			continue
-		}
-
-		var p string
-		switch {
-		case fullPathMatch:
-			if dir {
-				continue
-			}
-			p = k[strings.LastIndex(k, "/")+1:]
-		default:
-			p = k[len(filePath)+1:]
-			if lastSlash := strings.Index(p, "/"); lastSlash > 0 {
-				p = p[:lastSlash]
-			} else if dir {
-				continue
-			}
-		}
+	if _, ok := s.kv[filePath]; ok && !dir {
+		result = append(result, filePath[strings.LastIndex(filePath, "/")+1:])
+	}
 
-		if _, ok := seen[p]; !ok {
-			seen[p] = nil
-			result = append(result, p)
+	prefix := filePath + "/"
+	keys := s.keysWithPrefix(prefix)
+	for i := 0; i < len(keys); i++ {
+		p := keys[i][len(prefix):]
+		if slash := strings.Index(p, "/"); slash > 0 {
+			p = p[:slash]
+			// skip the rest of the keys under p, they all sort before
+			// prefix+p+"0" as '0' follows '/'
+			i += sort.SearchStrings(keys[i:], prefix+p+"0") - 1
+		} else if dir {
+			continue
 		}
+		result = append(result, p)
 	}
 
 	sort.Strings(result)
-
-	return result
+	return slices.Compact(result)
 }
 
 func (s Store) List(filePath string) []string {
@@ -158,18 +246,60 @@ func (s Store) ListDir(filePath string) []string {
 }
 
 func (s Store) Purge() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changes := []Change{}
 	for k := range s.kv {
-		delete(s.kv, k)
+		changes = s.delLocked(k, changes)
+	}
+	for k := range s.typed {
+		delete(s.typed, k)
+	}
+	s.publish(changes)
+}
+
+// ReplaceAll replaces all of the keys with those of kv, publishing the
+// differences to the watchers as one update. As with Set, the typed values
+// are the strings.
+func (s Store) ReplaceAll(kv map[string]string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changes := []Change{}
+	for k := range s.kv {
+		if _, ok := kv[k]; !ok {
+			changes = s.delLocked(k, changes)
+		}
+	}
+	for k := range s.typed {
+		delete(s.typed, k)
+	}
+	for k, v := range kv {
+		changes = s.setLocked(k, v, changes)
+		s.typed[k] = v
+	}
+	s.publish(changes)
+}
+
+// recordAccess reports the access to the WithAccessRecorder function, if any.
+func (s Store) recordAccess(kind AccessKind, key string) {
+	if s.record != nil {
+		s.record(kind, key)
 	}
 }
 
 func (s Store) Set(key string, value string) {
-	s.kv[key] = value
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changes := s.setLocked(key, value, nil)
+	s.typed[key] = value
+	s.publish(changes)
 }
 
 // ToKvMap will return a one-level map of key value pairs where the key is
 // a / separated path of subkeys.
 func (s Store) ToKvMap() map[string]string {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
 	result := make(map[string]string, len(s.kv))
 	for k, v := range s.kv {
 		result[k] = v
@@ -219,16 +349,24 @@ func walk(callback func(key []string, value interface{}), node interface{}, keyS
 	}
 }
 
+// WithAccessRecorder calls record for every key, pattern or path looked up in
+// the store.
+func WithAccessRecorder(record func(kind AccessKind, key string)) Option {
+	return func(s *Store) {
+		s.record = record
+	}
+}
+
 func WithKvMap(kv map[string]string) Option {
 	return func(s *Store) {
 		for k, v := range kv {
-			s.kv[k] = v
+			s.Set(k, v)
 		}
 	}
 }
 
 func WithMap(data interface{}) Option {
 	return func(s *Store) {
-		FillKvMap(s.kv, data)
+		s.Fill(data)
 	}
 }
@@ -1,6 +1,7 @@
 package memkv_test
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/pastdev/clconf/v3/pkg/memkv"
@@ -8,6 +9,40 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+func TestAccessRecorder(t *testing.T) {
+	type access struct {
+		kind memkv.AccessKind
+		key  string
+	}
+	accesses := []access{}
+	s := memkv.New(
+		memkv.WithKvMap(map[string]string{"/foo/bar": "hop"}),
+		memkv.WithAccessRecorder(func(kind memkv.AccessKind, key string) {
+			accesses = append(accesses, access{kind: kind, key: key})
+		}))
+
+	s.Exists("/a")
+	_, _ = s.Get("/b")
+	_, _ = s.GetValue("/c", "default")
+	_, _ = s.GetAll("/d/*")
+	_, _ = s.GetAllValues("/e/*")
+	s.List("/f")
+	s.ListDir("/g")
+	_, _ = s.FuncMap["getv"].(func(string, ...string) (string, error))("/foo/bar")
+	assert.Equal(t,
+		[]access{
+			{memkv.AccessKey, "/a"},
+			{memkv.AccessKey, "/b"},
+			{memkv.AccessKey, "/c"},
+			{memkv.AccessPattern, "/d/*"},
+			{memkv.AccessPattern, "/e/*"},
+			{memkv.AccessList, "/f"},
+			{memkv.AccessList, "/g"},
+			{memkv.AccessKey, "/foo/bar"},
+		},
+		accesses)
+}
+
 func TestDel(t *testing.T) {
 	t.Run("simple", func(t *testing.T) {
 		s := memkv.New(memkv.WithKvMap(
@@ -75,6 +110,119 @@ func TestGetAllAndGetAllValues(t *testing.T) {
 			{Key: "/foo/baz", Value: "hop"},
 		},
 		"[]bar")
+
+	tester("recursive",
+		map[string]string{
+			"/foo/bar":         "hip",
+			"/foo/baz/bar":     "hop",
+			"/foo/baz/hip/bar": "hup",
+			"/foo/baz/hip/zip": "zap",
+			"/foobar/bar":      "bip",
+		},
+		"/foo/**/bar",
+		memkv.KVPairs{
+			{Key: "/foo/bar", Value: "hip"},
+			{Key: "/foo/baz/bar", Value: "hop"},
+			{Key: "/foo/baz/hip/bar", Value: "hup"},
+		},
+		"/foo/**/[]bar")
+
+	tester("recursive trailing",
+		map[string]string{
+			"/foo/bar":     "hip",
+			"/foo/baz/bar": "hop",
+			"/foobar/bar":  "bip",
+		},
+		"/foo/**",
+		memkv.KVPairs{
+			{Key: "/foo/bar", Value: "hip"},
+			{Key: "/foo/baz/bar", Value: "hop"},
+		},
+		"/foo/**/[")
+
+	tester("recursive parent",
+		map[string]string{
+			"/app":         "a",
+			"/app/db/port": "b",
+			"/app/port":    "c",
+			"/application": "d",
+		},
+		"/app/**",
+		memkv.KVPairs{
+			{Key: "/app", Value: "a"},
+			{Key: "/app/db/port", Value: "b"},
+			{Key: "/app/port", Value: "c"},
+		},
+		"/app/**/[")
+
+	tester("recursive root",
+		map[string]string{
+			"/port":     "b",
+			"/app/port": "a",
+			"/app/host": "c",
+		},
+		"/**/port",
+		memkv.KVPairs{
+			{Key: "/app/port", Value: "a"},
+			{Key: "/port", Value: "b"},
+		},
+		"/**/[")
+}
+
+func TestGetAllRegexAndGetAllValuesRegex(t *testing.T) {
+	s := memkv.New(memkv.WithKvMap(map[string]string{
+		"/queues/q1":     "a",
+		"/queues/q22":    "b",
+		"/queues/qx":     "c",
+		"/queues/q3/dlq": "d",
+		"/other/q4":      "e",
+	}))
+
+	v, err := s.GetAllRegex("/queues/q[0-9]+")
+	assert.NoError(t, err)
+	assert.Equal(t,
+		memkv.KVPairs{
+			{Key: "/queues/q1", Value: "a"},
+			{Key: "/queues/q22", Value: "b"},
+		},
+		v)
+
+	strVals, err := s.GetAllValuesRegex("/(queues|other)/q[0-9]+(/.*)?")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a", "b", "d", "e"}, strVals)
+
+	strVals, err = s.GetAllValuesRegex("q1")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{}, strVals, "must match whole key")
+
+	strVals, err = s.GetAllValuesRegex("q1)|(.*")
+	assert.True(t, memkv.IsBadPattern(err))
+	assert.Equal(t, []string{}, strVals)
+
+	_, err = s.GetAllRegex("/queues/[")
+	assert.True(t, memkv.IsBadPattern(err))
+}
+
+func TestMatch(t *testing.T) {
+	tester := func(pattern, key string, expected bool) {
+		t.Run(pattern+" "+key, func(t *testing.T) {
+			matched, err := memkv.Match(pattern, key)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, matched)
+		})
+	}
+
+	tester("/foo/*", "/foo/bar", true)
+	tester("/foo/*", "/foo/bar/baz", false)
+	tester("/foo/**", "/foo/bar/baz", true)
+	tester("/foo/**", "/foo", true)
+	tester("/foo/**", "/foobar/baz", false)
+	tester("/**/baz", "/foo/bar/baz", true)
+	tester("/**/baz", "/baz", true)
+	tester("/**/**/baz", "/foo/baz", true)
+	tester("/foo/**/b*", "/foo/bar/baz", true)
+	tester("/foo/**/b*", "/foo/bar/zip", false)
+	tester("/foo/b**", "/foo/bar/baz", false)
 }
 
 func TestGetAndGetValue(t *testing.T) {
@@ -191,6 +339,26 @@ func TestListAndListDir(t *testing.T) {
 		[]string{})
 }
 
+func TestListAfterChanges(t *testing.T) {
+	s := memkv.New(memkv.WithKvMap(map[string]string{
+		"/foo/bar/0": "hop",
+		"/foo/bar/1": "hap",
+		"/foo/baz":   "hip",
+	}))
+	assert.Equal(t, []string{"bar", "baz"}, s.List("/foo"))
+
+	s.Set("/foo/bar-baz", "zip")
+	s.Set("/foo/zap/0", "zop")
+	assert.Equal(t, []string{"bar", "bar-baz", "baz", "zap"}, s.List("/foo"))
+	assert.Equal(t, []string{"bar", "zap"}, s.ListDir("/foo"))
+
+	s.Del("/foo/zap/0")
+	assert.Equal(t, []string{"bar", "bar-baz", "baz"}, s.List("/foo"))
+
+	s.Purge()
+	assert.Equal(t, []string{}, s.List("/foo"))
+}
+
 func TestPurge(t *testing.T) {
 	t.Run("simple", func(t *testing.T) {
 		s := memkv.New(memkv.WithKvMap(
@@ -317,3 +485,77 @@ func TestFromMapToKvMap(t *testing.T) {
 			"/hip/dip/dup": "1",
 		})
 }
+
+func TestTypedGetters(t *testing.T) {
+	unmarshal := func(t *testing.T, unmarshaler func([]byte, interface{}) error, v string) interface{} {
+		var out interface{}
+		err := unmarshaler([]byte(v), &out)
+		if err != nil {
+			t.Fatalf("unable to unmarshal: %v", err)
+		}
+		return out
+	}
+
+	tester := func(name string, data interface{}) {
+		t.Run(name, func(t *testing.T) {
+			s := memkv.New(memkv.WithMap(data))
+
+			i, err := s.GetInt("/app/port")
+			assert.NoError(t, err)
+			assert.Equal(t, 8080, i)
+
+			f, err := s.GetFloat("/app/ratio")
+			assert.NoError(t, err)
+			assert.Equal(t, 0.5, f)
+
+			f, err = s.GetFloat("/app/port")
+			assert.NoError(t, err)
+			assert.Equal(t, 8080.0, f)
+
+			b, err := s.GetBool("/app/debug")
+			assert.NoError(t, err)
+			assert.True(t, b)
+
+			l, err := s.GetList("/app/hosts")
+			assert.NoError(t, err)
+			assert.Equal(t, []interface{}{"a", "b"}, l)
+
+			m, err := s.GetMap("/app/db")
+			assert.NoError(t, err)
+			assert.Equal(t, map[string]interface{}{"user": "admin"}, m)
+
+			v, err := s.GetValue("/app/port")
+			assert.NoError(t, err)
+			assert.Equal(t, "8080", v, "string api unchanged")
+
+			_, err = s.GetInt("/app/ratio")
+			assert.True(t, memkv.IsWrongType(err))
+			_, err = s.GetBool("/app/port")
+			assert.True(t, memkv.IsWrongType(err))
+			_, err = s.GetList("/app/db")
+			assert.True(t, memkv.IsWrongType(err))
+			_, err = s.GetMap("/app/hosts")
+			assert.True(t, memkv.IsWrongType(err))
+
+			_, err = s.GetInt("/app/missing")
+			assert.True(t, memkv.IsNotExists(err))
+			i, err = s.GetInt("/app/missing", 3)
+			assert.NoError(t, err)
+			assert.Equal(t, 3, i)
+			b, err = s.GetBool("/app/missing", true)
+			assert.NoError(t, err)
+			assert.True(t, b)
+		})
+	}
+
+	content := "{\"app\": {\"port\": 8080, \"ratio\": 0.5, \"debug\": true, " +
+		"\"hosts\": [\"a\", \"b\"], \"db\": {\"user\": \"admin\"}}}"
+	tester("yaml", unmarshal(t, yaml.Unmarshal, content))
+	tester("json", unmarshal(t, json.Unmarshal, content))
+
+	t.Run("set is string", func(t *testing.T) {
+		s := memkv.New(memkv.WithKvMap(map[string]string{"/port": "8080"}))
+		_, err := s.GetInt("/port")
+		assert.True(t, memkv.IsWrongType(err))
+	})
+}
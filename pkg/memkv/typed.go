@@ -0,0 +1,173 @@
+package memkv
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// Fill sets every key in data, a tree of maps and lists as unmarshaled from
+// yaml or json. Leaves are set as strings (nil as empty) for the string API,
+// while every key, including those of the lists and maps, keeps its native
+// value for the typed API (ie: GetInt, GetList). The changes are published to
+// the watchers as one update.
+func (s Store) Fill(data interface{}) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	changes := []Change{}
+	walkNodes(func(keyStack []string, value interface{}, leaf bool) {
+		key := "/" + strings.Join(keyStack, "/")
+		s.typed[key] = value
+		if !leaf {
+			return
+		}
+		if value == nil {
+			changes = s.setLocked(key, "", changes)
+		} else {
+			changes = s.setLocked(key, fmt.Sprintf("%v", value), changes)
+		}
+	}, data, []string{})
+	s.publish(changes)
+}
+
+// walkNodes is Walk that also calls callback for the lists and maps.
+func walkNodes(callback func(key []string, value interface{}, leaf bool), node interface{}, keyStack []string) {
+	switch typed := node.(type) {
+	case map[string]interface{}:
+		callback(keyStack, node, false)
+		for k, v := range typed {
+			walkNodes(callback, v, append(keyStack, k))
+		}
+	case map[interface{}]interface{}:
+		callback(keyStack, node, false)
+		for k, v := range typed {
+			walkNodes(callback, v, append(keyStack, fmt.Sprintf("%v", k)))
+		}
+	case []interface{}:
+		callback(keyStack, node, false)
+		for i, v := range typed {
+			walkNodes(callback, v, append(keyStack, strconv.Itoa(i)))
+		}
+	default:
+		callback(keyStack, node, true)
+	}
+}
+
+// getTyped returns the native value of key.
+func (s Store) getTyped(kind AccessKind, key string) (interface{}, bool) {
+	s.recordAccess(kind, key)
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	value, ok := s.typed[key]
+	return value, ok
+}
+
+func typeError(key, expected string, value interface{}) error {
+	return NewKeyError(key, fmt.Errorf("%w: expected %s, found %T", ErrWrongType, expected, value))
+}
+
+// GetBool returns the bool value of key, or the default if supplied and key
+// does not exist.
+func (s Store) GetBool(key string, defaultValue ...bool) (bool, error) {
+	value, ok := s.getTyped(AccessKey, key)
+	if !ok {
+		if len(defaultValue) == 1 {
+			return defaultValue[0], nil
+		}
+		return false, NewKeyError(key, ErrNotExist)
+	}
+	result, ok := value.(bool)
+	if !ok {
+		return false, typeError(key, "bool", value)
+	}
+	return result, nil
+}
+
+// GetFloat returns the number value of key as a float64, or the default if
+// supplied and key does not exist.
+func (s Store) GetFloat(key string, defaultValue ...float64) (float64, error) {
+	value, ok := s.getTyped(AccessKey, key)
+	if !ok {
+		if len(defaultValue) == 1 {
+			return defaultValue[0], nil
+		}
+		return 0, NewKeyError(key, ErrNotExist)
+	}
+	switch typed := value.(type) {
+	case float64:
+		return typed, nil
+	case float32:
+		return float64(typed), nil
+	case int:
+		return float64(typed), nil
+	case int64:
+		return float64(typed), nil
+	case uint64:
+		return float64(typed), nil
+	}
+	return 0, typeError(key, "number", value)
+}
+
+// GetInt returns the integer value of key, or the default if supplied and key
+// does not exist. Floats (ie: numbers unmarshaled from json) are accepted if
+// they are whole.
+func (s Store) GetInt(key string, defaultValue ...int) (int, error) {
+	value, ok := s.getTyped(AccessKey, key)
+	if !ok {
+		if len(defaultValue) == 1 {
+			return defaultValue[0], nil
+		}
+		return 0, NewKeyError(key, ErrNotExist)
+	}
+	switch typed := value.(type) {
+	case int:
+		return typed, nil
+	case int64:
+		if typed >= math.MinInt && typed <= math.MaxInt {
+			return int(typed), nil
+		}
+	case uint64:
+		if typed <= math.MaxInt {
+			return int(typed), nil
+		}
+	case float64:
+		if typed == math.Trunc(typed) && typed >= math.MinInt && typed <= math.MaxInt {
+			return int(typed), nil
+		}
+	}
+	return 0, typeError(key, "int", value)
+}
+
+// GetList returns the list at key.
+func (s Store) GetList(key string) ([]interface{}, error) {
+	value, ok := s.getTyped(AccessTree, key)
+	if !ok {
+		return nil, NewKeyError(key, ErrNotExist)
+	}
+	result, ok := value.([]interface{})
+	if !ok {
+		return nil, typeError(key, "list", value)
+	}
+	return result, nil
+}
+
+// GetMap returns the map at key. The keys are converted to strings (as they
+// are in key paths), values are as is.
+func (s Store) GetMap(key string) (map[string]interface{}, error) {
+	value, ok := s.getTyped(AccessTree, key)
+	if !ok {
+		return nil, NewKeyError(key, ErrNotExist)
+	}
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		return typed, nil
+	case map[interface{}]interface{}:
+		result := make(map[string]interface{}, len(typed))
+		for k, v := range typed {
+			result[fmt.Sprintf("%v", k)] = v
+		}
+		return result, nil
+	}
+	return nil, typeError(key, "map", value)
+}
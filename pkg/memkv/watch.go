@@ -0,0 +1,166 @@
+package memkv
+
+import (
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ChangeKind describes how a key changed.
+type ChangeKind int
+
+const (
+	// ChangeSet is a key added or set to a different value.
+	ChangeSet ChangeKind = iota
+	// ChangeDelete is a key removed.
+	ChangeDelete
+)
+
+// Change is a change to the value of a key sent to the Watch channels.
+type Change struct {
+	Kind ChangeKind
+	Key  string
+	// Old is the value before the change, empty if Added.
+	Old string
+	// New is the value after the change, empty if deleted.
+	New string
+	// Added is true if the key did not exist before the change.
+	Added bool
+}
+
+// watcher queues the changes for a Watch channel so that updating the store
+// never waits for the receiver.
+type watcher struct {
+	prefix string
+	ch     chan []Change
+	notify chan struct{}
+	done   chan struct{}
+	stop   sync.Once
+
+	mu    sync.Mutex
+	queue [][]Change
+}
+
+func (w *watcher) watches(key string) bool {
+	return w.prefix == "" || key == w.prefix || strings.HasPrefix(key, w.prefix+"/")
+}
+
+func (w *watcher) push(changes []Change) {
+	w.mu.Lock()
+	w.queue = append(w.queue, changes)
+	w.mu.Unlock()
+	select {
+	case w.notify <- struct{}{}:
+	default:
+	}
+}
+
+func (w *watcher) pop() ([]Change, bool) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if len(w.queue) == 0 {
+		return nil, false
+	}
+	changes := w.queue[0]
+	w.queue = w.queue[1:]
+	return changes, true
+}
+
+func (w *watcher) run() {
+	defer close(w.ch)
+	for {
+		select {
+		case <-w.done:
+			return
+		case <-w.notify:
+		}
+		for changes, ok := w.pop(); ok; changes, ok = w.pop() {
+			select {
+			case w.ch <- changes:
+			case <-w.done:
+				return
+			}
+		}
+	}
+}
+
+// Watch returns a channel receiving the changes to the keys under prefix (or
+// prefix itself), and a function to stop watching which closes the channel.
+// Each receive is the changes made by one update (ie: a Set or a ReplaceAll)
+// sorted by key, and updates are received in the order they were made. The
+// changes are queued until received so a slow receiver does not block
+// updates.
+func (s Store) Watch(prefix string) (<-chan []Change, func()) {
+	w := &watcher{
+		prefix: strings.TrimSuffix(prefix, "/"),
+		ch:     make(chan []Change),
+		notify: make(chan struct{}, 1),
+		done:   make(chan struct{}),
+	}
+	s.mu.Lock()
+	s.watchers[w] = true
+	s.mu.Unlock()
+	go w.run()
+
+	return w.ch, func() {
+		w.stop.Do(func() {
+			s.mu.Lock()
+			delete(s.watchers, w)
+			s.mu.Unlock()
+			close(w.done)
+		})
+	}
+}
+
+// publish sends changes to the watchers. It must be called with the write
+// lock held so that watchers receive updates in the order they were made.
+func (s Store) publish(changes []Change) {
+	if len(changes) == 0 || len(s.watchers) == 0 {
+		return
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Key < changes[j].Key })
+	for w := range s.watchers {
+		watched := []Change{}
+		for _, change := range changes {
+			if w.watches(change.Key) {
+				watched = append(watched, change)
+			}
+		}
+		if len(watched) > 0 {
+			w.push(watched)
+		}
+	}
+}
+
+// setLocked sets key to value, returning changes with the change, if any,
+// appended. It must be called with the write lock held.
+func (s Store) setLocked(key, value string, changes []Change) []Change {
+	old, ok := s.kv[key]
+	if ok && old == value {
+		return changes
+	}
+	if !ok {
+		s.index.stale = true
+	}
+	s.kv[key] = value
+	if len(s.watchers) == 0 {
+		return changes
+	}
+	return append(changes, Change{Kind: ChangeSet, Key: key, Old: old, New: value, Added: !ok})
+}
+
+// delLocked deletes key, returning changes with the change, if any,
+// appended. It must be called with the write lock held.
+func (s Store) delLocked(key string, changes []Change) []Change {
+	delete(s.typed, key)
+	old, ok := s.kv[key]
+	if !ok {
+		return changes
+	}
+	s.index.stale = true
+	delete(s.kv, key)
+	if len(s.watchers) == 0 {
+		return changes
+	}
+	return append(changes, Change{Kind: ChangeDelete, Key: key, Old: old})
+}
@@ -0,0 +1,129 @@
+package memkv_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/pastdev/clconf/v3/pkg/memkv"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func receive(t *testing.T, changes <-chan []memkv.Change) []memkv.Change {
+	t.Helper()
+	select {
+	case received := <-changes:
+		return received
+	case <-time.After(5 * time.Second):
+		require.FailNow(t, "no changes received")
+		return nil
+	}
+}
+
+func TestWatch(t *testing.T) {
+	s := memkv.New(memkv.WithKvMap(map[string]string{
+		"/app/a":   "1",
+		"/app/b":   "2",
+		"/other/c": "3",
+	}))
+	changes, stop := s.Watch("/app")
+	all, stopAll := s.Watch("/")
+	defer stopAll()
+
+	s.Set("/app/a", "1")
+	s.Set("/app/a", "10")
+	s.Set("/other/c", "30")
+	s.Del("/app/b")
+	s.Del("/app/missing")
+	s.ReplaceAll(map[string]string{
+		"/app/a":   "10",
+		"/app/d":   "4",
+		"/apple/e": "5",
+	})
+
+	assert.Equal(t,
+		[]memkv.Change{{Kind: memkv.ChangeSet, Key: "/app/a", Old: "1", New: "10"}},
+		receive(t, changes))
+	assert.Equal(t,
+		[]memkv.Change{{Kind: memkv.ChangeDelete, Key: "/app/b", Old: "2"}},
+		receive(t, changes))
+	assert.Equal(t,
+		[]memkv.Change{{Kind: memkv.ChangeSet, Key: "/app/d", New: "4", Added: true}},
+		receive(t, changes),
+		"replace all as one update")
+
+	assert.Len(t, receive(t, all), 1)
+	assert.Equal(t,
+		[]memkv.Change{{Kind: memkv.ChangeSet, Key: "/other/c", Old: "3", New: "30"}},
+		receive(t, all))
+	assert.Len(t, receive(t, all), 1)
+	assert.Equal(t,
+		[]memkv.Change{
+			{Kind: memkv.ChangeSet, Key: "/app/d", New: "4", Added: true},
+			{Kind: memkv.ChangeSet, Key: "/apple/e", New: "5", Added: true},
+			{Kind: memkv.ChangeDelete, Key: "/other/c", Old: "30"},
+		},
+		receive(t, all))
+
+	stop()
+	stop()
+	s.Set("/app/a", "11")
+	_, ok := <-changes
+	assert.False(t, ok, "closed by stop")
+	assert.Equal(t,
+		[]memkv.Change{{Kind: memkv.ChangeSet, Key: "/app/a", Old: "10", New: "11"}},
+		receive(t, all))
+}
+
+func TestWatchFill(t *testing.T) {
+	s := memkv.New(memkv.WithKvMap(map[string]string{"/app/a": "1"}))
+	changes, stop := s.Watch("/app")
+	defer stop()
+
+	s.Fill(map[string]interface{}{
+		"app": map[string]interface{}{"a": 1, "b": true},
+	})
+	assert.Equal(t,
+		[]memkv.Change{{Kind: memkv.ChangeSet, Key: "/app/b", New: "true", Added: true}},
+		receive(t, changes))
+
+	s.Purge()
+	assert.Equal(t,
+		[]memkv.Change{
+			{Kind: memkv.ChangeDelete, Key: "/app/a", Old: "1"},
+			{Kind: memkv.ChangeDelete, Key: "/app/b", Old: "true"},
+		},
+		receive(t, changes))
+}
+
+func TestConcurrentAccess(t *testing.T) {
+	s := memkv.New()
+	changes, stop := s.Watch("/")
+	defer stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				s.Set(fmt.Sprintf("/w%d/%d", i, j), "v")
+			}
+		}(i)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				_, _ = s.GetAll("/*/*")
+				s.ListDir("/")
+			}
+		}()
+	}
+	wg.Wait()
+
+	assert.Len(t, s.ToKvMap(), 400)
+	for i := 0; i < 400; i++ {
+		assert.Len(t, receive(t, changes), 1)
+	}
+}
@@ -0,0 +1,329 @@
+package secret
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// MetadataKey is the top level key holding the metadata of a config that was
+// encrypted as a whole by EncryptTree.
+const MetadataKey = "clconf"
+
+const (
+	metadataVersion  = 1
+	macPath          = "/" + MetadataKey + "/mac"
+	dataKeyBytes     = 32
+	encryptedPattern = `^ENC\[AES256_GCM,data:([A-Za-z0-9+/=]*),iv:([A-Za-z0-9+/=]+),type:([a-z]+)\]$`
+)
+
+var encryptedValue = regexp.MustCompile(encryptedPattern)
+
+// ErrMACMismatch is returned by DecryptTree when the values in the config do
+// not match the MAC recorded when it was encrypted.
+var ErrMACMismatch = errors.New("mac mismatch, config has been modified since it was encrypted")
+
+// IsEncryptedTree returns true if config was encrypted by EncryptTree.
+func IsEncryptedTree(config interface{}) bool {
+	_, ok := metadata(config)
+	return ok
+}
+
+// EncryptTree will encrypt every leaf value of config, in place, using a
+// random data key and AES-256-GCM with the path of the value bound as
+// associated data. The data key is encrypted to the recipients of the agent
+// and stored, along with a MAC of all the values, under MetadataKey.
+func (secretAgent *SecretAgent) EncryptTree(config interface{}) error {
+	root, ok := config.(map[interface{}]interface{})
+	if !ok {
+		return fmt.Errorf("config not a map")
+	}
+	if _, ok := root[MetadataKey]; ok {
+		return fmt.Errorf("config already contains %s metadata", MetadataKey)
+	}
+
+	dataKey := make([]byte, dataKeyBytes)
+	if _, err := rand.Read(dataKey); err != nil {
+		return fmt.Errorf("generate data key: %w", err)
+	}
+	encryptedDataKey, err := secretAgent.Encrypt(base64.StdEncoding.EncodeToString(dataKey))
+	if err != nil {
+		return fmt.Errorf("encrypt data key: %w", err)
+	}
+
+	mac := hmac.New(sha256.New, dataKey)
+	err = transformLeaves(root, "", func(valuePath string, value interface{}) (interface{}, error) {
+		valueType, plaintext, err := formatLeaf(value)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", valuePath, err)
+		}
+		writeMAC(mac, valuePath, valueType, plaintext)
+		return encryptLeaf(dataKey, valuePath, valueType, plaintext)
+	})
+	if err != nil {
+		return err
+	}
+
+	encryptedMAC, err := encryptLeaf(dataKey, macPath, "str",
+		base64.StdEncoding.EncodeToString(mac.Sum(nil)))
+	if err != nil {
+		return fmt.Errorf("encrypt mac: %w", err)
+	}
+
+	root[MetadataKey] = map[interface{}]interface{}{
+		"version":  metadataVersion,
+		"data_key": encryptedDataKey,
+		"mac":      encryptedMAC,
+	}
+	return nil
+}
+
+// DecryptTree will verify and decrypt, in place, a config encrypted by
+// EncryptTree, removing the metadata. ErrMACMismatch is returned if values
+// were added, removed or replaced since encryption.
+func (secretAgent *SecretAgent) DecryptTree(config interface{}) error {
+	meta, ok := metadata(config)
+	if !ok {
+		return fmt.Errorf("config does not contain %s metadata", MetadataKey)
+	}
+	if version, _ := meta["version"].(int); version != metadataVersion {
+		return fmt.Errorf("unsupported %s metadata version: %v", MetadataKey, meta["version"])
+	}
+	encryptedDataKey, _ := meta["data_key"].(string)
+	encryptedMAC, _ := meta["mac"].(string)
+
+	decryptedDataKey, err := secretAgent.Decrypt(encryptedDataKey)
+	if err != nil {
+		return fmt.Errorf("decrypt data key: %w", err)
+	}
+	dataKey, err := base64.StdEncoding.DecodeString(decryptedDataKey)
+	if err != nil {
+		return fmt.Errorf("decode data key: %w", err)
+	}
+	_, expectedMAC, err := decryptLeaf(dataKey, macPath, encryptedMAC)
+	if err != nil {
+		return fmt.Errorf("decrypt mac: %w", err)
+	}
+
+	root := config.(map[interface{}]interface{})
+	delete(root, MetadataKey)
+
+	mac := hmac.New(sha256.New, dataKey)
+	err = transformLeaves(root, "", func(valuePath string, value interface{}) (interface{}, error) {
+		encrypted, ok := value.(string)
+		if !ok {
+			return nil, fmt.Errorf("%s: value not encrypted", valuePath)
+		}
+		valueType, plaintext, err := decryptLeaf(dataKey, valuePath, encrypted)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", valuePath, err)
+		}
+		writeMAC(mac, valuePath, valueType, plaintext)
+		return parseLeaf(valueType, plaintext)
+	})
+	if err != nil {
+		return err
+	}
+
+	if !hmac.Equal([]byte(base64.StdEncoding.EncodeToString(mac.Sum(nil))), []byte(expectedMAC)) {
+		return ErrMACMismatch
+	}
+	return nil
+}
+
+func metadata(config interface{}) (map[interface{}]interface{}, bool) {
+	root, ok := config.(map[interface{}]interface{})
+	if !ok {
+		return nil, false
+	}
+	meta, ok := root[MetadataKey].(map[interface{}]interface{})
+	if !ok {
+		return nil, false
+	}
+	if _, ok := meta["mac"]; !ok {
+		return nil, false
+	}
+	return meta, true
+}
+
+// transformLeaves replaces every leaf (non map, non list) value in node with
+// the result of transform. Maps are traversed in key order so that transform
+// is called in a deterministic order.
+func transformLeaves(
+	node interface{},
+	nodePath string,
+	transform func(valuePath string, value interface{}) (interface{}, error),
+) error {
+	visit := func(value interface{}, valuePath string) (interface{}, error) {
+		switch value.(type) {
+		case map[interface{}]interface{}, map[string]interface{}, []interface{}:
+			return value, transformLeaves(value, valuePath, transform)
+		default:
+			return transform(valuePath, value)
+		}
+	}
+
+	switch typed := node.(type) {
+	case map[interface{}]interface{}:
+		keys := make([]interface{}, 0, len(typed))
+		for k := range typed {
+			keys = append(keys, k)
+		}
+		sort.Slice(keys, func(i, j int) bool {
+			return fmt.Sprintf("%v", keys[i]) < fmt.Sprintf("%v", keys[j])
+		})
+		for _, k := range keys {
+			value, err := visit(typed[k], fmt.Sprintf("%s/%v", nodePath, k))
+			if err != nil {
+				return err
+			}
+			typed[k] = value
+		}
+	case map[string]interface{}:
+		keys := make([]string, 0, len(typed))
+		for k := range typed {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			value, err := visit(typed[k], nodePath+"/"+k)
+			if err != nil {
+				return err
+			}
+			typed[k] = value
+		}
+	case []interface{}:
+		for i, v := range typed {
+			value, err := visit(v, nodePath+"/"+strconv.Itoa(i))
+			if err != nil {
+				return err
+			}
+			typed[i] = value
+		}
+	}
+	return nil
+}
+
+func encryptLeaf(dataKey []byte, valuePath, valueType, plaintext string) (string, error) {
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return "", err
+	}
+	iv := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(iv); err != nil {
+		return "", fmt.Errorf("generate iv: %w", err)
+	}
+	data := gcm.Seal(nil, iv, []byte(plaintext), additionalData(valuePath, valueType))
+	return fmt.Sprintf("ENC[AES256_GCM,data:%s,iv:%s,type:%s]",
+		base64.StdEncoding.EncodeToString(data),
+		base64.StdEncoding.EncodeToString(iv),
+		valueType), nil
+}
+
+func decryptLeaf(dataKey []byte, valuePath, encrypted string) (string, string, error) {
+	match := encryptedValue.FindStringSubmatch(encrypted)
+	if match == nil {
+		return "", "", errors.New("value not encrypted")
+	}
+	data, err := base64.StdEncoding.DecodeString(match[1])
+	if err != nil {
+		return "", "", fmt.Errorf("decode data: %w", err)
+	}
+	iv, err := base64.StdEncoding.DecodeString(match[2])
+	if err != nil {
+		return "", "", fmt.Errorf("decode iv: %w", err)
+	}
+	valueType := match[3]
+
+	gcm, err := newGCM(dataKey)
+	if err != nil {
+		return "", "", err
+	}
+	if len(iv) != gcm.NonceSize() {
+		return "", "", errors.New("invalid iv")
+	}
+	plaintext, err := gcm.Open(nil, iv, data, additionalData(valuePath, valueType))
+	if err != nil {
+		return "", "", fmt.Errorf("decrypt (value moved or modified?): %w", err)
+	}
+	return valueType, string(plaintext), nil
+}
+
+func additionalData(valuePath, valueType string) []byte {
+	return []byte(valuePath + "\x00" + valueType)
+}
+
+func newGCM(dataKey []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(dataKey)
+	if err != nil {
+		return nil, fmt.Errorf("new cipher: %w", err)
+	}
+	gcm, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, fmt.Errorf("new gcm: %w", err)
+	}
+	return gcm, nil
+}
+
+func formatLeaf(value interface{}) (string, string, error) {
+	switch typed := value.(type) {
+	case nil:
+		return "null", "", nil
+	case string:
+		return "str", typed, nil
+	case bool:
+		return "bool", strconv.FormatBool(typed), nil
+	case int, int8, int16, int32, int64, uint, uint8, uint16, uint32, uint64:
+		return "int", fmt.Sprintf("%d", typed), nil
+	case float32:
+		return "float", strconv.FormatFloat(float64(typed), 'g', -1, 32), nil
+	case float64:
+		return "float", strconv.FormatFloat(typed, 'g', -1, 64), nil
+	default:
+		return "", "", fmt.Errorf("unsupported value type %T", value)
+	}
+}
+
+func parseLeaf(valueType, plaintext string) (interface{}, error) {
+	var value interface{}
+	var err error
+	switch valueType {
+	case "null":
+		return nil, nil
+	case "str":
+		return plaintext, nil
+	case "bool":
+		value, err = strconv.ParseBool(plaintext)
+	case "int":
+		if i, atoiErr := strconv.Atoi(plaintext); atoiErr == nil {
+			return i, nil
+		}
+		if strings.HasPrefix(plaintext, "-") {
+			value, err = strconv.ParseInt(plaintext, 10, 64)
+		} else {
+			value, err = strconv.ParseUint(plaintext, 10, 64)
+		}
+	case "float":
+		value, err = strconv.ParseFloat(plaintext, 64)
+	default:
+		return nil, fmt.Errorf("unsupported value type %s", valueType)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("parse %s: %w", valueType, err)
+	}
+	return value, nil
+}
+
+func writeMAC(mac io.Writer, valuePath, valueType, plaintext string) {
+	_, _ = fmt.Fprintf(mac, "%s\x00%s\x00%d:%s\n", valuePath, valueType, len(plaintext), plaintext)
+}
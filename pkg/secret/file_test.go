@@ -0,0 +1,77 @@
+package secret
+
+import (
+	"testing"
+
+	"github.com/pastdev/clconf/v3/pkg/yamljson"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const fileTestYaml = `
+db:
+  username: admin
+  password: secret
+  port: 5432
+  ratio: 0.5
+  enabled: true
+  empty: ~
+hosts:
+- one
+- two
+`
+
+func newEncryptedTree(t *testing.T, secretAgent *SecretAgent) interface{} {
+	config, err := yamljson.UnmarshalSingleYaml(fileTestYaml)
+	require.NoError(t, err)
+	require.False(t, IsEncryptedTree(config))
+	require.NoError(t, secretAgent.EncryptTree(config))
+	require.True(t, IsEncryptedTree(config))
+	return config
+}
+
+func TestEncryptDecryptTree(t *testing.T) {
+	secretAgent, err := NewTestSecretAgent()
+	require.NoError(t, err)
+
+	config := newEncryptedTree(t, secretAgent)
+	db := config.(map[interface{}]interface{})["db"].(map[interface{}]interface{})
+	assert.Regexp(t, encryptedValue, db["password"])
+	assert.Regexp(t, encryptedValue, db["port"])
+
+	require.NoError(t, secretAgent.DecryptTree(config))
+	expected, err := yamljson.UnmarshalSingleYaml(fileTestYaml)
+	require.NoError(t, err)
+	assert.Equal(t, expected, config)
+
+	assert.Error(t, secretAgent.EncryptTree(newEncryptedTree(t, secretAgent)))
+	assert.Error(t, secretAgent.DecryptTree(config))
+}
+
+func TestDecryptTreeTampered(t *testing.T) {
+	secretAgent, err := NewTestSecretAgent()
+	require.NoError(t, err)
+
+	// swapped values fail authentication
+	config := newEncryptedTree(t, secretAgent)
+	db := config.(map[interface{}]interface{})["db"].(map[interface{}]interface{})
+	db["username"], db["password"] = db["password"], db["username"]
+	assert.Error(t, secretAgent.DecryptTree(config))
+
+	// removed values fail the mac
+	config = newEncryptedTree(t, secretAgent)
+	delete(config.(map[interface{}]interface{})["db"].(map[interface{}]interface{}), "empty")
+	assert.ErrorIs(t, secretAgent.DecryptTree(config), ErrMACMismatch)
+
+	// plain values are rejected
+	config = newEncryptedTree(t, secretAgent)
+	config.(map[interface{}]interface{})["added"] = "plain"
+	assert.Error(t, secretAgent.DecryptTree(config))
+
+	// encrypt only agents cannot decrypt
+	encryptOnly, err := NewTestEncryptOnlySecretAgent()
+	require.NoError(t, err)
+	config = newEncryptedTree(t, encryptOnly)
+	assert.ErrorIs(t, encryptOnly.DecryptTree(config), ErrEncryptOnly)
+	assert.NoError(t, secretAgent.DecryptTree(config))
+}
@@ -0,0 +1,142 @@
+package secret
+
+import (
+	"bytes"
+	"crypto"
+	// registers sha256 for use as the preferred hash of generated keys
+	_ "crypto/sha256"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"golang.org/x/crypto/openpgp"        //nolint:staticcheck // secconf is built on this package
+	"golang.org/x/crypto/openpgp/armor"  //nolint:staticcheck // secconf is built on this package
+	"golang.org/x/crypto/openpgp/packet" //nolint:staticcheck // secconf is built on this package
+)
+
+// DefaultKeyBits is the RSA key size used by GenerateKeyring when none is
+// specified.
+const DefaultKeyBits = 2048
+
+// KeyInfo describes a single key (primary or subkey) found in a keyring.
+type KeyInfo struct {
+	// KeyID is the 16 character hex encoded key id
+	KeyID string
+	// Fingerprint is the 40 character hex encoded fingerprint
+	Fingerprint string
+	// Created is the creation time of the key
+	Created time.Time
+	// Identities are the user ids associated with the key (empty for subkeys)
+	Identities []string
+	// Secret is true if the private portion of the key is present
+	Secret bool
+	// Subkey is true if this key is a subkey of the previous primary key
+	Subkey bool
+}
+
+// GenerateKeyring will return a new armored gpg secret keyring containing a
+// single RSA key (with an encryption subkey) for the supplied identity. Any
+// of name, comment and email may be empty, but they must not contain any of
+// "()<>\x00". If bits is 0, DefaultKeyBits is used.
+func GenerateKeyring(name, comment, email string, bits int) ([]byte, error) {
+	if bits == 0 {
+		bits = DefaultKeyBits
+	}
+	// explicit hash and cipher preferences are required, otherwise openpgp
+	// falls back to RIPEMD160 which is not compiled in when encrypting
+	config := &packet.Config{
+		DefaultCipher: packet.CipherAES256,
+		DefaultHash:   crypto.SHA256,
+		RSABits:       bits,
+	}
+	entity, err := openpgp.NewEntity(name, comment, email, config)
+	if err != nil {
+		return nil, fmt.Errorf("new entity: %w", err)
+	}
+
+	return armorKeyring(openpgp.PrivateKeyType, func(w io.Writer) error {
+		return entity.SerializePrivate(w, config)
+	})
+}
+
+// KeyInfo returns a description of every key held by the agent.
+func (secretAgent *SecretAgent) KeyInfo() ([]KeyInfo, error) {
+	entities, err := secretAgent.entities()
+	if err != nil {
+		return nil, err
+	}
+
+	infos := []KeyInfo{}
+	for _, entity := range entities {
+		identities := make([]string, 0, len(entity.Identities))
+		for name := range entity.Identities {
+			identities = append(identities, name)
+		}
+		sort.Strings(identities)
+
+		infos = append(infos, newKeyInfo(entity.PrimaryKey, entity.PrivateKey, identities))
+		for _, subkey := range entity.Subkeys {
+			info := newKeyInfo(subkey.PublicKey, subkey.PrivateKey, []string{})
+			info.Subkey = true
+			infos = append(infos, info)
+		}
+	}
+	return infos, nil
+}
+
+// PublicKeyring returns an armored keyring containing only the public
+// portion of the keys held by the agent. The result can be used to create
+// an agent that is able to encrypt, but not decrypt.
+func (secretAgent *SecretAgent) PublicKeyring() ([]byte, error) {
+	entities, err := secretAgent.entities()
+	if err != nil {
+		return nil, err
+	}
+
+	return armorKeyring(openpgp.PublicKeyType, func(w io.Writer) error {
+		for _, entity := range entities {
+			err := entity.Serialize(w)
+			if err != nil {
+				return fmt.Errorf("serialize %X: %w", entity.PrimaryKey.Fingerprint, err)
+			}
+		}
+		return nil
+	})
+}
+
+func (secretAgent *SecretAgent) entities() (openpgp.EntityList, error) {
+	if secretAgent.key == nil {
+		return nil, errors.New("SecretAgent missing key")
+	}
+	return readKeyrings(secretAgent.key)
+}
+
+func armorKeyring(blockType string, serialize func(io.Writer) error) ([]byte, error) {
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, blockType, nil)
+	if err != nil {
+		return nil, fmt.Errorf("armor: %w", err)
+	}
+	err = serialize(w)
+	if err != nil {
+		return nil, fmt.Errorf("serialize: %w", err)
+	}
+	err = w.Close()
+	if err != nil {
+		return nil, fmt.Errorf("close armor: %w", err)
+	}
+	buf.WriteString("\n")
+	return buf.Bytes(), nil
+}
+
+func newKeyInfo(public *packet.PublicKey, private *packet.PrivateKey, identities []string) KeyInfo {
+	return KeyInfo{
+		KeyID:       public.KeyIdString(),
+		Fingerprint: fmt.Sprintf("%X", public.Fingerprint),
+		Created:     public.CreationTime,
+		Identities:  identities,
+		Secret:      private != nil,
+	}
+}
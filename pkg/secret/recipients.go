@@ -0,0 +1,294 @@
+package secret
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/crypto/openpgp"        //nolint:staticcheck // secconf is built on this package
+	"golang.org/x/crypto/openpgp/armor"  //nolint:staticcheck // secconf is built on this package
+	"golang.org/x/crypto/openpgp/packet" //nolint:staticcheck // secconf is built on this package
+)
+
+// RecipientsFile is the name of the file, found in the same folder as a
+// config file, that contains the armored public keys of the additional
+// recipients that values in that config should be encrypted to.
+const RecipientsFile = ".clconf-recipients"
+
+const armorBegin = "-----BEGIN PGP "
+
+// AddRecipients returns a copy of the agent that will also encrypt to the
+// keys found in the supplied armored keyrings. Each keyring may contain
+// multiple concatenated armored blocks.
+func (secretAgent *SecretAgent) AddRecipients(keyrings ...[]byte) *SecretAgent {
+	agent := *secretAgent
+	agent.recipients = append(append([][]byte{}, secretAgent.recipients...), keyrings...)
+	return &agent
+}
+
+// AddRecipientsFromFiles is AddRecipients using the contents of files.
+func (secretAgent *SecretAgent) AddRecipientsFromFiles(files ...string) (*SecretAgent, error) {
+	keyrings := make([][]byte, len(files))
+	for i, file := range files {
+		keyring, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("read recipient: %w", err)
+		}
+		keyrings[i] = keyring
+	}
+	return secretAgent.AddRecipients(keyrings...), nil
+}
+
+// AddRecipientsForConfig adds the recipients found in the RecipientsFile in
+// the same folder as configFile, if one exists.
+func (secretAgent *SecretAgent) AddRecipientsForConfig(configFile string) (*SecretAgent, error) {
+	recipientsFile := filepath.Join(filepath.Dir(configFile), RecipientsFile)
+	if _, err := os.Stat(recipientsFile); os.IsNotExist(err) {
+		return secretAgent, nil
+	}
+	return secretAgent.AddRecipientsFromFiles(recipientsFile)
+}
+
+// RemoveRecipients returns a copy of the agent that will not encrypt to any
+// key matching one of ids. An id is a hex encoded fingerprint, long key id
+// or short key id of either the primary key or a subkey. Primary key ids
+// only match encrypted values (which reference the encryption subkey) if the
+// public key of the recipient is also known to the agent.
+func (secretAgent *SecretAgent) RemoveRecipients(ids ...string) *SecretAgent {
+	agent := *secretAgent
+	agent.removed = append(append([]string{}, secretAgent.removed...), ids...)
+	return &agent
+}
+
+// Recipients returns the hex encoded key ids that encrypted was encrypted to.
+func Recipients(encrypted string) ([]string, error) {
+	keyIDs, err := recipientKeyIDs(encrypted)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, len(keyIDs))
+	for i, keyID := range keyIDs {
+		ids[i] = keyIDString(keyID)
+	}
+	return ids, nil
+}
+
+// IsEncrypted returns true if value looks like a value encrypted by a
+// SecretAgent.
+func IsEncrypted(value string) bool {
+	keyIDs, err := recipientKeyIDs(value)
+	return err == nil && len(keyIDs) > 0
+}
+
+// Rotate decrypts encrypted and re-encrypts it to the current recipients of
+// the agent. An error is returned if encrypted has a recipient that is not
+// known to the agent and has not been explicitly removed so that a rotation
+// never silently drops access.
+func (secretAgent *SecretAgent) Rotate(encrypted string) (string, error) {
+	keyIDs, err := recipientKeyIDs(encrypted)
+	if err != nil {
+		return "", err
+	}
+	entities, err := secretAgent.recipientEntities()
+	if err != nil {
+		return "", err
+	}
+	known, err := readKeyrings(append([][]byte{secretAgent.key}, secretAgent.recipients...)...)
+	if err != nil {
+		return "", err
+	}
+
+	for _, keyID := range keyIDs {
+		if secretAgent.isRemoved(keyID, known) {
+			continue
+		}
+		if len(entities.KeysById(keyID)) == 0 {
+			return "", fmt.Errorf(
+				"encrypted to unknown recipient %s (add it as a recipient or remove it)",
+				keyIDString(keyID))
+		}
+	}
+
+	decrypted, err := secretAgent.Decrypt(encrypted)
+	if err != nil {
+		return "", err
+	}
+	return secretAgent.Encrypt(decrypted)
+}
+
+// RotateAll will Rotate every encrypted string in config, in place,
+// returning the paths of all values that were rotated.
+func (secretAgent *SecretAgent) RotateAll(config interface{}) ([]string, error) {
+	rotated := []string{}
+	err := transformLeaves(config, "", func(valuePath string, value interface{}) (interface{}, error) {
+		stringValue, ok := value.(string)
+		if !ok || !IsEncrypted(stringValue) {
+			return value, nil
+		}
+		encrypted, err := secretAgent.Rotate(stringValue)
+		if err != nil {
+			return nil, fmt.Errorf("rotate %s: %w", valuePath, err)
+		}
+		rotated = append(rotated, valuePath)
+		return encrypted, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return rotated, nil
+}
+
+func (secretAgent *SecretAgent) isRemoved(keyID uint64, known openpgp.EntityList) bool {
+	for _, id := range secretAgent.removed {
+		if idMatches(id, keyIDString(keyID)) {
+			return true
+		}
+		for _, key := range known.KeysById(keyID) {
+			if entityMatches(key.Entity, id) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// recipientEntities returns the entities that encryption should target: the
+// agents own key plus any added recipients, less any removed recipients.
+func (secretAgent *SecretAgent) recipientEntities() (openpgp.EntityList, error) {
+	if secretAgent.key == nil {
+		return nil, errors.New("SecretAgent missing key")
+	}
+	all, err := readKeyrings(append([][]byte{secretAgent.key}, secretAgent.recipients...)...)
+	if err != nil {
+		return nil, err
+	}
+
+	entities := openpgp.EntityList{}
+	seen := map[uint64]bool{}
+	for _, entity := range all {
+		if seen[entity.PrimaryKey.KeyId] {
+			continue
+		}
+		seen[entity.PrimaryKey.KeyId] = true
+
+		removed := false
+		for _, id := range secretAgent.removed {
+			if entityMatches(entity, id) {
+				removed = true
+				break
+			}
+		}
+		if !removed {
+			entities = append(entities, entity)
+		}
+	}
+	if len(entities) == 0 {
+		return nil, errors.New("no recipients remain to encrypt to")
+	}
+	return entities, nil
+}
+
+// encode is equivalent to secconf.Encode, base64(gpg(gzip(data))), but
+// encrypts to an arbitrary list of entities.
+func encode(data []byte, entities openpgp.EntityList) ([]byte, error) {
+	buffer := new(bytes.Buffer)
+	encoder := base64.NewEncoder(base64.StdEncoding, buffer)
+	pgpWriter, err := openpgp.Encrypt(encoder, entities, nil, nil, nil)
+	if err != nil {
+		return nil, fmt.Errorf("encrypt: %w", err)
+	}
+	gzWriter := gzip.NewWriter(pgpWriter)
+	if _, err := gzWriter.Write(data); err != nil {
+		return nil, fmt.Errorf("gzip: %w", err)
+	}
+	if err := gzWriter.Close(); err != nil {
+		return nil, fmt.Errorf("close gzip: %w", err)
+	}
+	if err := pgpWriter.Close(); err != nil {
+		return nil, fmt.Errorf("close encrypt: %w", err)
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, fmt.Errorf("close base64: %w", err)
+	}
+	return buffer.Bytes(), nil
+}
+
+func entityMatches(entity *openpgp.Entity, id string) bool {
+	if idMatches(id, fmt.Sprintf("%X", entity.PrimaryKey.Fingerprint)) {
+		return true
+	}
+	for _, subkey := range entity.Subkeys {
+		if idMatches(id, fmt.Sprintf("%X", subkey.PublicKey.Fingerprint)) {
+			return true
+		}
+	}
+	return false
+}
+
+// idMatches returns true if id is a suffix of the hex encoded fingerprint or
+// key id (long and short key ids are suffixes of the fingerprint).
+func idMatches(id string, fingerprint string) bool {
+	id = strings.ToUpper(strings.TrimPrefix(strings.TrimSpace(id), "0x"))
+	return len(id) >= 8 && strings.HasSuffix(fingerprint, id)
+}
+
+func keyIDString(keyID uint64) string {
+	return fmt.Sprintf("%016X", keyID)
+}
+
+// readKeyrings reads all the entities found in all the armored blocks of all
+// the supplied keyrings.
+func readKeyrings(keyrings ...[]byte) (openpgp.EntityList, error) {
+	entities := openpgp.EntityList{}
+	for _, keyring := range keyrings {
+		blocks := bytes.Split(keyring, []byte(armorBegin))
+		if len(blocks) < 2 {
+			return nil, errors.New("no armored keys found in keyring")
+		}
+		for _, block := range blocks[1:] {
+			decoded, err := armor.Decode(bytes.NewReader(append([]byte(armorBegin), block...)))
+			if err != nil {
+				return nil, fmt.Errorf("armor decode: %w", err)
+			}
+			if decoded.Type != openpgp.PublicKeyType && decoded.Type != openpgp.PrivateKeyType {
+				return nil, fmt.Errorf("expected public or private key block, found %s", decoded.Type)
+			}
+			blockEntities, err := openpgp.ReadKeyRing(decoded.Body)
+			if err != nil {
+				return nil, fmt.Errorf("read keyring: %w", err)
+			}
+			entities = append(entities, blockEntities...)
+		}
+	}
+	return entities, nil
+}
+
+func recipientKeyIDs(encrypted string) ([]uint64, error) {
+	packets := packet.NewReader(
+		base64.NewDecoder(base64.StdEncoding, strings.NewReader(encrypted)))
+	keyIDs := []uint64{}
+	for {
+		p, err := packets.Next()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("read packet: %w", err)
+		}
+		encryptedKey, ok := p.(*packet.EncryptedKey)
+		if !ok {
+			break
+		}
+		keyIDs = append(keyIDs, encryptedKey.KeyId)
+	}
+	if len(keyIDs) == 0 {
+		return nil, errors.New("not an encrypted value")
+	}
+	return keyIDs, nil
+}
@@ -0,0 +1,132 @@
+package secret
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func newTestRecipient(t *testing.T) (*SecretAgent, []byte) {
+	keyring, err := GenerateKeyring("recipient", "", "", 1024)
+	require.NoError(t, err)
+	secretAgent := NewSecretAgent(keyring)
+	public, err := secretAgent.PublicKeyring()
+	require.NoError(t, err)
+	return secretAgent, public
+}
+
+func TestAddRecipients(t *testing.T) {
+	secretAgent, err := NewTestSecretAgent()
+	require.NoError(t, err)
+	recipient, recipientPublic := newTestRecipient(t)
+
+	encrypted, err := secretAgent.AddRecipients(recipientPublic).Encrypt("foo")
+	require.NoError(t, err)
+
+	recipients, err := Recipients(encrypted)
+	require.NoError(t, err)
+	assert.Len(t, recipients, 2)
+
+	for _, agent := range []*SecretAgent{secretAgent, recipient} {
+		decrypted, err := agent.Decrypt(encrypted)
+		require.NoError(t, err)
+		assert.Equal(t, "foo", decrypted)
+	}
+
+	// multiple armored blocks in a single keyring
+	_, otherPublic := newTestRecipient(t)
+	encrypted, err = secretAgent.
+		AddRecipients(append(append([]byte{}, recipientPublic...), otherPublic...)).
+		Encrypt("foo")
+	require.NoError(t, err)
+	recipients, err = Recipients(encrypted)
+	require.NoError(t, err)
+	assert.Len(t, recipients, 3)
+
+	_, err = secretAgent.AddRecipients([]byte("not a keyring")).Encrypt("foo")
+	assert.Error(t, err)
+}
+
+func TestIsEncrypted(t *testing.T) {
+	secretAgent, err := NewTestSecretAgent()
+	require.NoError(t, err)
+	encrypted, err := secretAgent.Encrypt("foo")
+	require.NoError(t, err)
+
+	assert.True(t, IsEncrypted(encrypted))
+	assert.False(t, IsEncrypted("foo"))
+	assert.False(t, IsEncrypted("SECRET_PASS"))
+	assert.False(t, IsEncrypted(""))
+}
+
+func TestRotate(t *testing.T) {
+	secretAgent, err := NewTestSecretAgent()
+	require.NoError(t, err)
+	recipient, recipientPublic := newTestRecipient(t)
+	recipientInfo, err := recipient.KeyInfo()
+	require.NoError(t, err)
+
+	encrypted, err := secretAgent.Encrypt("foo")
+	require.NoError(t, err)
+	_, err = recipient.Decrypt(encrypted)
+	assert.Error(t, err)
+
+	added, err := secretAgent.AddRecipients(recipientPublic).Rotate(encrypted)
+	require.NoError(t, err)
+	decrypted, err := recipient.Decrypt(added)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", decrypted)
+
+	// recipient public key unknown and not removed
+	_, err = secretAgent.Rotate(added)
+	assert.Error(t, err)
+
+	// only the encryption subkey id is in the message when public key unknown
+	removed, err := secretAgent.RemoveRecipients(recipientInfo[1].KeyID).Rotate(added)
+	require.NoError(t, err)
+	_, err = recipient.Decrypt(removed)
+	assert.Error(t, err)
+	decrypted, err = secretAgent.Decrypt(removed)
+	require.NoError(t, err)
+	assert.Equal(t, "foo", decrypted)
+
+	// removal by fingerprint with the public key known
+	removed, err = secretAgent.
+		AddRecipients(recipientPublic).
+		RemoveRecipients(recipientInfo[0].Fingerprint).
+		Rotate(added)
+	require.NoError(t, err)
+	recipients, err := Recipients(removed)
+	require.NoError(t, err)
+	assert.Len(t, recipients, 1)
+}
+
+func TestRotateAll(t *testing.T) {
+	secretAgent, err := NewTestSecretAgent()
+	require.NoError(t, err)
+	recipient, recipientPublic := newTestRecipient(t)
+
+	encrypted, err := secretAgent.Encrypt("foo")
+	require.NoError(t, err)
+	config := map[interface{}]interface{}{
+		"plain": "bar",
+		"port":  3306,
+		"list":  []interface{}{"baz", encrypted},
+		"nested": map[interface{}]interface{}{
+			"secret": encrypted,
+		},
+	}
+
+	rotated, err := secretAgent.AddRecipients(recipientPublic).RotateAll(config)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"/list/1", "/nested/secret"}, rotated)
+	assert.Equal(t, "bar", config["plain"])
+
+	decrypted, err := recipient.Decrypt(config["list"].([]interface{})[1].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "foo", decrypted)
+	decrypted, err = recipient.Decrypt(config["nested"].(map[interface{}]interface{})["secret"].(string))
+	require.NoError(t, err)
+	assert.Equal(t, "foo", decrypted)
+}
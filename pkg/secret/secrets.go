@@ -11,10 +11,19 @@ import (
 	"github.com/xordataexchange/crypt/encoding/secconf"
 )
 
+// ErrEncryptOnly is returned when attempting to decrypt using an agent
+// created from a public keyring.
+var ErrEncryptOnly = errors.New("encrypt-only agent cannot decrypt (requires a secret keyring)")
+
 // SecretAgent loads and holds a keypair needed for
 // encryption/decryption
 type SecretAgent struct { //nolint:revive
-	key []byte
+	encryptOnly bool
+	key         []byte
+	// recipients are additional armored keyrings to encrypt to
+	recipients [][]byte
+	// removed are ids of keys that should not be encrypted to
+	removed []string
 }
 
 // Decrypt will return the decrypted value represented by encrypted
@@ -22,6 +31,9 @@ func (secretAgent *SecretAgent) Decrypt(encrypted string) (string, error) {
 	if secretAgent.key == nil {
 		return "", errors.New("SecretAgent missing key")
 	}
+	if secretAgent.encryptOnly {
+		return "", ErrEncryptOnly
+	}
 	b, err := secconf.Decode(
 		[]byte(encrypted),
 		bytes.NewBuffer(secretAgent.key))
@@ -56,14 +68,17 @@ func (secretAgent *SecretAgent) DecryptPaths(config interface{}, encryptedPaths
 	return nil
 }
 
-// Encrypt will return the encrypted value represented by decrypted
+// Encrypt will return the encrypted value represented by decrypted. The value
+// is encrypted to all keys held by the agent as well as any recipients.
 func (secretAgent *SecretAgent) Encrypt(decrypted string) (string, error) {
 	if secretAgent.key == nil {
 		return "", errors.New("SecretAgent missing key")
 	}
-	b, err := secconf.Encode(
-		[]byte(decrypted),
-		bytes.NewBuffer(secretAgent.key))
+	entities, err := secretAgent.recipientEntities()
+	if err != nil {
+		return "", err
+	}
+	b, err := encode([]byte(decrypted), entities)
 	if err != nil {
 		return "", fmt.Errorf("encode: %w", err)
 	}
@@ -71,6 +86,12 @@ func (secretAgent *SecretAgent) Encrypt(decrypted string) (string, error) {
 	return string(b), nil
 }
 
+// EncryptOnly returns true if the agent was created from a public keyring
+// and therefore cannot decrypt.
+func (secretAgent *SecretAgent) EncryptOnly() bool {
+	return secretAgent.encryptOnly
+}
+
 func newSecretAgent(key []byte, err error) (*SecretAgent, error) {
 	if err != nil {
 		return nil, err
@@ -78,6 +99,32 @@ func newSecretAgent(key []byte, err error) (*SecretAgent, error) {
 	return NewSecretAgent(key), nil
 }
 
+func newEncryptOnlySecretAgent(key []byte, err error) (*SecretAgent, error) {
+	if err != nil {
+		return nil, err
+	}
+	return NewEncryptOnlySecretAgent(key), nil
+}
+
+// NewEncryptOnlySecretAgent will return a new SecretAgent that uses the
+// public keys found in key for encryption and refuses to decrypt.
+func NewEncryptOnlySecretAgent(key []byte) *SecretAgent {
+	return &SecretAgent{
+		encryptOnly: true,
+		key:         key,
+	}
+}
+
+// NewEncryptOnlySecretAgentFromFile loads a public keyring from keyFile
+func NewEncryptOnlySecretAgentFromFile(keyFile string) (*SecretAgent, error) {
+	return newEncryptOnlySecretAgent(os.ReadFile(keyFile))
+}
+
+// NewEncryptOnlySecretAgentFromBase64 loads a public keyring from keyBase64
+func NewEncryptOnlySecretAgentFromBase64(keyBase64 string) (*SecretAgent, error) {
+	return newEncryptOnlySecretAgent(base64.StdEncoding.DecodeString(keyBase64))
+}
+
 // NewSecretAgent will return a new SecretAgent with the provided
 // key.
 func NewSecretAgent(key []byte) *SecretAgent {
@@ -2,6 +2,7 @@ package secret
 
 import (
 	"encoding/base64"
+	"errors"
 	"os"
 	"reflect"
 	"testing"
@@ -62,6 +63,37 @@ func TestEncryptDecrypt(t *testing.T) {
 	}
 }
 
+func TestEncryptOnly(t *testing.T) {
+	plaintext := "SECRET"
+	encryptOnly, err := NewTestEncryptOnlySecretAgent()
+	if err != nil {
+		t.Errorf("Unable to create encrypt-only secret agent: %v", err)
+	}
+	if !encryptOnly.EncryptOnly() {
+		t.Error("Encrypt-only secret agent should report EncryptOnly")
+	}
+	ciphertext, err := encryptOnly.Encrypt(plaintext)
+	if err != nil {
+		t.Errorf("Unable to encrypt: %v", err)
+	}
+	_, err = encryptOnly.Decrypt(ciphertext)
+	if !errors.Is(err, ErrEncryptOnly) {
+		t.Errorf("Encrypt-only decrypt should fail with ErrEncryptOnly: %v", err)
+	}
+
+	secretAgent, err := NewTestSecretAgent()
+	if err != nil {
+		t.Errorf("Unable to create secret agent: %v", err)
+	}
+	decrypted, err := secretAgent.Decrypt(ciphertext)
+	if err != nil {
+		t.Errorf("Unable to decrypt: %v", err)
+	}
+	if decrypted != plaintext {
+		t.Errorf("Decrypted doesnt match plaintext: %v", decrypted)
+	}
+}
+
 func TestNewSecretAgent(t *testing.T) {
 	expected, err := os.ReadFile(NewTestKeysFile())
 	if err != nil {
@@ -37,6 +37,14 @@ func NewTestKeysFile() string {
 	return filepath.Join("..", "..", "testdata", "test.secring.gpg")
 }
 
+func NewTestPublicKeysFile() string {
+	return filepath.Join("..", "..", "testdata", "test.pubring.gpg")
+}
+
+func NewTestEncryptOnlySecretAgent() (*SecretAgent, error) {
+	return NewEncryptOnlySecretAgentFromFile(NewTestPublicKeysFile())
+}
+
 func NewTestSecretAgent() (*SecretAgent, error) {
 	return NewSecretAgentFromFile(NewTestKeysFile())
 }
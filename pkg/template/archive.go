@@ -0,0 +1,286 @@
+package template
+
+import (
+	"archive/tar"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// TemplateArchive receives template results in place of a destination
+// folder (see TemplateOptions.Archive). Names are slash separated paths
+// relative to the root of the archive.
+type TemplateArchive interface { //nolint:revive
+	WriteFile(name string, content []byte, mode os.FileMode, uid, gid int) error
+	WriteSymlink(name, target string) error
+}
+
+// archiveEntry is a template result pending being written to the
+// TemplateArchive. Entries are written once all templates are processed so
+// that the archive is in template order regardless of TemplateOptions.Jobs.
+type archiveEntry struct {
+	name    string
+	content []byte
+	link    string
+	mode    os.FileMode
+	uid     int
+	gid     int
+}
+
+func (entry archiveEntry) write(archive TemplateArchive) error {
+	if entry.link != "" {
+		return archive.WriteSymlink(entry.name, entry.link)
+	}
+	return archive.WriteFile(entry.name, entry.content, entry.mode, entry.uid, entry.gid)
+}
+
+// archiveResults returns the results, pending being written to the
+// TemplateArchive, for the content and outputs of the template at src. Like
+// when writing to a folder, empty results are skipped unless
+// options.KeepEmpty and outputs are relative to the folder of the result.
+// Every name must be local to the root of the archive.
+func archiveResults(
+	src, name, content string,
+	outputs []templateOutput,
+	mode os.FileMode,
+	uid, gid int,
+	options TemplateOptions,
+) ([]TemplateResult, error) {
+	results := []TemplateResult{}
+	add := func(name, content string) error {
+		if !filepath.IsLocal(filepath.FromSlash(name)) {
+			return fmt.Errorf("archive entry %q must be a relative path within the archive", name)
+		}
+		if content == "" && !options.KeepEmpty {
+			return nil
+		}
+		results = append(results, TemplateResult{
+			Src:    src,
+			Dest:   name,
+			Status: StatusCreated,
+			entry: &archiveEntry{
+				name:    name,
+				content: []byte(content),
+				mode:    mode,
+				uid:     uid,
+				gid:     gid,
+			},
+		})
+		return nil
+	}
+
+	if len(outputs) == 0 || content != "" {
+		err := add(name, content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	for _, output := range outputs {
+		err := add(path.Join(path.Dir(name), output.path), output.content)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+// archiveName returns the name of the result of the template at paths within
+// a TemplateArchive.
+func archiveName(paths pathWithRelative, options TemplateOptions) string {
+	name := paths.rel
+	if options.Flatten {
+		name = filepath.Base(paths.full)
+	}
+	return filepath.ToSlash(strings.TrimSuffix(name, options.Extension))
+}
+
+// TarArchive writes template results to a tar archive. Entries have a fixed
+// modification time so that rendering the same results produces the same
+// archive.
+type TarArchive struct {
+	writer  *tar.Writer
+	dirMode os.FileMode
+	dirs    map[string]bool
+	// files are the names of the files and symlinks added.
+	files map[string]bool
+}
+
+// NewTarArchive returns a TarArchive writing to w. Folders are added ahead of
+// the first entry in them with dirMode. Close must be called to complete the
+// archive.
+func NewTarArchive(w io.Writer, dirMode os.FileMode) *TarArchive {
+	return &TarArchive{
+		writer:  tar.NewWriter(w),
+		dirMode: dirMode,
+		dirs:    map[string]bool{},
+		files:   map[string]bool{},
+	}
+}
+
+// WriteFile adds a regular file. A uid or gid of -1 is written as 0.
+func (a *TarArchive) WriteFile(name string, content []byte, mode os.FileMode, uid, gid int) error {
+	err := a.addFile(name)
+	if err != nil {
+		return err
+	}
+	err = a.writeDirs(name, uid, gid)
+	if err != nil {
+		return err
+	}
+	err = a.writer.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Mode:     tarMode(mode),
+		Uid:      max(uid, 0),
+		Gid:      max(gid, 0),
+		Size:     int64(len(content)),
+		ModTime:  time.Unix(0, 0),
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		return fmt.Errorf("write tar header for %s: %w", name, err)
+	}
+	_, err = a.writer.Write(content)
+	if err != nil {
+		return fmt.Errorf("write tar content for %s: %w", name, err)
+	}
+	return nil
+}
+
+// WriteSymlink adds a symlink to target.
+func (a *TarArchive) WriteSymlink(name, target string) error {
+	err := a.addFile(name)
+	if err != nil {
+		return err
+	}
+	err = a.writeDirs(name, -1, -1)
+	if err != nil {
+		return err
+	}
+	err = a.writer.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeSymlink,
+		Name:     name,
+		Linkname: target,
+		Mode:     0777,
+		ModTime:  time.Unix(0, 0),
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		return fmt.Errorf("write tar header for %s: %w", name, err)
+	}
+	return nil
+}
+
+// addFile records name as added, failing if it already was (as extracting
+// the archive would silently keep only the last entry) or is a folder.
+func (a *TarArchive) addFile(name string) error {
+	if a.files[name] || a.dirs[name] {
+		return fmt.Errorf("duplicate tar entry %s", name)
+	}
+	a.files[name] = true
+	return nil
+}
+
+// writeDirs adds the folders containing name not already added.
+func (a *TarArchive) writeDirs(name string, uid, gid int) error {
+	dir := path.Dir(name)
+	if dir == "." || a.dirs[dir] {
+		return nil
+	}
+	if a.files[dir] {
+		return fmt.Errorf("duplicate tar entry %s", dir)
+	}
+	err := a.writeDirs(dir, uid, gid)
+	if err != nil {
+		return err
+	}
+	a.dirs[dir] = true
+	err = a.writer.WriteHeader(&tar.Header{
+		Typeflag: tar.TypeDir,
+		Name:     dir + "/",
+		Mode:     tarMode(a.dirMode),
+		Uid:      max(uid, 0),
+		Gid:      max(gid, 0),
+		ModTime:  time.Unix(0, 0),
+		Format:   tar.FormatPAX,
+	})
+	if err != nil {
+		return fmt.Errorf("write tar header for %s: %w", dir, err)
+	}
+	return nil
+}
+
+// Close completes the archive. It does not close the underlying writer.
+func (a *TarArchive) Close() error {
+	err := a.writer.Close()
+	if err != nil {
+		return fmt.Errorf("close tar: %w", err)
+	}
+	return nil
+}
+
+// tarMode converts mode to the unix mode bits used in tar headers.
+func tarMode(mode os.FileMode) int64 {
+	result := int64(mode.Perm())
+	if mode&os.ModeSetuid != 0 {
+		result |= setuid << 9
+	}
+	if mode&os.ModeSetgid != 0 {
+		result |= setgid << 9
+	}
+	if mode&os.ModeSticky != 0 {
+		result |= sticky << 9
+	}
+	return result
+}
+
+// ConcatArchive writes template results one after another, each preceded by
+// a header line (==> name <==) like head and tail do for multiple files.
+type ConcatArchive struct {
+	writer io.Writer
+	count  int
+}
+
+// NewConcatArchive returns a ConcatArchive writing to w.
+func NewConcatArchive(w io.Writer) *ConcatArchive {
+	return &ConcatArchive{writer: w}
+}
+
+// WriteFile writes the header for name followed by content. The mode and
+// owner are not written.
+func (a *ConcatArchive) WriteFile(name string, content []byte, _ os.FileMode, _, _ int) error {
+	err := a.writeHeader(name)
+	if err != nil {
+		return err
+	}
+	if len(content) > 0 && content[len(content)-1] != '\n' {
+		content = append(content[:len(content):len(content)], '\n')
+	}
+	_, err = a.writer.Write(content)
+	if err != nil {
+		return fmt.Errorf("write %s: %w", name, err)
+	}
+	return nil
+}
+
+// WriteSymlink writes the header for name including the link target.
+func (a *ConcatArchive) WriteSymlink(name, target string) error {
+	return a.writeHeader(name + " -> " + target)
+}
+
+func (a *ConcatArchive) writeHeader(name string) error {
+	separator := ""
+	if a.count > 0 {
+		separator = "\n"
+	}
+	a.count++
+	_, err := fmt.Fprintf(a.writer, "%s==> %s <==\n", separator, name)
+	if err != nil {
+		return fmt.Errorf("write header for %s: %w", name, err)
+	}
+	return nil
+}
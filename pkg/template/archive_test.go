@@ -0,0 +1,149 @@
+package template
+
+import (
+	"archive/tar"
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type tarEntry struct {
+	typeflag byte
+	mode     int64
+	content  string
+}
+
+func readTar(t *testing.T, content []byte) map[string]tarEntry {
+	entries := map[string]tarEntry{}
+	reader := tar.NewReader(bytes.NewReader(content))
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return entries
+		}
+		require.NoError(t, err)
+		data, err := io.ReadAll(reader)
+		require.NoError(t, err)
+		content := string(data)
+		if header.Typeflag == tar.TypeSymlink {
+			content = header.Linkname
+		}
+		entries[header.Name] = tarEntry{typeflag: header.Typeflag, mode: header.Mode, content: content}
+	}
+}
+
+func TestProcessTemplatesTarArchive(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "conf"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "conf", "app.conf.clconf"),
+		[]byte(`host={{ getv "/host" }}`), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "sites.clconf"),
+		[]byte(`{{ output "sites/a.conf" }}a{{ output "sites/b.conf" }}b`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "empty.clconf"), []byte(""), 0644))
+	require.NoError(t, os.Symlink("conf/app.conf.clconf", filepath.Join(src, "link")))
+
+	var buffer bytes.Buffer
+	archive := NewTarArchive(&buffer, 0750)
+	results, err := ProcessTemplates([]string{src}, "", map[interface{}]interface{}{"host": "db"}, nil,
+		TemplateOptions{
+			Extension:         ".clconf",
+			CopyTemplatePerms: true,
+			Symlinks:          SymlinkCopy,
+			Archive:           archive,
+			Jobs:              4,
+		})
+	require.NoError(t, err)
+	require.NoError(t, archive.Close())
+
+	dests := []string{}
+	for _, result := range results {
+		assert.Equal(t, StatusCreated, result.Status)
+		dests = append(dests, result.Dest)
+	}
+	assert.Equal(t, []string{"conf/app.conf", "link", "sites/a.conf", "sites/b.conf"}, dests)
+
+	assert.Equal(t, map[string]tarEntry{
+		"conf/":         {typeflag: tar.TypeDir, mode: 0750},
+		"conf/app.conf": {typeflag: tar.TypeReg, mode: 0755, content: "host=db"},
+		"link":          {typeflag: tar.TypeSymlink, mode: 0777, content: "conf/app.conf.clconf"},
+		"sites/":        {typeflag: tar.TypeDir, mode: 0750},
+		"sites/a.conf":  {typeflag: tar.TypeReg, mode: 0644, content: "a"},
+		"sites/b.conf":  {typeflag: tar.TypeReg, mode: 0644, content: "b"},
+	}, readTar(t, buffer.Bytes()))
+	assert.NoFileExists(t, filepath.Join(src, "conf", "app.conf"))
+}
+
+func TestProcessTemplatesConcatArchive(t *testing.T) {
+	src := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "b"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "a.clconf"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "b", "c.clconf"), []byte("c\n"), 0644))
+
+	var buffer bytes.Buffer
+	_, err := ProcessTemplates([]string{src}, "", nil, nil, TemplateOptions{
+		Extension: ".clconf",
+		FileMode:  0644,
+		Archive:   NewConcatArchive(&buffer),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "==> a <==\na\n\n==> b/c <==\nc\n", buffer.String())
+
+	buffer.Reset()
+	_, err = ProcessTemplates([]string{src}, "", nil, nil, TemplateOptions{
+		Extension: ".clconf",
+		FileMode:  0644,
+		Flatten:   true,
+		Archive:   NewConcatArchive(&buffer),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "==> a <==\na\n\n==> c <==\nc\n", buffer.String())
+}
+
+func TestTarArchiveDuplicate(t *testing.T) {
+	archive := NewTarArchive(io.Discard, 0755)
+	require.NoError(t, archive.WriteFile("a/b", []byte("b"), 0644, -1, -1))
+	assert.ErrorContains(t, archive.WriteFile("a/b", []byte("b"), 0644, -1, -1), "duplicate tar entry a/b")
+	assert.ErrorContains(t, archive.WriteSymlink("a/b", "c"), "duplicate tar entry a/b")
+	assert.ErrorContains(t, archive.WriteFile("a", []byte("a"), 0644, -1, -1), "duplicate tar entry a")
+	assert.ErrorContains(t, archive.WriteFile("a/b/c", []byte("c"), 0644, -1, -1), "duplicate tar entry a/b")
+
+	// two sources with the same relative path
+	temp := t.TempDir()
+	for _, src := range []string{"one", "two"} {
+		require.NoError(t, os.MkdirAll(filepath.Join(temp, src), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(temp, src, "app.conf"), []byte(src), 0644))
+	}
+	var buffer bytes.Buffer
+	_, err := ProcessTemplates([]string{filepath.Join(temp, "one"), filepath.Join(temp, "two")}, "", nil, nil,
+		TemplateOptions{FileMode: 0644, Archive: NewTarArchive(&buffer, 0755)})
+	assert.ErrorContains(t, err, "duplicate tar entry app.conf")
+}
+
+func TestTarMode(t *testing.T) {
+	assert.Equal(t, int64(0644), tarMode(0644))
+	mode, err := UnixModeToFileMode("4755")
+	require.NoError(t, err)
+	assert.Equal(t, int64(04755), tarMode(mode))
+	mode, err = UnixModeToFileMode("3775")
+	require.NoError(t, err)
+	assert.Equal(t, int64(03775), tarMode(mode))
+}
+
+func TestArchiveResultsNotLocal(t *testing.T) {
+	results, err := archiveResults("app.clconf", "conf/app", "", []templateOutput{{path: "a", content: "a"}},
+		0644, -1, -1, TemplateOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.Equal(t, "conf/a", results[0].entry.name)
+
+	for _, output := range []string{"../../data.txt", "../../../data.txt"} {
+		_, err = archiveResults("app.clconf", "conf/app", "", []templateOutput{{path: output, content: "data"}},
+			0644, -1, -1, TemplateOptions{})
+		assert.ErrorContains(t, err, "must be a relative path", output)
+	}
+}
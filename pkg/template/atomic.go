@@ -0,0 +1,110 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// WriteFileAtomic writes content to file with mode such that readers see
+// either the previous content or the new content, never a partial write. The
+// content is written and synced to a temporary file in the same folder which
+// is then renamed over file, and the folder synced. If file is a symlink, the
+// file it links to is replaced.
+func WriteFileAtomic(file string, content []byte, mode os.FileMode) error {
+	return writeFileAtomic(file, content, mode, -1, -1)
+}
+
+// writeFileAtomic is WriteFileAtomic that also changes the owner and group of
+// file to uid and gid (see stageFileOwned).
+func writeFileAtomic(file string, content []byte, mode os.FileMode, uid, gid int) error {
+	file = resolveSymlinks(file)
+	staged, err := stageFileOwned(file, content, mode, uid, gid)
+	if err != nil {
+		return err
+	}
+	return replaceFile(staged, file)
+}
+
+// resolveSymlinks returns the file that file links to, or file itself if it
+// is not a symlink (or does not exist yet), so that the link is preserved
+// when the file is replaced.
+func resolveSymlinks(file string) string {
+	if resolved, err := filepath.EvalSymlinks(file); err == nil {
+		return resolved
+	}
+	return file
+}
+
+// replaceFile renames staged over file, removing staged if that fails, then
+// syncs the folder so that the rename itself survives a crash.
+func replaceFile(staged, file string) error {
+	err := os.Rename(staged, file)
+	if err != nil {
+		_ = os.Remove(staged)
+		return fmt.Errorf("rename staged: %w", err)
+	}
+	return syncDir(filepath.Dir(file))
+}
+
+// stageFileOwned is stageFile that also changes the owner and group of the
+// staged file to uid and gid. If either is -1, the value of the existing file
+// is preserved when possible (a file can only be given away by a privileged
+// process).
+func stageFileOwned(file string, content []byte, mode os.FileMode, uid, gid int) (string, error) {
+	staged, err := stageFile(file, content, mode)
+	if err != nil {
+		return "", err
+	}
+
+	if uid != -1 || gid != -1 {
+		err = chown(staged, uid, gid)
+		if err != nil {
+			_ = os.Remove(staged)
+			return "", err
+		}
+	}
+	if stat, err := os.Stat(file); err == nil && (uid == -1 || gid == -1) {
+		if existingUID, existingGID, ok := fileOwner(stat); ok {
+			if uid != -1 {
+				existingUID = -1
+			}
+			if gid != -1 {
+				existingGID = -1
+			}
+			// best effort, the rename replaces the file with one owned by
+			// this process which is the norm for an unprivileged process
+			_ = os.Chown(staged, existingUID, existingGID)
+		}
+	}
+	return staged, nil
+}
+
+// stageFile writes content to a new, synced, temporary file with mode in the
+// same folder as file so that it can be renamed over file. The caller is
+// responsible for removing it if it is not renamed.
+func stageFile(file string, content []byte, mode os.FileMode) (string, error) {
+	staged, err := os.CreateTemp(filepath.Dir(file), "."+filepath.Base(file)+".*")
+	if err != nil {
+		return "", fmt.Errorf("create staged: %w", err)
+	}
+	name := staged.Name()
+
+	_, err = staged.Write(content)
+	if err == nil {
+		err = staged.Sync()
+	}
+	if closeErr := staged.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		// CreateTemp always uses 0600 so the mode is applied explicitly (which
+		// also avoids the umask)
+		err = os.Chmod(name, mode)
+	}
+	if err != nil {
+		_ = os.Remove(name)
+		return "", fmt.Errorf("write staged: %w", err)
+	}
+	return name, nil
+}
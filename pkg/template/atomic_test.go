@@ -0,0 +1,77 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteFileAtomic(t *testing.T) {
+	temp := t.TempDir()
+	file := filepath.Join(temp, "file")
+
+	require.NoError(t, WriteFileAtomic(file, []byte("one"), 0640))
+	require.NoError(t, WriteFileAtomic(file, []byte("two"), 0600))
+	content, err := os.ReadFile(file)
+	require.NoError(t, err)
+	assert.Equal(t, "two", string(content))
+	if runtime.GOOS != "windows" {
+		stat, err := os.Stat(file)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0600), stat.Mode())
+
+		link := filepath.Join(temp, "link")
+		require.NoError(t, os.Symlink(file, link))
+		require.NoError(t, WriteFileAtomic(link, []byte("three"), 0600))
+		content, err = os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Equal(t, "three", string(content))
+		info, err := os.Lstat(link)
+		require.NoError(t, err)
+		assert.NotZero(t, info.Mode()&os.ModeSymlink)
+	}
+
+	entries, err := os.ReadDir(temp)
+	require.NoError(t, err)
+	for _, entry := range entries {
+		assert.Contains(t, []string{"file", "link"}, entry.Name())
+	}
+}
+
+func TestProcessTemplatesStatus(t *testing.T) {
+	temp := t.TempDir()
+	src := filepath.Join(temp, "a.clconf")
+	dest := filepath.Join(temp, "a")
+	require.NoError(t, os.WriteFile(src, []byte(`{{ getv "/foo" }}`), 0640))
+	options := TemplateOptions{Extension: ".clconf", CopyTemplatePerms: true}
+
+	process := func(value string) TemplateStatus {
+		results, err := ProcessTemplates([]string{src}, "", map[interface{}]interface{}{"foo": value},
+			nil, options)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		return results[0].Status
+	}
+
+	assert.Equal(t, StatusCreated, process("bar"))
+
+	old := time.Now().Add(-time.Hour).Truncate(time.Second)
+	require.NoError(t, os.Chtimes(dest, old, old))
+	assert.Equal(t, StatusUnchanged, process("bar"))
+	stat, err := os.Stat(dest)
+	require.NoError(t, err)
+	assert.True(t, old.Equal(stat.ModTime()), "unchanged should not be written")
+
+	assert.Equal(t, StatusUpdated, process("baz"))
+	if runtime.GOOS != "windows" {
+		require.NoError(t, os.Chmod(dest, 0600))
+		assert.Equal(t, StatusUpdated, process("baz"))
+	}
+	assert.Equal(t, StatusRemoved, process(""))
+	assert.Equal(t, StatusUnchanged, process(""))
+}
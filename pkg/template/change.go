@@ -0,0 +1,173 @@
+package template
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+const devNull = "/dev/null"
+
+// targetChange describes the change processing a template will make to its
+// destination.
+type targetChange struct {
+	status     TemplateStatus
+	oldContent []byte
+	oldMode    os.FileMode
+	newContent []byte
+	newMode    os.FileMode
+	oldUID     int
+	oldGID     int
+	newUID     int
+	newGID     int
+}
+
+// planTarget determines the change required for target to hold content.
+// Empty content results in the removal of target unless options.KeepEmpty.
+// If options.KeepExistingPerms, the mode of an existing target is preserved.
+// The owner and group are changed to uid and gid unless they are -1.
+func planTarget(
+	target string,
+	content []byte,
+	mode os.FileMode,
+	uid, gid int,
+	options TemplateOptions,
+) (targetChange, error) {
+	change := targetChange{
+		newContent: content,
+		newMode:    mode,
+		oldUID:     -1,
+		oldGID:     -1,
+		newUID:     uid,
+		newGID:     gid,
+	}
+	remove := !options.KeepEmpty && len(content) == 0
+
+	stat, err := os.Stat(target)
+	if os.IsNotExist(err) {
+		change.status = StatusCreated
+		if remove {
+			change.status = StatusUnchanged
+		}
+		return change, nil
+	}
+	if err != nil {
+		return change, fmt.Errorf("stat target: %w", err)
+	}
+
+	change.oldMode = stat.Mode()
+	if oldUID, oldGID, ok := fileOwner(stat); ok {
+		change.oldUID, change.oldGID = oldUID, oldGID
+	}
+	change.oldContent, err = os.ReadFile(target)
+	if err != nil {
+		return change, fmt.Errorf("read target: %w", err)
+	}
+
+	switch {
+	case remove:
+		change.status = StatusRemoved
+	case options.KeepExistingPerms:
+		change.newMode = change.oldMode
+		fallthrough
+	default:
+		change.status = StatusUpdated
+		if change.newMode == change.oldMode &&
+			!change.ownerChanged() &&
+			bytes.Equal(change.newContent, change.oldContent) {
+			change.status = StatusUnchanged
+		}
+	}
+	return change, nil
+}
+
+// apply makes the change to target.
+func (c targetChange) apply(target string) error {
+	switch c.status {
+	case StatusCreated, StatusUpdated:
+		err := writeFileAtomic(target, c.newContent, c.newMode, c.newUID, c.newGID)
+		if err != nil {
+			return fmt.Errorf("write target: %w", err)
+		}
+	case StatusRemoved:
+		err := os.Remove(target)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove empty: %w", err)
+		}
+	case StatusUnchanged:
+	}
+	return nil
+}
+
+// diff returns a unified diff of the change to target, preceded by the old and
+// new modes if they differ, or an empty string if unchanged.
+func (c targetChange) diff(target string) string {
+	if c.status == StatusUnchanged {
+		return ""
+	}
+
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "diff %s\n", target)
+	fromFile, toFile := target, target
+	switch c.status {
+	case StatusCreated:
+		fromFile = devNull
+		fmt.Fprintf(&buf, "new file mode %s\n", c.newMode)
+	case StatusRemoved:
+		toFile = devNull
+		fmt.Fprintf(&buf, "deleted file mode %s\n", c.oldMode)
+	default:
+		if c.oldMode != c.newMode {
+			fmt.Fprintf(&buf, "old mode %s\nnew mode %s\n", c.oldMode, c.newMode)
+		}
+		if c.ownerChanged() {
+			fmt.Fprintf(&buf, "old owner %d:%d\nnew owner %d:%d\n",
+				c.oldUID, c.oldGID, orDefault(c.newUID, c.oldUID), orDefault(c.newGID, c.oldGID))
+		}
+	}
+
+	var newContent []byte
+	if c.status != StatusRemoved {
+		newContent = c.newContent
+	}
+	unified, _ := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(c.oldContent),
+		B:        splitLines(newContent),
+		FromFile: fromFile,
+		ToFile:   toFile,
+		Context:  3,
+	})
+	buf.WriteString(unified)
+	return buf.String()
+}
+
+// ownerChanged returns true if an existing target will have its owner or
+// group changed.
+func (c targetChange) ownerChanged() bool {
+	return (c.newUID != -1 && c.newUID != c.oldUID) || (c.newGID != -1 && c.newGID != c.oldGID)
+}
+
+func orDefault(id, defaultID int) int {
+	if id == -1 {
+		return defaultID
+	}
+	return id
+}
+
+// splitLines splits content into lines that keep their line endings, adding
+// a "no newline" marker to a final unterminated line as diff does.
+func splitLines(content []byte) []string {
+	if len(content) == 0 {
+		return []string{}
+	}
+	lines := strings.SplitAfter(string(content), "\n")
+	last := len(lines) - 1
+	if lines[last] == "" {
+		return lines[:last]
+	}
+	lines[last] += "\n\\ No newline at end of file\n"
+	return lines
+}
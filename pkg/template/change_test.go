@@ -0,0 +1,64 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDryRunDiff(t *testing.T) {
+	temp := t.TempDir()
+	src := filepath.Join(temp, "a.clconf")
+	dest := filepath.Join(temp, "a")
+	require.NoError(t, os.WriteFile(src, []byte("one\n{{ getv \"/foo\" }}\nthree\n"), 0640))
+	options := TemplateOptions{Extension: ".clconf", CopyTemplatePerms: true, DryRun: true, Diff: true}
+
+	process := func(value string) TemplateResult {
+		results, err := ProcessTemplates([]string{src}, "", map[interface{}]interface{}{"foo": value},
+			nil, options)
+		require.NoError(t, err)
+		require.Len(t, results, 1)
+		return results[0]
+	}
+
+	result := process("two")
+	assert.Equal(t, StatusCreated, result.Status)
+	assert.NoFileExists(t, dest)
+	assert.Contains(t, result.Diff, "--- /dev/null\n+++ "+dest+"\n")
+	assert.Contains(t, result.Diff, "+one\n+two\n+three\n")
+
+	require.NoError(t, os.WriteFile(dest, []byte("one\nTWO\nthree\n"), 0600))
+	require.NoError(t, os.Chmod(dest, 0600))
+	result = process("two")
+	assert.Equal(t, StatusUpdated, result.Status)
+	assert.Contains(t, result.Diff, " one\n-TWO\n+two\n three\n")
+	if runtime.GOOS != "windows" {
+		assert.Contains(t, result.Diff, "old mode -rw-------\nnew mode -rw-r-----\n")
+	}
+	content, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "one\nTWO\nthree\n", string(content))
+
+	require.NoError(t, os.WriteFile(src, []byte(`{{ getv "/foo" }}`), 0640))
+	result = process("")
+	assert.Equal(t, StatusRemoved, result.Status)
+	assert.Contains(t, result.Diff, "+++ /dev/null\n")
+	assert.Contains(t, result.Diff, "-TWO\n")
+	assert.FileExists(t, dest)
+
+	require.NoError(t, os.Chmod(dest, 0640))
+	require.NoError(t, os.WriteFile(dest, []byte("two"), 0640))
+	result = process("two")
+	assert.Equal(t, StatusUnchanged, result.Status)
+	assert.Equal(t, "", result.Diff)
+}
+
+func TestSplitLines(t *testing.T) {
+	assert.Equal(t, []string{}, splitLines(nil))
+	assert.Equal(t, []string{"a\n", "b\n"}, splitLines([]byte("a\nb\n")))
+	assert.Equal(t, []string{"a\n", "b\n\\ No newline at end of file\n"}, splitLines([]byte("a\nb")))
+}
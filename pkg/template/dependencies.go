@@ -0,0 +1,146 @@
+package template
+
+import (
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/pastdev/clconf/v3/pkg/core"
+	"github.com/pastdev/clconf/v3/pkg/memkv"
+)
+
+// Dependencies are the config keys a template read when it was executed. All
+// are absolute (ie: include the TemplateConfig.Prefix).
+type Dependencies struct {
+	// Keys are the exact keys looked up (ie: getv, get, exists, cgetv).
+	Keys []string `json:"keys"`
+	// Patterns are the glob patterns looked up (ie: getvs, gets, cgetvs).
+	Patterns []string `json:"patterns"`
+	// Regexes are the regular expressions looked up (ie: getvsRegex,
+	// getsRegex).
+	Regexes []string `json:"regexes"`
+	// Lists are the paths whose children were listed (ie: ls, lsdir).
+	Lists []string `json:"lists"`
+	// Trees are the keys read along with everything under them (ie:
+	// getlist, getmap).
+	Trees []string `json:"trees"`
+}
+
+// dependencyRecorder collects the keys accessed in a memkv.Store.
+type dependencyRecorder struct {
+	prefix   string
+	accessed map[memkv.AccessKind]map[string]bool
+}
+
+func newDependencyRecorder(prefix string) *dependencyRecorder {
+	r := &dependencyRecorder{prefix: prefix}
+	r.reset()
+	return r
+}
+
+func (r *dependencyRecorder) record(kind memkv.AccessKind, key string) {
+	if kind == memkv.AccessRegex {
+		r.accessed[kind][prefixRegex(r.prefix, key)] = true
+		return
+	}
+	r.accessed[kind][path.Join("/", r.prefix, key)] = true
+}
+
+// prefixRegex returns expr matching the absolute keys when it was matched
+// against the keys under prefix.
+func prefixRegex(prefix, expr string) string {
+	prefix = strings.TrimSuffix(path.Join("/", prefix), "/")
+	if prefix == "" {
+		return expr
+	}
+	return regexp.QuoteMeta(prefix) + "(?:" + expr + ")"
+}
+
+func (r *dependencyRecorder) reset() {
+	r.accessed = map[memkv.AccessKind]map[string]bool{
+		memkv.AccessKey:     {},
+		memkv.AccessPattern: {},
+		memkv.AccessRegex:   {},
+		memkv.AccessList:    {},
+		memkv.AccessTree:    {},
+	}
+}
+
+func (r *dependencyRecorder) dependencies() Dependencies {
+	return Dependencies{
+		Keys:     sortedKeys(r.accessed[memkv.AccessKey]),
+		Patterns: sortedKeys(r.accessed[memkv.AccessPattern]),
+		Regexes:  sortedKeys(r.accessed[memkv.AccessRegex]),
+		Lists:    sortedKeys(r.accessed[memkv.AccessList]),
+		Trees:    sortedKeys(r.accessed[memkv.AccessTree]),
+	}
+}
+
+// UnusedKeys returns the sorted keys in value that were not read by any of the
+// results, either exactly, by matching a pattern or regular expression or by
+// being under a tree. Listing a path does not use the keys under it.
+func UnusedKeys(value interface{}, results []TemplateResult) []string {
+	used := map[string]bool{}
+	patterns := []string{}
+	regexes := []*regexp.Regexp{}
+	trees := []string{}
+	for _, result := range results {
+		for _, key := range result.Dependencies.Keys {
+			used[key] = true
+		}
+		patterns = append(patterns, result.Dependencies.Patterns...)
+		for _, expr := range result.Dependencies.Regexes {
+			if re, err := memkv.CompileRegex(expr); err == nil {
+				regexes = append(regexes, re)
+			}
+		}
+		trees = append(trees, result.Dependencies.Trees...)
+	}
+
+	unused := []string{}
+	for key := range core.ToKvMap(value) {
+		if used[key] || matchesAny(patterns, key) || matchesAnyRegex(regexes, key) || underAny(trees, key) {
+			continue
+		}
+		unused = append(unused, key)
+	}
+	sort.Strings(unused)
+	return unused
+}
+
+func matchesAny(patterns []string, key string) bool {
+	for _, pattern := range patterns {
+		if matched, _ := memkv.Match(pattern, key); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func matchesAnyRegex(regexes []*regexp.Regexp, key string) bool {
+	for _, re := range regexes {
+		if re.MatchString(key) {
+			return true
+		}
+	}
+	return false
+}
+
+func underAny(trees []string, key string) bool {
+	for _, tree := range trees {
+		if tree == "/" || key == tree || strings.HasPrefix(key, tree+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func sortedKeys(set map[string]bool) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
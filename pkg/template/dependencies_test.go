@@ -0,0 +1,51 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDependencies(t *testing.T) {
+	value := map[interface{}]interface{}{
+		"app": map[interface{}]interface{}{
+			"db":       map[interface{}]interface{}{"host": "localhost", "port": 5432},
+			"aliases":  []interface{}{"a", "b"},
+			"settings": map[interface{}]interface{}{"a": 1, "b": true},
+			"unused":   "x",
+			"cache":    map[interface{}]interface{}{"a": map[interface{}]interface{}{"ttl": 1}},
+			"queues":   map[interface{}]interface{}{"q1": "a", "q2": "b"},
+		},
+	}
+	tmpl, err := NewTemplate("deps",
+		`{{ getv "/db/host" }}{{ getv "/db/user" "" }}{{ if exists "/debug" }}{{ end }}`+
+			`{{ range ls "/db" }}{{ end }}{{ getvs "/aliases/*" }}{{ include "lib" . }}`+
+			`{{ getmap "/settings" }}{{ getvs "/cache/**" }}{{ getvsRegex "/queues/q[0-9]+" }}`,
+		&TemplateConfig{
+			Prefix:    "/app",
+			Libraries: map[string]string{"lib.tmpl": `{{ define "lib" }}{{ getv "/db/port" }}{{ end }}`},
+		})
+	require.NoError(t, err)
+	_, err = tmpl.Execute(value)
+	require.NoError(t, err)
+
+	dependencies := tmpl.Dependencies()
+	assert.Equal(t,
+		Dependencies{
+			Keys:     []string{"/app/db/host", "/app/db/port", "/app/db/user", "/app/debug"},
+			Patterns: []string{"/app/aliases/*", "/app/cache/**"},
+			Regexes:  []string{`/app(?:/queues/q[0-9]+)`},
+			Lists:    []string{"/app/db"},
+			Trees:    []string{"/app/settings"},
+		},
+		dependencies)
+
+	assert.Equal(t,
+		[]string{"/app/unused"},
+		UnusedKeys(value, []TemplateResult{{Dependencies: dependencies}}))
+
+	_, err = tmpl.Execute(value)
+	require.NoError(t, err)
+	assert.Equal(t, dependencies, tmpl.Dependencies(), "reset for each execute")
+}
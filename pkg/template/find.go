@@ -0,0 +1,237 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// SymlinkMode determines how symlinks found under a template source folder are
+// handled.
+type SymlinkMode string
+
+const (
+	// SymlinkFollow treats a symlink as the file or folder it links to. Links
+	// to a folder already being walked (a loop) and broken links are skipped.
+	SymlinkFollow SymlinkMode = "follow"
+	// SymlinkCopy recreates the symlink (with the same link target) in the
+	// destination instead of templating what it links to. Symlinks are copied
+	// whether or not they have the template extension.
+	SymlinkCopy SymlinkMode = "copy"
+	// SymlinkSkip ignores symlinks.
+	SymlinkSkip SymlinkMode = "skip"
+)
+
+// ParseSymlinkMode returns the SymlinkMode named by mode.
+func ParseSymlinkMode(mode string) (SymlinkMode, error) {
+	switch SymlinkMode(mode) {
+	case SymlinkFollow, SymlinkCopy, SymlinkSkip:
+		return SymlinkMode(mode), nil
+	default:
+		return "", fmt.Errorf("unsupported symlink mode %q (expected follow, copy or skip)", mode)
+	}
+}
+
+// templateFinder finds the templates under a source.
+type templateFinder struct {
+	exclude   pathPatterns
+	extension string
+	include   pathPatterns
+	symlinks  SymlinkMode
+}
+
+func newTemplateFinder(options TemplateOptions) (*templateFinder, error) {
+	include, err := newPathPatterns(options.Include)
+	if err != nil {
+		return nil, fmt.Errorf("include: %w", err)
+	}
+	exclude, err := newPathPatterns(options.Exclude)
+	if err != nil {
+		return nil, fmt.Errorf("exclude: %w", err)
+	}
+	symlinks := options.Symlinks
+	if symlinks == "" {
+		symlinks = SymlinkFollow
+	}
+	return &templateFinder{
+		exclude:   exclude,
+		extension: options.Extension,
+		include:   include,
+		symlinks:  symlinks,
+	}, nil
+}
+
+// findTemplates returns the templates under startPath that end with
+// extension. If startPath is a file, it is returned regardless of extension.
+func findTemplates(startPath string, extension string) ([]pathWithRelative, error) {
+	finder, err := newTemplateFinder(TemplateOptions{Extension: extension})
+	if err != nil {
+		return nil, err
+	}
+	return finder.find(startPath)
+}
+
+// find returns the templates under startPath, in lexical order, that end
+// with the extension, are not ignored (see IgnoreFile) or excluded and, if
+// there are include patterns, are included. If startPath is a file, it is
+// returned regardless.
+func (f *templateFinder) find(startPath string) ([]pathWithRelative, error) {
+	startPath = filepath.Clean(startPath)
+	info, err := os.Stat(startPath)
+	if err != nil {
+		return nil, fmt.Errorf("find templates: %w", err)
+	}
+	if !info.IsDir() {
+		return []pathWithRelative{{rel: filepath.Base(startPath), full: startPath}}, nil
+	}
+
+	result := []pathWithRelative{}
+	err = f.walk(startPath, "", nil, map[string]bool{}, &result)
+	if err != nil {
+		return nil, fmt.Errorf("find templates: %w", err)
+	}
+	return result, nil
+}
+
+// walk adds the templates in dir, whose slash separated path relative to the
+// source is rel, to result. visited holds the real paths of the folders being
+// walked to detect symlink loops.
+func (f *templateFinder) walk(
+	dir, rel string,
+	ignores pathPatterns,
+	visited map[string]bool,
+	result *[]pathWithRelative,
+) error {
+	realDir, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return fmt.Errorf("resolve %s: %w", dir, err)
+	}
+	if visited[realDir] {
+		return nil
+	}
+	visited[realDir] = true
+	defer delete(visited, realDir)
+
+	dirIgnores, err := readIgnoreFile(dir, rel)
+	if err != nil {
+		return err
+	}
+	ignores = append(append(pathPatterns{}, ignores...), dirIgnores...)
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("read dir: %w", err)
+	}
+	for _, entry := range entries {
+		full := filepath.Join(dir, entry.Name())
+		entryRel := entry.Name()
+		if rel != "" {
+			entryRel = rel + "/" + entry.Name()
+		}
+
+		link := ""
+		isDir := entry.IsDir()
+		if entry.Type()&os.ModeSymlink != 0 {
+			switch f.symlinks {
+			case SymlinkSkip:
+				continue
+			case SymlinkCopy:
+				link, err = os.Readlink(full)
+				if err != nil {
+					return fmt.Errorf("read link: %w", err)
+				}
+				isDir = false
+			default:
+				info, err := os.Stat(full)
+				if errors.Is(err, os.ErrNotExist) {
+					// broken (ie: an editor lock file)
+					continue
+				}
+				if err != nil {
+					return fmt.Errorf("stat link: %w", err)
+				}
+				isDir = info.IsDir()
+			}
+		}
+
+		if entry.Name() == IgnoreFile || isOutputsStateFile(entry.Name()) ||
+			ignores.ignored(entryRel, isDir) ||
+			f.exclude.matches(entryRel, isDir) {
+			continue
+		}
+		if isDir {
+			err = f.walk(full, entryRel, ignores, visited, result)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		// copied links are not templates so need not have the extension
+		if link == "" && !strings.HasSuffix(entry.Name(), f.extension) {
+			continue
+		}
+		if len(f.include) > 0 && !f.include.matches(entryRel, false) {
+			continue
+		}
+		*result = append(*result, pathWithRelative{
+			full: full,
+			rel:  filepath.FromSlash(entryRel),
+			link: link,
+		})
+	}
+	return nil
+}
+
+// copyLink makes target a symlink with the same link target as the symlink at
+// paths (see SymlinkCopy).
+func copyLink(paths pathWithRelative, target string, options TemplateOptions) (TemplateResult, error) {
+	result := TemplateResult{Src: paths.full, Dest: target, Status: StatusCreated}
+	if target == paths.full {
+		result.Status = StatusUnchanged
+		return result, nil
+	}
+	if existing, err := os.Readlink(target); err == nil {
+		result.Status = StatusUpdated
+		if existing == paths.link {
+			result.Status = StatusUnchanged
+		}
+	} else if _, err := os.Lstat(target); err == nil {
+		result.Status = StatusUpdated
+	}
+	if result.Status == StatusUnchanged {
+		return result, nil
+	}
+	if options.Diff {
+		result.Diff = fmt.Sprintf("diff %s\nsymlink to %s\n", target, paths.link)
+	}
+	if options.DryRun {
+		return result, nil
+	}
+
+	targetDir := filepath.Dir(target)
+	err := MkdirAllNoUmask(targetDir, options.DirMode, WithOwner(options.uid(), options.gid()))
+	if err != nil {
+		return result, fmt.Errorf("making target dir %q: %w", targetDir, err)
+	}
+
+	// a symlink can not be replaced atomically, so one is created with a
+	// unique name and then renamed over target
+	staged, err := os.CreateTemp(targetDir, "."+filepath.Base(target)+".*")
+	if err != nil {
+		return result, fmt.Errorf("create staged: %w", err)
+	}
+	_ = staged.Close()
+	_ = os.Remove(staged.Name())
+	err = os.Symlink(paths.link, staged.Name())
+	if err != nil {
+		return result, fmt.Errorf("symlink: %w", err)
+	}
+	err = os.Rename(staged.Name(), target)
+	if err != nil {
+		_ = os.Remove(staged.Name())
+		return result, fmt.Errorf("rename staged: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,100 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func findRels(t *testing.T, src string, options TemplateOptions) []string {
+	finder, err := newTemplateFinder(options)
+	require.NoError(t, err)
+	found, err := finder.find(src)
+	require.NoError(t, err)
+	rels := []string{}
+	for _, template := range found {
+		rels = append(rels, filepath.ToSlash(template.rel))
+	}
+	return rels
+}
+
+func TestFindTemplatesIgnore(t *testing.T) {
+	src := t.TempDir()
+	for _, file := range []string{
+		"a.conf", "a.conf~", ".git/config", "vendor/v.conf", "sub/b.conf", "sub/b.bak", "sub/keep.bak",
+	} {
+		require.NoError(t, os.MkdirAll(filepath.Join(src, filepath.Dir(file)), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(src, file), []byte("x"), 0644))
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(src, IgnoreFile), []byte("# vcs\n.git/\n*~\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "sub", IgnoreFile), []byte("*.bak\n!keep.bak\n"), 0644))
+
+	assert.Equal(t,
+		[]string{"a.conf", "sub/b.conf", "sub/keep.bak", "vendor/v.conf"},
+		findRels(t, src, TemplateOptions{}))
+	assert.Equal(t,
+		[]string{"a.conf", "sub/b.conf"},
+		findRels(t, src, TemplateOptions{Exclude: []string{"vendor/", "*.bak"}}))
+	assert.Equal(t,
+		[]string{"sub/b.conf", "sub/keep.bak"},
+		findRels(t, src, TemplateOptions{Include: []string{"sub/*"}}))
+	assert.Equal(t,
+		[]string{"a.conf", "sub/b.conf", "vendor/v.conf"},
+		findRels(t, src, TemplateOptions{Extension: ".conf"}))
+}
+
+func TestFindTemplatesSymlinks(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("symlinks require privileges on windows")
+	}
+	temp := t.TempDir()
+	src := filepath.Join(temp, "src")
+	shared := filepath.Join(temp, "shared")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "real"), 0755))
+	require.NoError(t, os.MkdirAll(shared, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "real", "a.clconf"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(shared, "s.clconf"), []byte("s"), 0644))
+	require.NoError(t, os.Symlink(shared, filepath.Join(src, "linked")))
+	require.NoError(t, os.Symlink("real/a.clconf", filepath.Join(src, "b.clconf")))
+	require.NoError(t, os.Symlink("missing", filepath.Join(src, ".#lock.clconf")))
+	require.NoError(t, os.Symlink("..", filepath.Join(src, "real", "loop")))
+
+	options := TemplateOptions{Extension: ".clconf"}
+	assert.Equal(t,
+		[]string{"b.clconf", "linked/s.clconf", "real/a.clconf"},
+		findRels(t, src, options))
+
+	options.Symlinks = SymlinkSkip
+	assert.Equal(t, []string{"real/a.clconf"}, findRels(t, src, options))
+
+	options.Symlinks = SymlinkCopy
+	assert.Equal(t,
+		[]string{".#lock.clconf", "b.clconf", "linked", "real/a.clconf", "real/loop"},
+		findRels(t, src, options))
+
+	dest := filepath.Join(temp, "dest")
+	options.FileMode = 0644
+	options.DirMode = 0755
+	results, err := ProcessTemplates([]string{src}, dest, nil, nil, options)
+	require.NoError(t, err)
+	require.Len(t, results, 5)
+	link, err := os.Readlink(filepath.Join(dest, "b"))
+	require.NoError(t, err)
+	assert.Equal(t, "real/a.clconf", link)
+	link, err = os.Readlink(filepath.Join(dest, "linked"))
+	require.NoError(t, err)
+	assert.Equal(t, shared, link)
+	content, err := os.ReadFile(filepath.Join(dest, "real", "a"))
+	require.NoError(t, err)
+	assert.Equal(t, "a", string(content))
+
+	results, err = ProcessTemplates([]string{src}, dest, nil, nil, options)
+	require.NoError(t, err)
+	for _, result := range results {
+		assert.Equal(t, StatusUnchanged, result.Status, result.Dest)
+	}
+}
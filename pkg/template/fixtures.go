@@ -0,0 +1,192 @@
+package template
+
+import (
+	"bufio"
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v2"
+)
+
+// Fixtures replace the sources of output that differs between runs (the
+// clock, DNS and the environment) so that templates render reproducibly, ie:
+// for golden tests.
+type Fixtures struct {
+	// Now, if not zero, is returned by datetime instead of the current time.
+	Now time.Time
+	// Hosts, if not nil, resolves lookupIP, lookupIPV4, lookupIPV6 and
+	// lookupSRV instead of DNS.
+	Hosts *Hosts
+	// Env, if not nil, is the environment read by getenv instead of the
+	// process environment.
+	Env map[string]string
+}
+
+// Hosts is a static name resolution table. Names are matched case
+// insensitively, with or without a trailing dot, and names not in it fail to
+// resolve.
+type Hosts struct {
+	// IP maps host names to their addresses.
+	IP map[string][]string `yaml:"ip"`
+	// SRV maps _service._proto.name (or just name when the service and
+	// proto are empty, as with net.LookupSRV) to its records.
+	SRV map[string][]HostsSRV `yaml:"srv"`
+}
+
+// HostsSRV is an SRV record in Hosts.
+type HostsSRV struct {
+	Target   string `yaml:"target"`
+	Port     uint16 `yaml:"port"`
+	Priority uint16 `yaml:"priority"`
+	Weight   uint16 `yaml:"weight"`
+}
+
+// ParseNow parses an RFC 3339 time (ie: 2024-01-02T03:04:05Z) for
+// Fixtures.Now.
+func ParseNow(value string) (time.Time, error) {
+	now, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return now, fmt.Errorf("parse now: %w", err)
+	}
+	return now, nil
+}
+
+// LoadHostsFile reads a yaml Hosts file:
+//
+//	ip:
+//	  db.example.com: [10.0.0.1, "fd00::1"]
+//	srv:
+//	  _ldap._tcp.example.com:
+//	  - {target: ldap.example.com., port: 389, priority: 10, weight: 5}
+func LoadHostsFile(file string) (*Hosts, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read hosts file: %w", err)
+	}
+	hosts := &Hosts{}
+	err = yaml.UnmarshalStrict(content, hosts)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal hosts file %s: %w", file, err)
+	}
+
+	for name, addresses := range hosts.IP {
+		for _, address := range addresses {
+			if net.ParseIP(address) == nil {
+				return nil, fmt.Errorf("hosts file %s: invalid address %q for %s", file, address, name)
+			}
+		}
+	}
+	return hosts, nil
+}
+
+// LoadEnvFile reads an environment from file containing KEY=value lines.
+// Blank lines and lines starting with # are ignored and values are used as
+// is (quotes are not removed).
+func LoadEnvFile(file string) (map[string]string, error) {
+	handle, err := os.Open(file)
+	if err != nil {
+		return nil, fmt.Errorf("open env file: %w", err)
+	}
+	defer func() { _ = handle.Close() }()
+
+	env := map[string]string{}
+	scanner := bufio.NewScanner(handle)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimLeft(scanner.Text(), " \t")
+		if text == "" || strings.HasPrefix(text, "#") {
+			continue
+		}
+		key, value, ok := strings.Cut(text, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("env file %s:%d: expected KEY=value", file, line)
+		}
+		env[key] = value
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read env file: %w", err)
+	}
+	return env, nil
+}
+
+// hostsLookup returns the entry in table for name.
+func hostsLookup[T any](table map[string]T, name string) (T, bool) {
+	if entry, ok := table[name]; ok {
+		return entry, true
+	}
+	name = strings.TrimSuffix(name, ".")
+	for key, entry := range table {
+		if strings.EqualFold(strings.TrimSuffix(key, "."), name) {
+			return entry, true
+		}
+	}
+	var none T
+	return none, false
+}
+
+func (hosts *Hosts) lookupIP(name string) ([]net.IP, error) {
+	addresses, ok := hostsLookup(hosts.IP, name)
+	if !ok {
+		return nil, &net.DNSError{Err: "no such host in hosts file", Name: name, IsNotFound: true}
+	}
+	ips := make([]net.IP, 0, len(addresses))
+	for _, address := range addresses {
+		ips = append(ips, net.ParseIP(address))
+	}
+	return ips, nil
+}
+
+func (hosts *Hosts) lookupSRV(service, proto, name string) (string, []*net.SRV, error) {
+	cname := name
+	if service != "" || proto != "" {
+		cname = "_" + service + "._" + proto + "." + name
+	}
+	records, ok := hostsLookup(hosts.SRV, cname)
+	if !ok {
+		return "", nil, &net.DNSError{Err: "no such host in hosts file", Name: cname, IsNotFound: true}
+	}
+	addrs := make([]*net.SRV, 0, len(records))
+	for _, record := range records {
+		addrs = append(addrs, &net.SRV{
+			Target:   record.Target,
+			Port:     record.Port,
+			Priority: record.Priority,
+			Weight:   record.Weight,
+		})
+	}
+	return cname, addrs, nil
+}
+
+// addFixtureFuncs replaces the functions whose output depends on the clock,
+// DNS or the environment with ones using fixtures.
+func addFixtureFuncs(funcMap map[string]interface{}, fixtures *Fixtures, strict bool) {
+	if !fixtures.Now.IsZero() {
+		now := fixtures.Now
+		funcMap["datetime"] = func() time.Time { return now }
+	}
+	if fixtures.Env == nil && fixtures.Hosts == nil {
+		return
+	}
+
+	resolveIP := net.LookupIP
+	resolveSRV := net.LookupSRV
+	if fixtures.Hosts != nil {
+		resolveIP = fixtures.Hosts.lookupIP
+		resolveSRV = fixtures.Hosts.lookupSRV
+	}
+	addLookupFuncs(funcMap, fixtures.lookupEnv(), resolveIP, resolveSRV, strict)
+}
+
+// lookupEnv returns the function looking up environment variables in Env,
+// or in the process environment if fixtures or Env is nil.
+func (fixtures *Fixtures) lookupEnv() func(string) (string, bool) {
+	if fixtures == nil || fixtures.Env == nil {
+		return os.LookupEnv
+	}
+	return func(key string) (string, bool) {
+		value, ok := fixtures.Env[key]
+		return value, ok
+	}
+}
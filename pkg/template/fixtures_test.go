@@ -0,0 +1,108 @@
+package template_test
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/pastdev/clconf/v3/pkg/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFixtures(t *testing.T) {
+	t.Setenv("CLCONF_FIXTURES_PROCESS", "process")
+	temp := t.TempDir()
+	hostsFile := filepath.Join(temp, "hosts.yml")
+	require.NoError(t, os.WriteFile(hostsFile, []byte(`ip:
+  DB.example.com.: [10.0.0.2, 10.0.0.1, "fd00::1"]
+srv:
+  _ldap._tcp.example.com:
+  - {target: b.example.com., port: 389, priority: 20, weight: 5}
+  - {target: a.example.com., port: 389, priority: 10, weight: 5}
+`), 0644))
+	envFile := filepath.Join(temp, "test.env")
+	require.NoError(t, os.WriteFile(envFile, []byte("# comment\n\nFOO=bar=baz\nEMPTY=\n"), 0644))
+
+	hosts, err := template.LoadHostsFile(hostsFile)
+	require.NoError(t, err)
+	env, err := template.LoadEnvFile(envFile)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"FOO": "bar=baz", "EMPTY": ""}, env)
+	now, err := template.ParseNow("2024-01-02T03:04:05Z")
+	require.NoError(t, err)
+	fixtures := &template.Fixtures{Now: now, Hosts: hosts, Env: env}
+
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+		err      string
+	}{
+		{name: "datetime", text: `{{ (datetime).Format "2006-01-02 15:04:05" }}`, expected: "2024-01-02 03:04:05"},
+		{name: "getenv", text: `{{ getenv "FOO" }}`, expected: "bar=baz"},
+		{name: "getenv isolated", text: `{{ getenv "CLCONF_FIXTURES_PROCESS" "default" }}`, expected: "default"},
+		{name: "lookupIP", text: `{{ lookupIP "db.example.com" }}`, expected: "[10.0.0.1 10.0.0.2 fd00::1]"},
+		{name: "lookupIPV4", text: `{{ lookupIPV4 "db.example.com" }}`, expected: "[10.0.0.1 10.0.0.2]"},
+		{name: "lookupIPV6", text: `{{ lookupIPV6 "db.example.com." }}`, expected: "[fd00::1]"},
+		{
+			name:     "lookupSRV",
+			text:     `{{ range lookupSRV "ldap" "tcp" "example.com" }}{{ .Target }}:{{ .Port }} {{ end }}`,
+			expected: "a.example.com.:389 b.example.com.:389 ",
+		},
+		{name: "unknown host", text: `{{ lookupIP "clconf.invalid" }}`, expected: "[]", err: "no such host"},
+		{name: "unset strict", text: `{{ getenv "CLCONF_FIXTURES_PROCESS" }}`, expected: "", err: "is not set"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl, err := template.NewTemplate(test.name, test.text, &template.TemplateConfig{Fixtures: fixtures})
+			require.NoError(t, err)
+			actual, err := tmpl.Execute(nil)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+
+			tmpl, err = template.NewTemplate(test.name, test.text,
+				&template.TemplateConfig{Fixtures: fixtures, Strict: true})
+			require.NoError(t, err)
+			actual, err = tmpl.Execute(nil)
+			if test.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestFixturesPartial(t *testing.T) {
+	t.Setenv("CLCONF_FIXTURES_PROCESS", "process")
+	tmpl, err := template.NewTemplate("partial", `{{ getenv "CLCONF_FIXTURES_PROCESS" }} {{ (datetime).Year }}`,
+		&template.TemplateConfig{Fixtures: &template.Fixtures{Now: time.Date(1999, 1, 1, 0, 0, 0, 0, time.UTC)}})
+	require.NoError(t, err)
+	actual, err := tmpl.Execute(nil)
+	require.NoError(t, err)
+	assert.Equal(t, "process 1999", actual)
+}
+
+func TestLoadFixtureFilesInvalid(t *testing.T) {
+	temp := t.TempDir()
+	file := filepath.Join(temp, "invalid")
+
+	require.NoError(t, os.WriteFile(file, []byte("ip:\n  db: [not-an-ip]\n"), 0644))
+	_, err := template.LoadHostsFile(file)
+	assert.ErrorContains(t, err, "invalid address")
+
+	require.NoError(t, os.WriteFile(file, []byte("hosts: {}\n"), 0644))
+	_, err = template.LoadHostsFile(file)
+	assert.Error(t, err, "unknown field")
+
+	require.NoError(t, os.WriteFile(file, []byte("FOO=bar\nBAZ\n"), 0644))
+	_, err = template.LoadEnvFile(file)
+	assert.ErrorContains(t, err, ":2:")
+
+	_, err = template.ParseNow("yesterday")
+	assert.Error(t, err)
+}
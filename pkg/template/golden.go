@@ -0,0 +1,335 @@
+package template
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/pastdev/clconf/v3/pkg/secret"
+	"github.com/pastdev/clconf/v3/pkg/yamljson"
+	"github.com/pmezard/go-difflib/difflib"
+	"gopkg.in/yaml.v2"
+)
+
+// TestCaseTemplate, TestCaseInput, TestCaseExpected and TestCaseError are the
+// files of a folder test case: a folder containing TestCaseTemplate is
+// rendered with the config in TestCaseInput (if any) and must produce the
+// content of TestCaseExpected or fail with an error containing the content of
+// TestCaseError.
+const (
+	TestCaseTemplate = "template.clconf"
+	TestCaseInput    = "input.yml"
+	TestCaseExpected = "expected"
+	TestCaseError    = "error"
+)
+
+// TestSpecExtensions are the extensions of test spec files (see TestSpec).
+var TestSpecExtensions = []string{".test.yml", ".test.yaml"}
+
+// TestSpec is a yaml file listing test cases. Relative files are relative to
+// the folder of the spec.
+type TestSpec struct {
+	Tests []TestCase `yaml:"tests"`
+}
+
+// TestCase is a template, the config to render it with and its expected
+// output or error.
+type TestCase struct {
+	Name string `yaml:"name"`
+	// Template is the template text (or see TemplateFile).
+	Template     string `yaml:"template"`
+	TemplateFile string `yaml:"template_file"`
+	// Config is merged over the ConfigFiles.
+	Config      interface{} `yaml:"config"`
+	ConfigFiles []string    `yaml:"config_files"`
+	Prefix      string      `yaml:"prefix"`
+	// Expected is the expected output (or see ExpectedFile).
+	Expected     *string `yaml:"expected"`
+	ExpectedFile string  `yaml:"expected_file"`
+	// Error, if not empty, is a substring of the error the template must
+	// fail with.
+	Error string `yaml:"error"`
+	// Env is the environment read by getenv, the process environment is
+	// never read.
+	Env map[string]string `yaml:"env"`
+	// Now, if not empty, is the RFC 3339 time returned by datetime.
+	Now string `yaml:"now"`
+	// Hosts, if not nil, resolves the DNS lookup functions.
+	Hosts *Hosts `yaml:"hosts"`
+
+	// dir is the folder relative files are relative to.
+	dir string
+}
+
+// TestOptions are settings for RunTests.
+type TestOptions struct {
+	SecretAgent *secret.SecretAgent
+	// LibraryDirs are loaded as TemplateOptions.LibraryDirs.
+	LibraryDirs []string
+	Strict      bool
+}
+
+// TestResult is the outcome of a TestCase.
+type TestResult struct {
+	Name     string
+	Passed   bool
+	Duration time.Duration
+	// Message explains why the test failed.
+	Message string
+	// Diff is a unified diff from the expected to the actual output.
+	Diff string
+}
+
+// DiscoverTests returns the test cases under dir: a test case for each folder
+// containing TestCaseTemplate and those listed in each TestSpecExtensions
+// file. Test cases are named by their path relative to dir.
+func DiscoverTests(dir string) ([]TestCase, error) {
+	cases := []TestCase{}
+	err := filepath.WalkDir(dir, func(file string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(dir, file)
+		if err != nil {
+			return fmt.Errorf("relative test path: %w", err)
+		}
+		rel = filepath.ToSlash(rel)
+		if rel == "." {
+			rel = filepath.Base(filepath.Clean(dir))
+		}
+
+		if entry.IsDir() {
+			if _, err := os.Stat(filepath.Join(file, TestCaseTemplate)); err != nil {
+				return nil
+			}
+			testCase, err := folderTestCase(file, rel)
+			if err != nil {
+				return err
+			}
+			cases = append(cases, testCase)
+			return nil
+		}
+
+		if !isTestSpec(entry.Name()) {
+			return nil
+		}
+		specCases, err := readTestSpec(file, rel)
+		if err != nil {
+			return err
+		}
+		cases = append(cases, specCases...)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("discover tests: %w", err)
+	}
+	return cases, nil
+}
+
+func isTestSpec(name string) bool {
+	for _, extension := range TestSpecExtensions {
+		if strings.HasSuffix(name, extension) {
+			return true
+		}
+	}
+	return false
+}
+
+// folderTestCase returns the test case for the folder dir.
+func folderTestCase(dir, name string) (TestCase, error) {
+	testCase := TestCase{Name: name, TemplateFile: TestCaseTemplate, dir: dir}
+	if _, err := os.Stat(filepath.Join(dir, TestCaseInput)); err == nil {
+		testCase.ConfigFiles = []string{TestCaseInput}
+	}
+	if _, err := os.Stat(filepath.Join(dir, TestCaseExpected)); err == nil {
+		testCase.ExpectedFile = TestCaseExpected
+	}
+	content, err := os.ReadFile(filepath.Join(dir, TestCaseError))
+	if err != nil && !os.IsNotExist(err) {
+		return testCase, fmt.Errorf("read expected error: %w", err)
+	}
+	testCase.Error = strings.TrimSpace(string(content))
+	return testCase, nil
+}
+
+// readTestSpec returns the test cases in the spec file. Unnamed test cases
+// are named by their index.
+func readTestSpec(file, rel string) ([]TestCase, error) {
+	content, err := os.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("read test spec: %w", err)
+	}
+	var spec TestSpec
+	err = yaml.UnmarshalStrict(content, &spec)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal test spec %s: %w", file, err)
+	}
+	for i := range spec.Tests {
+		name := spec.Tests[i].Name
+		if name == "" {
+			name = fmt.Sprintf("%d", i+1)
+		}
+		spec.Tests[i].Name = rel + ": " + name
+		spec.Tests[i].dir = filepath.Dir(file)
+	}
+	return spec.Tests, nil
+}
+
+// RunTests runs each test case.
+func RunTests(cases []TestCase, options TestOptions) ([]TestResult, error) {
+	libraries, err := LoadLibraries(options.LibraryDirs...)
+	if err != nil {
+		return nil, err
+	}
+	results := make([]TestResult, 0, len(cases))
+	for _, testCase := range cases {
+		start := time.Now()
+		result := testCase.run(libraries, options)
+		result.Duration = time.Since(start)
+		results = append(results, result)
+	}
+	return results, nil
+}
+
+func (testCase TestCase) path(file string) string {
+	if filepath.IsAbs(file) {
+		return file
+	}
+	return filepath.Join(testCase.dir, file)
+}
+
+func (testCase TestCase) run(libraries map[string]string, options TestOptions) TestResult {
+	result := TestResult{Name: testCase.Name}
+	fail := func(format string, args ...interface{}) TestResult {
+		result.Message = fmt.Sprintf(format, args...)
+		return result
+	}
+
+	text := testCase.Template
+	if testCase.TemplateFile != "" {
+		content, err := os.ReadFile(testCase.path(testCase.TemplateFile))
+		if err != nil {
+			return fail("read template: %v", err)
+		}
+		text = string(content)
+	}
+	value, err := testCase.config()
+	if err != nil {
+		return fail("%v", err)
+	}
+	expected, err := testCase.expected()
+	if err != nil {
+		return fail("%v", err)
+	}
+	fixtures, err := testCase.fixtures()
+	if err != nil {
+		return fail("%v", err)
+	}
+
+	actual, err := func() (string, error) {
+		tmpl, err := NewTemplate(testCase.Name, text, &TemplateConfig{
+			Prefix:      testCase.Prefix,
+			SecretAgent: options.SecretAgent,
+			Libraries:   libraries,
+			Strict:      options.Strict,
+			Fixtures:    fixtures,
+		})
+		if err != nil {
+			return "", err
+		}
+		return tmpl.Execute(value)
+	}()
+
+	switch {
+	case testCase.Error != "" && err == nil:
+		return fail("expected an error containing %q", testCase.Error)
+	case testCase.Error != "" && !strings.Contains(err.Error(), testCase.Error):
+		return fail("expected an error containing %q, got: %v", testCase.Error, err)
+	case testCase.Error != "":
+	case err != nil:
+		return fail("%v", err)
+	case expected == nil:
+		return fail("no expected output or error")
+	case actual != *expected:
+		result.Diff, _ = difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+			A:        splitLines([]byte(*expected)),
+			B:        splitLines([]byte(actual)),
+			FromFile: "expected",
+			ToFile:   "actual",
+			Context:  3,
+		})
+		return fail("output differs from expected")
+	}
+	result.Passed = true
+	return result
+}
+
+// config returns the Config merged over the ConfigFiles.
+func (testCase TestCase) config() (interface{}, error) {
+	docs := []interface{}{}
+	for _, file := range testCase.ConfigFiles {
+		content, err := os.ReadFile(testCase.path(file))
+		if err != nil {
+			return nil, fmt.Errorf("read config: %w", err)
+		}
+		value, err := yamljson.UnmarshalYamlInterface(string(content))
+		if err != nil {
+			return nil, fmt.Errorf("config %s: %w", file, err)
+		}
+		docs = append(docs, value)
+	}
+	if testCase.Config != nil {
+		docs = append(docs, testCase.Config)
+	}
+	if len(docs) == 0 {
+		return map[interface{}]interface{}{}, nil
+	}
+	value, err := yamljson.MergeInterfaces(docs...)
+	if err != nil {
+		return nil, fmt.Errorf("merge config: %w", err)
+	}
+	return value, nil
+}
+
+func (testCase TestCase) expected() (*string, error) {
+	if testCase.ExpectedFile == "" {
+		return testCase.Expected, nil
+	}
+	content, err := os.ReadFile(testCase.path(testCase.ExpectedFile))
+	if err != nil {
+		return nil, fmt.Errorf("read expected: %w", err)
+	}
+	expected := string(content)
+	return &expected, nil
+}
+
+// fixtures isolates the test case from the process environment, and if set,
+// the clock and DNS.
+func (testCase TestCase) fixtures() (*Fixtures, error) {
+	fixtures := &Fixtures{Env: testCase.Env, Hosts: testCase.Hosts}
+	if fixtures.Env == nil {
+		fixtures.Env = map[string]string{}
+	}
+	if testCase.Now != "" {
+		now, err := ParseNow(testCase.Now)
+		if err != nil {
+			return nil, err
+		}
+		fixtures.Now = now
+	}
+	return fixtures, nil
+}
+
+// FailedTests returns the number of results that did not pass.
+func FailedTests(results []TestResult) int {
+	failed := 0
+	for _, result := range results {
+		if !result.Passed {
+			failed++
+		}
+	}
+	return failed
+}
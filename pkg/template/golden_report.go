@@ -0,0 +1,156 @@
+package template
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+// TestReportFormat is the format WriteTestReport writes results in.
+type TestReportFormat string
+
+const (
+	// TestReportText lists each result followed by the reason and diff of
+	// failures.
+	TestReportText TestReportFormat = "text"
+	// TestReportTAP is the Test Anything Protocol (version 13).
+	TestReportTAP TestReportFormat = "tap"
+	// TestReportJUnit is JUnit XML as read by most CI servers.
+	TestReportJUnit TestReportFormat = "junit"
+)
+
+// ParseTestReportFormat validates format.
+func ParseTestReportFormat(format string) (TestReportFormat, error) {
+	switch f := TestReportFormat(format); f {
+	case TestReportText, TestReportTAP, TestReportJUnit:
+		return f, nil
+	}
+	return "", fmt.Errorf("invalid test report format %q (must be text, tap or junit)", format)
+}
+
+// WriteTestReport writes results to w in format. Name is the JUnit test
+// suite name.
+func WriteTestReport(w io.Writer, format TestReportFormat, name string, results []TestResult) error {
+	var err error
+	switch format {
+	case TestReportTAP:
+		err = writeTestTAP(w, results)
+	case TestReportJUnit:
+		err = writeTestJUnit(w, name, results)
+	case TestReportText:
+		err = writeTestText(w, results)
+	default:
+		return fmt.Errorf("invalid test report format %q", format)
+	}
+	if err != nil {
+		return fmt.Errorf("write test report: %w", err)
+	}
+	return nil
+}
+
+func writeTestText(w io.Writer, results []TestResult) error {
+	var buf strings.Builder
+	for _, result := range results {
+		if result.Passed {
+			fmt.Fprintf(&buf, "PASS %s\n", result.Name)
+			continue
+		}
+		fmt.Fprintf(&buf, "FAIL %s: %s\n", result.Name, result.Message)
+		buf.WriteString(result.Diff)
+	}
+	fmt.Fprintf(&buf, "%d passed, %d failed\n", len(results)-FailedTests(results), FailedTests(results))
+	_, err := io.WriteString(w, buf.String())
+	return err //nolint:wrapcheck // wrapped by WriteTestReport
+}
+
+func writeTestTAP(w io.Writer, results []TestResult) error {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "TAP version 13\n1..%d\n", len(results))
+	for i, result := range results {
+		status := "ok"
+		if !result.Passed {
+			status = "not ok"
+		}
+		fmt.Fprintf(&buf, "%s %d - %s\n", status, i+1, tapEscape(result.Name))
+		if result.Passed {
+			continue
+		}
+		buf.WriteString("  ---\n")
+		writeYAMLBlock(&buf, "message", result.Message)
+		if result.Diff != "" {
+			writeYAMLBlock(&buf, "diff", result.Diff)
+		}
+		buf.WriteString("  ...\n")
+	}
+	_, err := io.WriteString(w, buf.String())
+	return err //nolint:wrapcheck // wrapped by WriteTestReport
+}
+
+// tapEscape escapes the characters with meaning in a TAP description.
+func tapEscape(name string) string {
+	return strings.NewReplacer(`\`, `\\`, "#", `\#`, "\n", " ").Replace(name)
+}
+
+// writeYAMLBlock writes a literal block scalar in a TAP YAML diagnostic.
+func writeYAMLBlock(buf *strings.Builder, key, value string) {
+	fmt.Fprintf(buf, "  %s: |-\n", key)
+	for _, line := range strings.Split(strings.TrimRight(value, "\n"), "\n") {
+		fmt.Fprintf(buf, "    %s\n", line)
+	}
+}
+
+type junitTestSuites struct {
+	XMLName xml.Name         `xml:"testsuites"`
+	Suites  []junitTestSuite `xml:"testsuite"`
+}
+
+type junitTestSuite struct {
+	Name     string          `xml:"name,attr"`
+	Tests    int             `xml:"tests,attr"`
+	Failures int             `xml:"failures,attr"`
+	Time     string          `xml:"time,attr"`
+	Cases    []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name    string        `xml:"name,attr"`
+	Time    string        `xml:"time,attr"`
+	Failure *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Content string `xml:",chardata"`
+}
+
+func writeTestJUnit(w io.Writer, name string, results []TestResult) error {
+	suite := junitTestSuite{
+		Name:     name,
+		Tests:    len(results),
+		Failures: FailedTests(results),
+		Cases:    make([]junitTestCase, 0, len(results)),
+	}
+	var total time.Duration
+	for _, result := range results {
+		total += result.Duration
+		testCase := junitTestCase{Name: result.Name, Time: junitSeconds(result.Duration)}
+		if !result.Passed {
+			testCase.Failure = &junitFailure{Message: result.Message, Content: result.Diff}
+		}
+		suite.Cases = append(suite.Cases, testCase)
+	}
+	suite.Time = junitSeconds(total)
+
+	content, err := xml.MarshalIndent(junitTestSuites{Suites: []junitTestSuite{suite}}, "", "  ")
+	if err != nil {
+		return err //nolint:wrapcheck // wrapped by WriteTestReport
+	}
+	_, err = io.WriteString(w, xml.Header+string(content)+"\n")
+	return err //nolint:wrapcheck // wrapped by WriteTestReport
+}
+
+func junitSeconds(duration time.Duration) string {
+	return fmt.Sprintf("%.3f", duration.Seconds())
+}
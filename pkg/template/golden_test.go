@@ -0,0 +1,109 @@
+package template_test
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/pastdev/clconf/v3/pkg/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeGoldenTests(t *testing.T) string {
+	dir := t.TempDir()
+	folder := filepath.Join(dir, "folder")
+	require.NoError(t, os.MkdirAll(folder, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(folder, template.TestCaseTemplate),
+		[]byte(`{{ getv "/server/host" }}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(folder, template.TestCaseInput),
+		[]byte("server:\n  host: a.example.com\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(folder, template.TestCaseExpected),
+		[]byte("a.example.com"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "base.yml"),
+		[]byte("server:\n  host: b.example.com\n  port: 80\n"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "spec.test.yml"), []byte(`tests:
+- name: merged config
+  template: '{{ getv "/server/host" }}:{{ getv "/server/port" }}'
+  config_files: [base.yml]
+  config: {server: {port: 8080}}
+  expected: "b.example.com:8080"
+- name: isolated env
+  template: '[{{ getenv "HOME" }}][{{ getenv "STAGE" }}]'
+  env: {STAGE: test}
+  expected: "[][test]"
+- name: expected error
+  template: '{{ getv "/missing" }}'
+  error: key does not exist
+- name: unexpected success
+  template: 'ok'
+  error: key does not exist
+- name: diff
+  template: "a\nb\n"
+  expected: "a\nc\n"
+- template: '{{ (datetime).Year }} {{ lookupIPV4 "db" }}'
+  now: 2020-01-01T00:00:00Z
+  hosts: {ip: {db: [10.0.0.1, "fd00::1"]}}
+  expected: "2020 [10.0.0.1]"
+`), 0644))
+	return dir
+}
+
+func TestGoldenTests(t *testing.T) {
+	dir := writeGoldenTests(t)
+	cases, err := template.DiscoverTests(dir)
+	require.NoError(t, err)
+	results, err := template.RunTests(cases, template.TestOptions{})
+	require.NoError(t, err)
+
+	passed := map[string]bool{}
+	for _, result := range results {
+		passed[result.Name] = result.Passed
+	}
+	assert.Equal(t, map[string]bool{
+		"folder":                            true,
+		"spec.test.yml: merged config":      true,
+		"spec.test.yml: isolated env":       true,
+		"spec.test.yml: expected error":     true,
+		"spec.test.yml: unexpected success": false,
+		"spec.test.yml: diff":               false,
+		"spec.test.yml: 6":                  true,
+	}, passed)
+	assert.Equal(t, 2, template.FailedTests(results))
+	assert.Equal(t, "--- expected\n+++ actual\n@@ -1,2 +1,2 @@\n a\n-c\n+b\n", results[5].Diff)
+}
+
+func TestWriteTestReport(t *testing.T) {
+	results := []template.TestResult{
+		{Name: "a # b", Passed: true},
+		{Name: "c", Message: "output differs from expected", Diff: "-x\n+y\n"},
+	}
+
+	var buf strings.Builder
+	require.NoError(t, template.WriteTestReport(&buf, template.TestReportTAP, "suite", results))
+	assert.Equal(t, `TAP version 13
+1..2
+ok 1 - a \# b
+not ok 2 - c
+  ---
+  message: |-
+    output differs from expected
+  diff: |-
+    -x
+    +y
+  ...
+`, buf.String())
+
+	buf.Reset()
+	require.NoError(t, template.WriteTestReport(&buf, template.TestReportJUnit, "suite", results))
+	assert.Contains(t, buf.String(), `<testsuite name="suite" tests="2" failures="1" time="0.000">`)
+	assert.Contains(t, buf.String(), `<failure message="output differs from expected">-x&#xA;+y&#xA;</failure>`)
+
+	buf.Reset()
+	require.NoError(t, template.WriteTestReport(&buf, template.TestReportText, "suite", results))
+	assert.Equal(t, "PASS a # b\nFAIL c: output differs from expected\n-x\n+y\n1 passed, 1 failed\n", buf.String())
+
+	_, err := template.ParseTestReportFormat("xml")
+	assert.Error(t, err)
+}
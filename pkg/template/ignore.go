@@ -0,0 +1,179 @@
+package template
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IgnoreFile is the name of the file, in any source folder, listing the files
+// under it that are not templates using gitignore syntax.
+const IgnoreFile = ".clconfignore"
+
+// pathPattern is a single gitignore style pattern.
+type pathPattern struct {
+	// base is the slash separated folder, relative to the source, that the
+	// pattern is relative to.
+	base    string
+	dirOnly bool
+	negate  bool
+	regex   *regexp.Regexp
+}
+
+// newPathPattern parses a gitignore style pattern. A pattern without a slash
+// (other than a trailing one) matches a name at any depth, otherwise it is
+// anchored to base. * and ? do not match /, while ** matches any number of
+// folders.
+func newPathPattern(base, pattern string) (pathPattern, error) {
+	p := pathPattern{base: base}
+	if strings.HasPrefix(pattern, "!") {
+		p.negate = true
+		pattern = pattern[1:]
+	}
+	if strings.HasSuffix(pattern, "/") {
+		p.dirOnly = true
+		pattern = strings.TrimRight(pattern, "/")
+	}
+	anchored := strings.Contains(pattern, "/")
+	pattern = strings.TrimPrefix(pattern, "/")
+
+	var regex strings.Builder
+	regex.WriteString("^")
+	if !anchored {
+		regex.WriteString("(?:.*/)?")
+	}
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if strings.HasPrefix(pattern[i:], "**") {
+				switch {
+				case strings.HasPrefix(pattern[i:], "**/"):
+					regex.WriteString("(?:.*/)?")
+					i += 2
+				case i+2 == len(pattern):
+					regex.WriteString(".*")
+					i++
+				default:
+					regex.WriteString("[^/]*")
+					i++
+				}
+				continue
+			}
+			regex.WriteString("[^/]*")
+		case '?':
+			regex.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				regex.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			regex.WriteString("[" + class + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				regex.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			regex.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	regex.WriteString("$")
+
+	var err error
+	p.regex, err = regexp.Compile(regex.String())
+	if err != nil {
+		return p, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+	}
+	return p, nil
+}
+
+// match returns true if the slash separated rel, relative to the source,
+// matches the pattern.
+func (p pathPattern) match(rel string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(rel, p.base+"/") {
+			return false
+		}
+		rel = rel[len(p.base)+1:]
+	}
+	return p.regex.MatchString(rel)
+}
+
+// pathPatterns are evaluated in order, the last matching pattern wins.
+type pathPatterns []pathPattern
+
+func newPathPatterns(patterns []string) (pathPatterns, error) {
+	result := make(pathPatterns, 0, len(patterns))
+	for _, pattern := range patterns {
+		p, err := newPathPattern("", pattern)
+		if err != nil {
+			return nil, err
+		}
+		result = append(result, p)
+	}
+	return result, nil
+}
+
+// readIgnoreFile returns the patterns in the IgnoreFile in dir (if any), where
+// base is the slash separated path of dir relative to the source.
+func readIgnoreFile(dir, base string) (pathPatterns, error) {
+	file, err := os.Open(filepath.Join(dir, IgnoreFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("open ignore file: %w", err)
+	}
+	defer func() { _ = file.Close() }()
+
+	result := pathPatterns{}
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		p, err := newPathPattern(base, line)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", filepath.Join(dir, IgnoreFile), err)
+		}
+		result = append(result, p)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("read ignore file: %w", err)
+	}
+	return result, nil
+}
+
+// ignored returns true if the last pattern matching rel is not negated.
+func (patterns pathPatterns) ignored(rel string, isDir bool) bool {
+	ignored := false
+	for _, p := range patterns {
+		if p.match(rel, isDir) {
+			ignored = !p.negate
+		}
+	}
+	return ignored
+}
+
+// matches returns true if any pattern matches rel.
+func (patterns pathPatterns) matches(rel string, isDir bool) bool {
+	for _, p := range patterns {
+		if p.match(rel, isDir) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,60 @@
+package template
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPathPattern(t *testing.T) {
+	tests := []struct {
+		base    string
+		pattern string
+		rel     string
+		isDir   bool
+		match   bool
+	}{
+		{"", "*~", "a~", false, true},
+		{"", "*~", "x/y/a~", false, true},
+		{"", "*.bak", "a.bak/b", false, false},
+		{"", "/a", "a", false, true},
+		{"", "/a", "x/a", false, false},
+		{"", "x/a", "x/a", false, true},
+		{"", "x/a", "y/x/a", false, false},
+		{"", "vendor/", "vendor", true, true},
+		{"", "vendor/", "vendor", false, false},
+		{"", "**/c", "a/b/c", false, true},
+		{"", "**/c", "c", false, true},
+		{"", "a/**", "a/b/c", false, true},
+		{"", "a/**/c", "a/c", false, true},
+		{"", "a/**/c", "a/b/d/c", false, true},
+		{"", "?.txt", "a.txt", false, true},
+		{"", "?.txt", "ab.txt", false, false},
+		{"", "[ab].txt", "b.txt", false, true},
+		{"", "[!ab].txt", "b.txt", false, false},
+		{"", `\#a`, "#a", false, true},
+		{"sub", "a", "sub/x/a", false, true},
+		{"sub", "a", "a", false, false},
+		{"sub", "/a", "sub/a", false, true},
+		{"sub", "/a", "sub/x/a", false, false},
+	}
+	for _, test := range tests {
+		p, err := newPathPattern(test.base, test.pattern)
+		require.NoError(t, err)
+		assert.Equal(t, test.match, p.match(test.rel, test.isDir),
+			"%s in %q matching %s", test.pattern, test.base, test.rel)
+	}
+}
+
+func TestPathPatternsIgnored(t *testing.T) {
+	patterns := pathPatterns{}
+	for _, pattern := range []string{"*.conf", "!keep.conf"} {
+		p, err := newPathPattern("", pattern)
+		require.NoError(t, err)
+		patterns = append(patterns, p)
+	}
+	assert.True(t, patterns.ignored("a/drop.conf", false))
+	assert.False(t, patterns.ignored("a/keep.conf", false))
+	assert.False(t, patterns.ignored("a/other", false))
+}
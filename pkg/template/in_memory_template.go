@@ -3,8 +3,11 @@ package template
 import (
 	"bytes"
 	"encoding/base64"
+	"errors"
 	"fmt"
+	"io"
 	"os"
+	"sort"
 	"text/template"
 
 	"github.com/pastdev/clconf/v3/pkg/core"
@@ -12,18 +15,50 @@ import (
 	"github.com/pastdev/clconf/v3/pkg/secret"
 )
 
+// maxIncludeDepth is how deeply include calls can nest, like Helm, so that a
+// template that includes itself fails rather than overflowing the stack.
+const maxIncludeDepth = 1000
+
+// ErrIncludeDepth is returned when include calls nest more than
+// maxIncludeDepth deep.
+var ErrIncludeDepth = errors.New("include nested too deeply")
+
 // TemplateConfig allows for optional configuration.
 type TemplateConfig struct { //nolint:revive
 	Prefix      string
 	SecretAgent *secret.SecretAgent
 	LeftDelim   string
 	RightDelim  string
+	// Libraries are template texts, keyed by name, parsed as associated
+	// templates so that the templates they define are available to the
+	// template action and the include function.
+	Libraries map[string]string
+	// Strict fails the template, instead of producing empty output, when a
+	// map key is missing, getenv is called without a default for an unset
+	// variable, or a DNS lookup fails.
+	Strict bool
+	// Fixtures, if not nil, replace the clock, DNS and environment used by
+	// datetime, the lookup functions and getenv.
+	Fixtures *Fixtures
+	// Sandbox, if not nil, restricts the functions available to templates
+	// from untrusted sources and limits their execution.
+	Sandbox *Sandbox
+	// Outputs enables the output function which splits the result into
+	// several files (only supported by ProcessTemplates).
+	Outputs bool
 }
 
 // Template is a wrapper for template.Template to include custom template
 // functions corresponding to confd functions.
 type Template struct {
-	config   *TemplateConfig
+	// abandoned is set when a sandboxed execution timed out while still
+	// running.
+	abandoned    bool
+	config       *TemplateConfig
+	dependencies *dependencyRecorder
+	// limits is set if the template is sandboxed.
+	limits   *sandboxLimits
+	outputs  *outputSplitter
 	store    *memkv.Store
 	template *template.Template
 }
@@ -88,27 +123,93 @@ func NewTemplate(name, text string, config *TemplateConfig) (*Template, error) {
 		config = &TemplateConfig{}
 	}
 
-	store := memkv.New()
+	dependencies := newDependencyRecorder(config.Prefix)
+	store := memkv.New(memkv.WithAccessRecorder(dependencies.record))
 
 	funcMap := NewFuncMap(&store)
 	AddFuncs(funcMap, store.FuncMap)
 	if config.SecretAgent != nil {
 		addCryptFuncs(funcMap, config.SecretAgent)
 	}
+	if config.Strict {
+		addStrictFuncs(funcMap)
+	}
+	if config.Fixtures != nil {
+		addFixtureFuncs(funcMap, config.Fixtures, config.Strict)
+	}
+
+	outputs := newOutputSplitter(config.Outputs)
+	funcMap["output"] = outputs.output
+
+	var limits *sandboxLimits
+	if config.Sandbox != nil {
+		limits = &sandboxLimits{sandbox: config.Sandbox}
+	}
+
+	var tmpl *template.Template
+	includeDepth := 0
+	funcMap["include"] = func(name string, data interface{}) (string, error) {
+		if includeDepth >= maxIncludeDepth {
+			return "", fmt.Errorf("include %s: %w (max %d)", name, ErrIncludeDepth, maxIncludeDepth)
+		}
+		includeDepth++
+		defer func() { includeDepth-- }()
+
+		var buf bytes.Buffer
+		var w io.Writer = &buf
+		if limits != nil {
+			w = limits.writer(&buf)
+		}
+		if err := tmpl.ExecuteTemplate(w, name, data); err != nil {
+			if errors.Is(err, ErrIncludeDepth) {
+				// the error of each nested include would otherwise be
+				// repeated in the message maxIncludeDepth times
+				return "", fmt.Errorf("include %s: %w (max %d)", name, ErrIncludeDepth, maxIncludeDepth)
+			}
+			return "", fmt.Errorf("include %s: %w", name, err)
+		}
+		return buf.String(), nil
+	}
+
+	if limits != nil {
+		err := applySandbox(funcMap, limits, config.Fixtures, config.Strict)
+		if err != nil {
+			return nil, err
+		}
+	}
 
-	tmpl, err := template.
+	tmpl = template.
 		New(name).
 		Delims(config.LeftDelim, config.RightDelim).
-		Funcs(funcMap).
-		Parse(text)
+		Funcs(funcMap)
+	if config.Strict {
+		tmpl.Option("missingkey=error")
+	}
+
+	libraryNames := make([]string, 0, len(config.Libraries))
+	for libraryName := range config.Libraries {
+		libraryNames = append(libraryNames, libraryName)
+	}
+	sort.Strings(libraryNames)
+	for _, libraryName := range libraryNames {
+		_, err := tmpl.New(libraryName).Parse(config.Libraries[libraryName])
+		if err != nil {
+			return nil, fmt.Errorf("process library %s: %w", libraryName, err)
+		}
+	}
+
+	_, err := tmpl.Parse(text)
 	if err != nil {
 		return nil, fmt.Errorf("process template %s: %w", name, err)
 	}
 
 	return &Template{
-		config:   config,
-		store:    &store,
-		template: tmpl,
+		config:       config,
+		dependencies: dependencies,
+		limits:       limits,
+		outputs:      outputs,
+		store:        &store,
+		template:     tmpl,
 	}, nil
 }
 
@@ -133,21 +234,41 @@ func NewTemplateFromFile(name, file string, config *TemplateConfig) (*Template,
 // Execute will process the template text using data and the function map from
 // confd.
 func (tmpl *Template) Execute(data interface{}) (string, error) {
+	if tmpl.abandoned {
+		return "", fmt.Errorf("execute template: %w previously", ErrTimeout)
+	}
 	tmpl.setVars(data)
+	tmpl.dependencies.reset()
+	tmpl.outputs.reset()
 
 	var buf bytes.Buffer
-	if err := tmpl.template.Execute(&buf, nil); err != nil {
+	var err error
+	if tmpl.config.Sandbox != nil {
+		err = tmpl.executeSandboxed(&buf)
+	} else {
+		err = tmpl.template.Execute(&buf, nil)
+	}
+	if err != nil {
 		return "", fmt.Errorf("execute template: %w", err)
 	}
 
 	return buf.String(), nil
 }
 
+// splitOutputs separates the content of the last Execute written to the
+// template result from the content written to each output.
+func (tmpl *Template) splitOutputs(content string) (string, []templateOutput, error) {
+	return tmpl.outputs.split(content)
+}
+
+// Dependencies returns the config keys read by the last Execute.
+func (tmpl *Template) Dependencies() Dependencies {
+	return tmpl.dependencies.dependencies()
+}
+
 // ///// mapped to confd resource.go ///////
 func (tmpl *Template) setVars(data interface{}) {
 	value, _ := core.GetValue(data, tmpl.config.Prefix)
 	tmpl.store.Purge()
-	for k, v := range core.ToKvMap(value) {
-		tmpl.store.Set(k, v)
-	}
+	tmpl.store.Fill(value)
 }
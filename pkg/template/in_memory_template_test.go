@@ -61,4 +61,16 @@ func TestExecute(t *testing.T) {
 			},
 		},
 		"foobaz")
+	testExecute(t, "typed values",
+		"{{ getint \"/port\" | add 1 }} {{ if getbool \"/debug\" }}debug{{ end }} "+
+			"{{ range getlist \"/hosts\" }}{{ . }},{{ end }} {{ (getmap \"/db\").user }}", "/app",
+		map[interface{}]interface{}{
+			"app": map[interface{}]interface{}{
+				"port":  8080,
+				"debug": true,
+				"hosts": []interface{}{"a", "b"},
+				"db":    map[interface{}]interface{}{"user": "admin"},
+			},
+		},
+		"8081 debug a,b, admin")
 }
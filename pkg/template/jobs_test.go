@@ -0,0 +1,50 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestProcessTemplatesJobs(t *testing.T) {
+	temp := t.TempDir()
+	src := filepath.Join(temp, "src")
+	dest := filepath.Join(temp, "dest")
+	expected := []string{}
+	for i := 0; i < 50; i++ {
+		dir := filepath.Join(src, fmt.Sprintf("%02d", i%5))
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		content := `{{ getv "/foo" }}`
+		if i == 7 || i == 42 {
+			content = `{{ getv "/missing" }}`
+		} else {
+			expected = append(expected, filepath.Join(dest, fmt.Sprintf("%02d", i%5), fmt.Sprintf("%02d", i)))
+		}
+		require.NoError(t, os.WriteFile(filepath.Join(dir, fmt.Sprintf("%02d.clconf", i)), []byte(content), 0644))
+	}
+
+	results, err := ProcessTemplates([]string{src}, dest, map[interface{}]interface{}{"foo": "bar"}, nil,
+		TemplateOptions{Extension: ".clconf", FileMode: 0644, DirMode: 0755, Jobs: 8})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "07.clconf")
+	assert.Contains(t, err.Error(), "42.clconf")
+
+	dests := []string{}
+	for _, result := range results {
+		dests = append(dests, result.Dest)
+	}
+	// reported in the (lexical) order they were found
+	sortedExpected := append([]string{}, expected...)
+	sort.Strings(sortedExpected)
+	assert.Equal(t, sortedExpected, dests)
+	for _, file := range expected {
+		content, err := os.ReadFile(file)
+		require.NoError(t, err)
+		assert.Equal(t, "bar", string(content))
+	}
+}
@@ -0,0 +1,77 @@
+package template
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// LibraryExtension is the extension of the files loaded from a template
+// library folder.
+const LibraryExtension = ".tmpl"
+
+// LoadLibraries reads every LibraryExtension file under dirs. Each is keyed by
+// its slash separated path relative to the folder it was found in which is
+// also the name it is parsed as (though templates will normally reference the
+// templates it defines instead).
+func LoadLibraries(dirs ...string) (map[string]string, error) {
+	libraries := map[string]string{}
+	for _, dir := range dirs {
+		files, err := findLibraryFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range files {
+			content, err := os.ReadFile(file.full)
+			if err != nil {
+				return nil, fmt.Errorf("read library: %w", err)
+			}
+			libraries[filepath.ToSlash(file.rel)] = string(content)
+		}
+	}
+	return libraries, nil
+}
+
+// libraryFiles returns the absolute paths of the library files under dirs so
+// that they can be excluded from rendering.
+func libraryFiles(dirs []string) (map[string]bool, error) {
+	files := map[string]bool{}
+	for _, dir := range dirs {
+		found, err := findLibraryFiles(dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, file := range found {
+			abs, err := filepath.Abs(file.full)
+			if err != nil {
+				return nil, fmt.Errorf("library absolute path: %w", err)
+			}
+			files[abs] = true
+		}
+	}
+	return files, nil
+}
+
+func findLibraryFiles(dir string) ([]pathWithRelative, error) {
+	var result []pathWithRelative
+	dir = filepath.Clean(dir)
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || !strings.HasSuffix(path, LibraryExtension) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return fmt.Errorf("relative path: %w", err)
+		}
+		result = append(result, pathWithRelative{rel: rel, full: path})
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("find libraries: %w", err)
+	}
+	return result, nil
+}
@@ -0,0 +1,81 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadLibraries(t *testing.T) {
+	temp := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(temp, "sub"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(temp, "a.tmpl"), []byte("a"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(temp, "sub", "b.tmpl"), []byte("b"), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(temp, "c.clconf"), []byte("c"), 0644))
+
+	libraries, err := LoadLibraries(temp)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a.tmpl": "a", "sub/b.tmpl": "b"}, libraries)
+}
+
+func TestProcessTemplatesLibraries(t *testing.T) {
+	temp := t.TempDir()
+	src := filepath.Join(temp, "src")
+	lib := filepath.Join(src, "lib")
+	dest := filepath.Join(temp, "dest")
+	require.NoError(t, os.MkdirAll(lib, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(lib, "helpers.tmpl"), []byte(
+		`{{ define "db" }}host: {{ getv "/db/host" }}
+port: {{ getv "/db/port" }}{{ end }}`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "app.yml.clconf"), []byte(
+		`{{ template "db" }}
+app:
+  db:{{ include "db" . | nindent 4 }}
+`), 0644))
+
+	// without an extension every file is a template, but not the libraries
+	results, err := ProcessTemplates([]string{src}, dest,
+		map[interface{}]interface{}{
+			"db": map[interface{}]interface{}{"host": "localhost", "port": 5432},
+		},
+		nil,
+		TemplateOptions{
+			FileMode:    0644,
+			DirMode:     0755,
+			LibraryDirs: []string{lib},
+		})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.NoFileExists(t, filepath.Join(dest, "lib", "helpers.tmpl"))
+
+	content, err := os.ReadFile(filepath.Join(dest, "app.yml.clconf"))
+	require.NoError(t, err)
+	assert.Equal(t, `host: localhost
+port: 5432
+app:
+  db:
+    host: localhost
+    port: 5432
+`, string(content))
+}
+
+func TestIncludeDepth(t *testing.T) {
+	tmpl, err := NewTemplate("recursive",
+		`{{ define "x" }}{{ include "x" . }}{{ end }}{{ include "x" . }}`, nil)
+	require.NoError(t, err)
+	_, err = tmpl.Execute(map[interface{}]interface{}{})
+	require.ErrorIs(t, err, ErrIncludeDepth)
+	assert.Less(t, len(err.Error()), 1000, "nested errors should not be repeated")
+
+	// nesting below the limit is fine
+	tmpl, err = NewTemplate("nested",
+		`{{ define "count" }}{{ if gt . 0 }}{{ include "count" (sub . 1) }}.{{ end }}{{ end }}`+
+			`{{ include "count" 100 }}`, nil)
+	require.NoError(t, err)
+	content, err := tmpl.Execute(map[interface{}]interface{}{})
+	require.NoError(t, err)
+	assert.Len(t, content, 100)
+}
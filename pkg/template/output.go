@@ -0,0 +1,227 @@
+package template
+
+import (
+	"crypto/rand"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// outputMarker delimits the output markers written by the output function
+// into the rendered content (a character that does not occur in text).
+const outputMarker = "\x00"
+
+const outputsStateSuffix = ".clconf-outputs"
+
+// templateOutput is a section of rendered content destined for its own file.
+type templateOutput struct {
+	path    string
+	content string
+}
+
+// outputSplitter writes the markers for the output function into the
+// rendered content and splits the content on them. The markers include a
+// random token, changed by each reset, so that content not written by output
+// (ie: config values or template text) can not switch files.
+type outputSplitter struct {
+	enabled bool
+	prefix  string
+}
+
+func newOutputSplitter(enabled bool) *outputSplitter {
+	s := &outputSplitter{enabled: enabled}
+	s.reset()
+	return s
+}
+
+// reset changes the token of the markers for a new execution.
+func (s *outputSplitter) reset() {
+	s.prefix = outputMarker + "clconf-output-" + rand.Text() + ":"
+}
+
+// output is the output template function. It switches the rest of the
+// rendered content (until the next output) to the file at the joined parts,
+// relative to the folder of the template result. With no parts (or an empty
+// path), it switches back to the template result itself.
+func (s *outputSplitter) output(parts ...string) (string, error) {
+	if !s.enabled {
+		return "", errors.New("output is only supported when processing template files")
+	}
+	file := strings.Join(parts, "")
+	if file == "" {
+		return s.prefix + outputMarker, nil
+	}
+	if !filepath.IsLocal(file) {
+		return "", fmt.Errorf("output %q must be a relative path within the destination", file)
+	}
+	return s.prefix + filepath.ToSlash(filepath.Clean(file)) + outputMarker, nil
+}
+
+// split separates the content written to the template result from the
+// content written to each output (in the order first written). If there are
+// outputs, whitespace only template result content is considered empty.
+func (s *outputSplitter) split(content string) (string, []templateOutput, error) {
+	sections := strings.Split(content, s.prefix)
+	if len(sections) == 1 {
+		return content, nil, nil
+	}
+
+	var main strings.Builder
+	main.WriteString(sections[0])
+	outputs := []templateOutput{}
+	index := map[string]int{}
+	for _, section := range sections[1:] {
+		file, text, ok := strings.Cut(section, outputMarker)
+		if !ok {
+			return "", nil, errors.New("output marker is not terminated")
+		}
+		if file == "" {
+			main.WriteString(text)
+			continue
+		}
+		// output only writes local paths, but its result can be altered by
+		// the template
+		if !filepath.IsLocal(filepath.FromSlash(file)) {
+			return "", nil, fmt.Errorf("output %q must be a relative path within the destination", file)
+		}
+		file = path.Clean(file)
+		i, ok := index[file]
+		if !ok {
+			i = len(outputs)
+			index[file] = i
+			outputs = append(outputs, templateOutput{path: file})
+		}
+		outputs[i].content += text
+	}
+
+	if strings.TrimSpace(main.String()) == "" {
+		return "", outputs, nil
+	}
+	return main.String(), outputs, nil
+}
+
+// outputsStateFile is the file listing the outputs written for target so that
+// outputs no longer written can be removed.
+func outputsStateFile(target string) string {
+	return filepath.Join(filepath.Dir(target), "."+filepath.Base(target)+outputsStateSuffix)
+}
+
+func isOutputsStateFile(name string) bool {
+	return strings.HasPrefix(name, ".") && strings.HasSuffix(name, outputsStateSuffix)
+}
+
+// readOutputsState returns the outputs previously written for target.
+func readOutputsState(target string) ([]string, error) {
+	content, err := os.ReadFile(outputsStateFile(target))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("read outputs state: %w", err)
+	}
+	return strings.Fields(string(content)), nil
+}
+
+// writeOutputsState records the outputs written for target, removing the
+// record if there are none.
+func writeOutputsState(target string, outputs []templateOutput) error {
+	stateFile := outputsStateFile(target)
+	if len(outputs) == 0 {
+		err := os.Remove(stateFile)
+		if err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("remove outputs state: %w", err)
+		}
+		return nil
+	}
+
+	paths := make([]string, 0, len(outputs))
+	for _, output := range outputs {
+		paths = append(paths, output.path)
+	}
+	sort.Strings(paths)
+	err := WriteFileAtomic(stateFile, []byte(strings.Join(paths, "\n")+"\n"), 0644)
+	if err != nil {
+		return fmt.Errorf("write outputs state: %w", err)
+	}
+	return nil
+}
+
+// processOutputs writes each output relative to the folder of target, then
+// removes the outputs previously written for target that no longer are.
+func processOutputs(
+	src, target string,
+	outputs []templateOutput,
+	mode os.FileMode,
+	uid, gid int,
+	options TemplateOptions,
+) ([]TemplateResult, error) {
+	previous, err := readOutputsState(target)
+	if err != nil {
+		return nil, err
+	}
+	if len(outputs) == 0 && len(previous) == 0 {
+		return nil, nil
+	}
+
+	results := []TemplateResult{}
+	written := map[string]bool{}
+	for _, output := range outputs {
+		if !filepath.IsLocal(filepath.FromSlash(output.path)) {
+			return nil, fmt.Errorf("output %q must be a relative path within the destination", output.path)
+		}
+		written[output.path] = true
+		outputTarget := outputTarget(target, output.path)
+		err = options.claims.claim(outputTarget, src)
+		if err != nil {
+			return nil, err
+		}
+		result, err := writeTarget(src, outputTarget, []byte(output.content), mode, uid, gid, options)
+		if err != nil {
+			return nil, err
+		}
+		results = append(results, result)
+	}
+
+	removeOptions := options
+	removeOptions.KeepEmpty = false
+	for _, stale := range previous {
+		if written[stale] || !filepath.IsLocal(stale) {
+			continue
+		}
+		// an output now written by another template is not removed
+		err = options.claims.ifUnclaimed(outputTarget(target, stale), src, func() error {
+			result, err := writeTarget(src, outputTarget(target, stale), nil, mode, -1, -1, removeOptions)
+			if err != nil {
+				return err
+			}
+			if result.Status == StatusRemoved {
+				results = append(results, result)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if !options.DryRun {
+		err = writeOutputsState(target, outputs)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return results, nil
+}
+
+func outputTarget(target, output string) string {
+	return filepath.Join(filepath.Dir(target), filepath.FromSlash(output))
+}
+
+func isRegularFile(file string) bool {
+	stat, err := os.Stat(file)
+	return err == nil && stat.Mode().IsRegular()
+}
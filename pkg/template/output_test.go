@@ -0,0 +1,189 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSplitOutputs(t *testing.T) {
+	splitter := newOutputSplitter(true)
+	marker := func(parts ...string) string {
+		m, err := splitter.output(parts...)
+		require.NoError(t, err)
+		return m
+	}
+	split := func(content string) (string, []templateOutput) {
+		main, outputs, err := splitter.split(content)
+		require.NoError(t, err)
+		return main, outputs
+	}
+
+	main, outputs := split("main")
+	assert.Equal(t, "main", main)
+	assert.Empty(t, outputs)
+
+	main, outputs = split("\n" + marker("a/", "b") + "ab" + marker() + "main" +
+		marker("c") + "c" + marker("a/b") + "ab")
+	assert.Equal(t, "\nmain", main)
+	assert.Equal(t, []templateOutput{{path: "a/b", content: "abab"}, {path: "c", content: "c"}}, outputs)
+
+	main, _ = split("\n" + marker("a") + "a" + marker("") + " \n")
+	assert.Equal(t, "", main, "whitespace only with outputs")
+
+	for _, invalid := range []string{"../a", "/a", "a/../../b"} {
+		_, err := splitter.output(invalid)
+		assert.Error(t, err, invalid)
+	}
+	_, err := newOutputSplitter(false).output("a")
+	assert.Error(t, err, "disabled")
+
+	// markers altered by the template are checked too
+	_, _, err = splitter.split(strings.Replace(marker("a"), "a", "../a", 1))
+	assert.Error(t, err, "altered path")
+	_, _, err = splitter.split(strings.TrimSuffix(marker("a"), outputMarker))
+	assert.Error(t, err, "unterminated")
+
+	// markers from another execution are just content
+	forged := marker("a") + "a"
+	splitter.reset()
+	main, outputs = split(forged)
+	assert.Equal(t, forged, main)
+	assert.Empty(t, outputs)
+}
+
+func TestProcessOutputsNotLocal(t *testing.T) {
+	temp := t.TempDir()
+	target := filepath.Join(temp, "dest", "app")
+	_, err := processOutputs("app.clconf", target,
+		[]templateOutput{{path: "../data.txt", content: "data"}}, 0644, -1, -1, TemplateOptions{})
+	assert.ErrorContains(t, err, "must be a relative path")
+	assert.NoFileExists(t, filepath.Join(temp, "data.txt"))
+}
+
+func TestProcessTemplatesOutputsInjection(t *testing.T) {
+	// the marker format before markers had a random token
+	const staticMarker = "\x00clconf-output:../data.txt\x00"
+	for name, template := range map[string]string{
+		"config value":     `{{ getv "/value" }}`,
+		"template literal": `{{ printf "%sclconf-output:../data.txt%s" "\x00" "\x00" }}`,
+		"altered marker":   `{{ replace (output "a") "a" "../data.txt" -1 }}`,
+	} {
+		t.Run(name, func(t *testing.T) {
+			temp := t.TempDir()
+			src := filepath.Join(temp, "src", "app.clconf")
+			dest := filepath.Join(temp, "dest")
+			require.NoError(t, os.MkdirAll(filepath.Dir(src), 0755))
+			require.NoError(t, os.WriteFile(src, []byte(template+"ok"), 0644))
+
+			_, err := ProcessTemplates([]string{src}, dest,
+				map[interface{}]interface{}{"value": staticMarker}, nil,
+				TemplateOptions{
+					Extension: ".clconf",
+					FileMode:  0644,
+					DirMode:   0755,
+					Sandbox:   &Sandbox{Funcs: []string{"getv", "output", "replace"}},
+				})
+			if name == "altered marker" {
+				assert.ErrorContains(t, err, "must be a relative path")
+			} else {
+				require.NoError(t, err)
+				assert.FileExists(t, filepath.Join(dest, "app"))
+			}
+			assert.NoFileExists(t, filepath.Join(temp, "data.txt"))
+		})
+	}
+}
+
+func TestProcessTemplatesOutputs(t *testing.T) {
+	temp := t.TempDir()
+	src := filepath.Join(temp, "sites.conf.clconf")
+	dest := filepath.Join(temp, "dest")
+	require.NoError(t, os.WriteFile(src, []byte(
+		`{{ range lsdir "/sites" }}{{ output "sites/" . ".conf" -}}
+server_name {{ getv (printf "/sites/%s/host" .) }};
+{{ end }}`), 0644))
+	options := TemplateOptions{Extension: ".clconf", FileMode: 0640, DirMode: 0750}
+
+	process := func(sites map[interface{}]interface{}) map[string]TemplateStatus {
+		results, err := ProcessTemplates([]string{src}, dest,
+			map[interface{}]interface{}{"sites": sites}, nil, options)
+		require.NoError(t, err)
+		statuses := map[string]TemplateStatus{}
+		for _, result := range results {
+			assert.Equal(t, src, result.Src)
+			rel, err := filepath.Rel(dest, result.Dest)
+			require.NoError(t, err)
+			statuses[filepath.ToSlash(rel)] = result.Status
+		}
+		return statuses
+	}
+
+	assert.Equal(t,
+		map[string]TemplateStatus{"sites/a.conf": StatusCreated, "sites/b.conf": StatusCreated},
+		process(map[interface{}]interface{}{
+			"a": map[interface{}]interface{}{"host": "a.com"},
+			"b": map[interface{}]interface{}{"host": "b.com"},
+		}))
+	content, err := os.ReadFile(filepath.Join(dest, "sites", "b.conf"))
+	require.NoError(t, err)
+	assert.Equal(t, "server_name b.com;\n", string(content))
+	assert.NoFileExists(t, filepath.Join(dest, "sites.conf"))
+
+	assert.Equal(t,
+		map[string]TemplateStatus{"sites/a.conf": StatusUpdated, "sites/b.conf": StatusRemoved},
+		process(map[interface{}]interface{}{
+			"a": map[interface{}]interface{}{"host": "a2.com"},
+		}))
+	assert.NoFileExists(t, filepath.Join(dest, "sites", "b.conf"))
+
+	assert.Equal(t,
+		map[string]TemplateStatus{"sites.conf": StatusUnchanged, "sites/a.conf": StatusRemoved},
+		process(map[interface{}]interface{}{}))
+	assert.NoFileExists(t, filepath.Join(dest, "sites", "a.conf"))
+	assert.NoFileExists(t, outputsStateFile(filepath.Join(dest, "sites.conf")))
+}
+
+func TestProcessTemplatesOutputsConflict(t *testing.T) {
+	temp := t.TempDir()
+	src := filepath.Join(temp, "src")
+	dest := filepath.Join(temp, "dest")
+	require.NoError(t, os.MkdirAll(src, 0755))
+	write := func(name, content string) {
+		require.NoError(t, os.WriteFile(filepath.Join(src, name), []byte(content), 0644))
+	}
+	process := func(jobs int) error {
+		_, err := ProcessTemplates([]string{src}, dest, nil, nil,
+			TemplateOptions{Extension: ".clconf", FileMode: 0644, DirMode: 0755, Jobs: jobs})
+		return err
+	}
+
+	for _, jobs := range []int{1, 4} {
+		write("a.clconf", `{{ output "shared" }}a`)
+		write("b.clconf", `{{ output "shared" }}b`)
+		assert.ErrorContains(t, process(jobs), "is written by both", "same output")
+
+		require.NoError(t, os.Remove(filepath.Join(src, "b.clconf")))
+		write("main.clconf", "main")
+		write("a.clconf", `{{ output "main" }}a`)
+		assert.ErrorContains(t, process(jobs), "is written by both", "output over a result")
+		require.NoError(t, os.Remove(filepath.Join(src, "main.clconf")))
+		require.NoError(t, os.RemoveAll(dest))
+	}
+
+	// an output moved to another template is not removed as stale (by a
+	// template processed after the one now writing it)
+	require.NoError(t, os.Remove(filepath.Join(src, "a.clconf")))
+	write("z.clconf", `{{ output "shared" }}z`)
+	require.NoError(t, process(1))
+	write("z.clconf", `z`)
+	write("b.clconf", `{{ output "shared" }}b`)
+	require.NoError(t, process(1))
+	content, err := os.ReadFile(filepath.Join(dest, "shared"))
+	require.NoError(t, err)
+	assert.Equal(t, "b", string(content))
+}
@@ -0,0 +1,118 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+)
+
+// LookupOwner returns the uid for owner which is either a user name or a
+// numeric id.
+func LookupOwner(owner string) (int, error) {
+	if uid, err := strconv.Atoi(owner); err == nil {
+		return uid, nil
+	}
+	u, err := user.Lookup(owner)
+	if err != nil {
+		return -1, fmt.Errorf("lookup owner: %w", err)
+	}
+	uid, err := strconv.Atoi(u.Uid)
+	if err != nil {
+		return -1, fmt.Errorf("owner %s has non numeric uid %s", owner, u.Uid)
+	}
+	return uid, nil
+}
+
+// LookupGroup returns the gid for group which is either a group name or a
+// numeric id.
+func LookupGroup(group string) (int, error) {
+	if gid, err := strconv.Atoi(group); err == nil {
+		return gid, nil
+	}
+	g, err := user.LookupGroup(group)
+	if err != nil {
+		return -1, fmt.Errorf("lookup group: %w", err)
+	}
+	gid, err := strconv.Atoi(g.Gid)
+	if err != nil {
+		return -1, fmt.Errorf("group %s has non numeric gid %s", group, g.Gid)
+	}
+	return gid, nil
+}
+
+// MkdirOption is an option for MkdirAllNoUmask.
+type MkdirOption func(o *mkdirOptions)
+
+type mkdirOptions struct {
+	uid int
+	gid int
+}
+
+// WithOwner changes the owner and group of every folder MkdirAllNoUmask
+// creates to uid and gid (-1 leaves either unchanged). Existing folders are
+// not modified.
+func WithOwner(uid, gid int) MkdirOption {
+	return func(o *mkdirOptions) {
+		o.uid = uid
+		o.gid = gid
+	}
+}
+
+// MkdirAllNoUmask is os.MkdirAll that ignores the current unix umask.
+func MkdirAllNoUmask(path string, perms os.FileMode, opts ...MkdirOption) error {
+	o := mkdirOptions{uid: -1, gid: -1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.uid == -1 && o.gid == -1 {
+		return mkdirAllNoUmask(path, perms)
+	}
+
+	missing := []string{}
+	for dir := filepath.Clean(path); ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(dir); err == nil {
+			break
+		}
+		missing = append(missing, dir)
+		if filepath.Dir(dir) == dir {
+			break
+		}
+	}
+
+	err := mkdirAllNoUmask(path, perms)
+	if err != nil {
+		return err
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		err = chown(missing[i], o.uid, o.gid)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// chown is os.Chown with a more helpful error when the process lacks the
+// privileges required.
+func chown(file string, uid, gid int) error {
+	err := os.Chown(file, uid, gid)
+	if errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("chown %s to %d:%d requires privileges (ie: root or CAP_CHOWN): %w",
+			file, uid, gid, err)
+	}
+	if err != nil {
+		return fmt.Errorf("chown %s to %d:%d: %w", file, uid, gid, err)
+	}
+	return nil
+}
+
+// sameOwner returns true if a and b have the same owner and group (always
+// true where ownership is not supported).
+func sameOwner(a, b os.FileInfo) bool {
+	aUid, aGid, aOk := fileOwner(a)
+	bUid, bGid, bOk := fileOwner(b)
+	return !aOk || !bOk || (aUid == bUid && aGid == bGid)
+}
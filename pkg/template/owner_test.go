@@ -0,0 +1,121 @@
+//go:build !windows
+
+package template
+
+import (
+	"os"
+	"os/user"
+	"path/filepath"
+	"strconv"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testOwner(t *testing.T, path string) (int, int) {
+	stat, err := os.Stat(path)
+	require.NoError(t, err)
+	sys := stat.Sys().(*syscall.Stat_t)
+	return int(sys.Uid), int(sys.Gid)
+}
+
+func TestLookupOwnerGroup(t *testing.T) {
+	current, err := user.Current()
+	require.NoError(t, err)
+
+	uid, err := LookupOwner(current.Username)
+	require.NoError(t, err)
+	assert.Equal(t, current.Uid, strconv.Itoa(uid))
+	uid, err = LookupOwner("1234")
+	require.NoError(t, err)
+	assert.Equal(t, 1234, uid)
+	_, err = LookupOwner("clconf-no-such-user")
+	assert.Error(t, err)
+
+	gid, err := LookupGroup("1234")
+	require.NoError(t, err)
+	assert.Equal(t, 1234, gid)
+	_, err = LookupGroup("clconf-no-such-group")
+	assert.Error(t, err)
+}
+
+func TestMkdirAllNoUmaskWithOwner(t *testing.T) {
+	temp := t.TempDir()
+	existing := filepath.Join(temp, "existing")
+	require.NoError(t, os.Mkdir(existing, 0700))
+	path := filepath.Join(existing, "a", "b")
+
+	err := MkdirAllNoUmask(path, 0750, WithOwner(os.Getuid(), os.Getgid()))
+	require.NoError(t, err)
+	for _, dir := range []string{filepath.Join(existing, "a"), path} {
+		stat, err := os.Stat(dir)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0750), stat.Mode().Perm(), dir)
+		actualUID, actualGID := testOwner(t, dir)
+		assert.Equal(t, os.Getuid(), actualUID, dir)
+		assert.Equal(t, os.Getgid(), actualGID, dir)
+	}
+
+	if os.Getuid() != 0 {
+		err = MkdirAllNoUmask(filepath.Join(existing, "c"), 0750, WithOwner(1234, -1))
+		assert.ErrorContains(t, err, "requires privileges")
+	}
+}
+
+func TestProcessTemplatesOwner(t *testing.T) {
+	temp := t.TempDir()
+	src := filepath.Join(temp, "src")
+	require.NoError(t, os.MkdirAll(filepath.Join(src, "sub"), 0700))
+	require.NoError(t, os.WriteFile(filepath.Join(src, "sub", "a.clconf"), []byte("a"), 0600))
+	dest := filepath.Join(temp, "dest")
+	uid, gid := 1234, 5678
+	options := TemplateOptions{
+		Extension:         ".clconf",
+		CopyTemplatePerms: true,
+		DirMode:           0700,
+		Uid:               &uid,
+		Gid:               &gid,
+	}
+
+	results, err := ProcessTemplates([]string{src}, dest, nil, nil, options)
+	if os.Getuid() != 0 {
+		assert.ErrorContains(t, err, "requires privileges")
+		return
+	}
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	for _, path := range []string{dest, filepath.Join(dest, "sub"), filepath.Join(dest, "sub", "a")} {
+		actualUID, actualGID := testOwner(t, path)
+		assert.Equal(t, uid, actualUID, path)
+		assert.Equal(t, gid, actualGID, path)
+	}
+
+	// ownership changes are detected and existing ownership is preserved
+	otherUID := 4321
+	options.Uid = &otherUID
+	options.Gid = nil
+	results, err = ProcessTemplates([]string{src}, dest, nil, nil, options)
+	require.NoError(t, err)
+	assert.Equal(t, StatusUpdated, results[0].Status)
+	actualUID, actualGID := testOwner(t, filepath.Join(dest, "sub", "a"))
+	assert.Equal(t, otherUID, actualUID)
+	assert.Equal(t, gid, actualGID)
+
+	// copy from template
+	require.NoError(t, os.Chown(filepath.Join(src, "sub", "a.clconf"), 2222, 3333))
+	options.Uid = nil
+	options.CopyTemplateOwner = true
+	options.DryRun = true
+	options.Diff = true
+	results, err = ProcessTemplates([]string{src}, dest, nil, nil, options)
+	require.NoError(t, err)
+	assert.Contains(t, results[0].Diff, "old owner 4321:5678\nnew owner 2222:3333\n")
+	options.DryRun = false
+	_, err = ProcessTemplates([]string{src}, dest, nil, nil, options)
+	require.NoError(t, err)
+	actualUID, actualGID = testOwner(t, filepath.Join(dest, "sub", "a"))
+	assert.Equal(t, 2222, actualUID)
+	assert.Equal(t, 3333, actualGID)
+}
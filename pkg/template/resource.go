@@ -0,0 +1,319 @@
+package template
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+
+	"github.com/BurntSushi/toml"
+	"github.com/pastdev/clconf/v3/pkg/core"
+	"github.com/pastdev/clconf/v3/pkg/secret"
+)
+
+// DefaultResourceFileMode is the mode used for a new resource dest when the
+// resource does not specify one.
+const DefaultResourceFileMode os.FileMode = 0644
+
+// DefaultResourceDirMode is the mode used for the folders created for a
+// resource dest that does not exist.
+const DefaultResourceDirMode os.FileMode = 0755
+
+// TemplateResource is a confd compatible template resource, read from the
+// [template] table of a toml file in the conf.d folder.
+//
+//	https://github.com/kelseyhightower/confd/blob/master/docs/template-resources.md
+type TemplateResource struct { //nolint:revive
+	// CheckCmd is run, if set, to validate the staged result before it
+	// replaces Dest. {{.src}} is replaced with the path of the staged file.
+	CheckCmd string `toml:"check_cmd"`
+	// Dest is the path the result is written to.
+	Dest string `toml:"dest"`
+	// Gid is the group the result is owned by (defaults to unchanged).
+	Gid *int `toml:"gid"`
+	// Keys limits the values available to the template to those under these
+	// paths (relative to Prefix). If empty all values are available.
+	Keys []string `toml:"keys"`
+	// Mode is the octal permissions of the result (defaults to the mode of an
+	// existing Dest or DefaultResourceFileMode).
+	Mode string `toml:"mode"`
+	// Prefix is prepended to all template getv/gets paths.
+	Prefix string `toml:"prefix"`
+	// ReloadCmd is run, if set, after Dest has been updated.
+	ReloadCmd string `toml:"reload_cmd"`
+	// Src is the template, relative to the templates folder.
+	Src string `toml:"src"`
+	// Uid is the user the result is owned by (defaults to unchanged).
+	Uid *int `toml:"uid"` //nolint:revive // confd naming
+
+	// File is the toml file the resource was loaded from.
+	File string `toml:"-"`
+}
+
+// ResourceOptions are settings for ProcessResources.
+type ResourceOptions struct {
+	// LeftDelim is passed to go teplate.Delims
+	LeftDelim string
+	// Noop renders and checks but never updates Dest or runs ReloadCmd.
+	Noop bool
+	// RightDelim is passed to go teplate.Delims
+	RightDelim string
+	// SyncOnly updates Dest without running CheckCmd or ReloadCmd.
+	SyncOnly bool
+}
+
+// ResourceResult stores the result of processing a single resource.
+type ResourceResult struct {
+	Resource string
+	Src      string
+	Dest     string
+	// Changed is true if the rendered result differed from Dest.
+	Changed bool
+}
+
+// LoadResources reads every *.toml resource in the conf.d folder of confDir
+// (the confd layout) in name order.
+func LoadResources(confDir string) ([]TemplateResource, error) {
+	files, err := filepath.Glob(filepath.Join(confDir, "conf.d", "*.toml"))
+	if err != nil {
+		return nil, fmt.Errorf("find resources: %w", err)
+	}
+	sort.Strings(files)
+
+	resources := make([]TemplateResource, 0, len(files))
+	for _, file := range files {
+		var config struct {
+			Template TemplateResource `toml:"template"`
+		}
+		_, err = toml.DecodeFile(file, &config)
+		if err != nil {
+			return nil, fmt.Errorf("decode %s: %w", file, err)
+		}
+		resource := config.Template
+		if resource.Src == "" || resource.Dest == "" {
+			return nil, fmt.Errorf("%s: src and dest are required", file)
+		}
+		if !filepath.IsAbs(resource.Src) {
+			resource.Src = filepath.Join(confDir, "templates", resource.Src)
+		}
+		resource.File = file
+		resources = append(resources, resource)
+	}
+	return resources, nil
+}
+
+// ProcessResources loads the resources in confDir (see LoadResources) and
+// processes each one. A resource's Dest is only replaced, and its ReloadCmd
+// run, when the rendered result differs from it. All resources are
+// processed even if some fail, the failures are returned joined.
+func ProcessResources(
+	confDir string,
+	value interface{},
+	secretAgent *secret.SecretAgent,
+	options ResourceOptions,
+) ([]ResourceResult, error) {
+	resources, err := LoadResources(confDir)
+	if err != nil {
+		return nil, err
+	}
+
+	results := []ResourceResult{}
+	var errs []error
+	for _, resource := range resources {
+		result, err := resource.process(value, secretAgent, options)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", resource.File, err))
+			continue
+		}
+		results = append(results, result)
+	}
+	return results, errors.Join(errs...)
+}
+
+func (r TemplateResource) process(
+	value interface{},
+	secretAgent *secret.SecretAgent,
+	options ResourceOptions,
+) (ResourceResult, error) {
+	result := ResourceResult{Resource: r.File, Src: r.Src, Dest: r.Dest}
+
+	mode, err := r.fileMode()
+	if err != nil {
+		return result, err
+	}
+
+	tmpl, err := NewTemplateFromFile(filepath.Base(r.Src), r.Src,
+		&TemplateConfig{
+			Prefix:      r.Prefix,
+			SecretAgent: secretAgent,
+			LeftDelim:   options.LeftDelim,
+			RightDelim:  options.RightDelim,
+		})
+	if err != nil {
+		return result, err
+	}
+	content, err := tmpl.Execute(r.filterKeys(value))
+	if err != nil {
+		return result, fmt.Errorf("processing template: %w", err)
+	}
+
+	dest := resolveSymlinks(r.Dest)
+	staged, err := r.stage(dest, content, mode, options.Noop)
+	if err != nil {
+		return result, err
+	}
+	defer func() { _ = os.Remove(staged) }()
+
+	same, err := sameFile(staged, r.Dest)
+	if err != nil {
+		return result, err
+	}
+	if same {
+		return result, nil
+	}
+	result.Changed = true
+
+	if !options.SyncOnly && r.CheckCmd != "" {
+		err = runResourceCommand(r.CheckCmd, map[string]string{"src": staged})
+		if err != nil {
+			return result, fmt.Errorf("check: %w", err)
+		}
+	}
+	if options.Noop {
+		return result, nil
+	}
+
+	err = replaceFile(staged, dest)
+	if err != nil {
+		return result, fmt.Errorf("replace dest: %w", err)
+	}
+
+	if !options.SyncOnly && r.ReloadCmd != "" {
+		err = runResourceCommand(r.ReloadCmd, map[string]string{"src": r.Src, "dest": r.Dest})
+		if err != nil {
+			return result, fmt.Errorf("reload: %w", err)
+		}
+	}
+	return result, nil
+}
+
+func (r TemplateResource) fileMode() (os.FileMode, error) {
+	if r.Mode != "" {
+		mode, err := UnixModeToFileMode(r.Mode)
+		if err != nil {
+			return 0, fmt.Errorf("parsing mode: %w", err)
+		}
+		return mode, nil
+	}
+	if stat, err := os.Stat(r.Dest); err == nil {
+		return stat.Mode(), nil
+	}
+	return DefaultResourceFileMode, nil
+}
+
+// filterKeys returns only the values under Keys. Keys, like all template
+// paths, are relative to Prefix.
+func (r TemplateResource) filterKeys(value interface{}) interface{} {
+	if len(r.Keys) == 0 {
+		return value
+	}
+	filtered := map[interface{}]interface{}{}
+	for _, key := range r.Keys {
+		keyPath := path.Join("/", r.Prefix, key)
+		keyValue, err := core.GetValue(value, keyPath)
+		if err != nil {
+			continue
+		}
+		if keyPath == "/" {
+			return value
+		}
+		_ = core.SetValue(filtered, keyPath, keyValue)
+	}
+	return filtered
+}
+
+// stage writes content to a temporary file next to dest (so that it can be
+// renamed over dest atomically) with the resource mode and ownership,
+// creating the folder of dest if necessary. If noop, a missing folder is not
+// created and the temporary file is written to the system temp folder
+// instead.
+func (r TemplateResource) stage(dest string, content string, mode os.FileMode, noop bool) (string, error) {
+	uid, gid := r.owner()
+	dir := filepath.Dir(dest)
+	if _, err := os.Stat(dir); os.IsNotExist(err) {
+		if noop {
+			return stageFileOwned(filepath.Join(os.TempDir(), filepath.Base(dest)), []byte(content), mode, uid, gid)
+		}
+		err = MkdirAllNoUmask(dir, DefaultResourceDirMode, WithOwner(uid, gid))
+		if err != nil {
+			return "", fmt.Errorf("create dest folder: %w", err)
+		}
+	}
+	return stageFileOwned(dest, []byte(content), mode, uid, gid)
+}
+
+// owner returns the Uid and Gid of the resource, -1 for either if unset.
+func (r TemplateResource) owner() (int, int) {
+	uid, gid := -1, -1
+	if r.Uid != nil {
+		uid = *r.Uid
+	}
+	if r.Gid != nil {
+		gid = *r.Gid
+	}
+	return uid, gid
+}
+
+// sameFile returns true if b exists and has the same content, mode and
+// ownership as a.
+func sameFile(a, b string) (bool, error) {
+	bStat, err := os.Stat(b)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("stat: %w", err)
+	}
+	aStat, err := os.Stat(a)
+	if err != nil {
+		return false, fmt.Errorf("stat: %w", err)
+	}
+	if aStat.Mode() != bStat.Mode() || aStat.Size() != bStat.Size() || !sameOwner(aStat, bStat) {
+		return false, nil
+	}
+
+	aContent, err := os.ReadFile(a)
+	if err != nil {
+		return false, fmt.Errorf("read: %w", err)
+	}
+	bContent, err := os.ReadFile(b)
+	if err != nil {
+		return false, fmt.Errorf("read: %w", err)
+	}
+	return bytes.Equal(aContent, bContent), nil
+}
+
+// runResourceCommand runs command, after substituting data as a go template,
+// using the system shell. The combined output is included in any error.
+func runResourceCommand(command string, data map[string]string) error {
+	tmpl, err := template.New("cmd").Parse(command)
+	if err != nil {
+		return fmt.Errorf("parse command: %w", err)
+	}
+	var buf strings.Builder
+	err = tmpl.Execute(&buf, data)
+	if err != nil {
+		return fmt.Errorf("execute command template: %w", err)
+	}
+
+	output, err := ShellCommand(buf.String()).CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%q: %w: %s", buf.String(), err, strings.TrimSpace(string(output)))
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package template
+
+import (
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writeTestResource(t *testing.T, confDir, name, resource, template string) {
+	require.NoError(t, os.MkdirAll(filepath.Join(confDir, "conf.d"), 0700))
+	require.NoError(t, os.MkdirAll(filepath.Join(confDir, "templates"), 0700))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(confDir, "conf.d", name+".toml"), []byte(resource), 0600))
+	require.NoError(t, os.WriteFile(
+		filepath.Join(confDir, "templates", name+".tmpl"), []byte(template), 0600))
+}
+
+func TestProcessResources(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("commands use sh syntax")
+	}
+	temp := t.TempDir()
+	confDir := filepath.Join(temp, "confd")
+	dest := filepath.Join(temp, "app.conf")
+	reloads := filepath.Join(temp, "reloads")
+	writeTestResource(t, confDir, "app", `
+[template]
+src = "app.tmpl"
+dest = "`+dest+`"
+mode = "0640"
+prefix = "/app"
+keys = ["/db"]
+check_cmd = "grep -q host {{.src}}"
+reload_cmd = "echo {{.dest}} >> `+reloads+`"
+`, `host={{ getv "/db/host" }} {{ exists "/other" }}`)
+
+	value := map[interface{}]interface{}{
+		"app": map[interface{}]interface{}{
+			"db":    map[interface{}]interface{}{"host": "db.example.com"},
+			"other": "hidden",
+		},
+	}
+
+	results, err := ProcessResources(confDir, value, nil, ResourceOptions{})
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	assert.True(t, results[0].Changed)
+	content, err := os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "host=db.example.com false", string(content))
+	stat, err := os.Stat(dest)
+	require.NoError(t, err)
+	assert.Equal(t, os.FileMode(0640), stat.Mode())
+
+	// unchanged does not reload
+	results, err = ProcessResources(confDir, value, nil, ResourceOptions{})
+	require.NoError(t, err)
+	assert.False(t, results[0].Changed)
+	content, err = os.ReadFile(reloads)
+	require.NoError(t, err)
+	assert.Equal(t, dest+"\n", string(content))
+
+	// noop does not update
+	value["app"].(map[interface{}]interface{})["db"] = map[interface{}]interface{}{"host": "new"}
+	results, err = ProcessResources(confDir, value, nil, ResourceOptions{Noop: true})
+	require.NoError(t, err)
+	assert.True(t, results[0].Changed)
+	content, err = os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "host=db.example.com false", string(content))
+
+	// failed check does not update
+	writeTestResource(t, confDir, "app", `
+[template]
+src = "app.tmpl"
+dest = "`+dest+`"
+check_cmd = "false"
+`, `{{ getv "/app/db/host" }}`)
+	_, err = ProcessResources(confDir, value, nil, ResourceOptions{})
+	assert.Error(t, err)
+	content, err = os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "host=db.example.com false", string(content))
+	entries, err := os.ReadDir(temp)
+	require.NoError(t, err)
+	assert.Len(t, entries, 3, "staged file should be removed")
+
+	// sync only skips the check
+	_, err = ProcessResources(confDir, value, nil, ResourceOptions{SyncOnly: true})
+	require.NoError(t, err)
+	content, err = os.ReadFile(dest)
+	require.NoError(t, err)
+	assert.Equal(t, "new", string(content))
+}
+
+func TestProcessResourcesDest(t *testing.T) {
+	temp := t.TempDir()
+	confDir := filepath.Join(temp, "confd")
+	value := map[interface{}]interface{}{"host": "db"}
+
+	t.Run("missing folder", func(t *testing.T) {
+		dest := filepath.Join(temp, "missing", "app.conf")
+		writeTestResource(t, confDir, "app", `
+[template]
+src = "app.tmpl"
+dest = "`+filepath.ToSlash(dest)+`"
+`, `host={{ getv "/host" }}`)
+
+		_, err := ProcessResources(confDir, value, nil, ResourceOptions{Noop: true})
+		require.NoError(t, err)
+		assert.NoDirExists(t, filepath.Dir(dest), "noop should not create folders")
+
+		_, err = ProcessResources(confDir, value, nil, ResourceOptions{})
+		require.NoError(t, err)
+		content, err := os.ReadFile(dest)
+		require.NoError(t, err)
+		assert.Equal(t, "host=db", string(content))
+	})
+
+	t.Run("symlink", func(t *testing.T) {
+		target := filepath.Join(temp, "target.conf")
+		require.NoError(t, os.WriteFile(target, []byte("old"), 0600))
+		dest := filepath.Join(temp, "link.conf")
+		if err := os.Symlink(target, dest); err != nil {
+			t.Skipf("symlinks not supported: %v", err)
+		}
+		writeTestResource(t, confDir, "app", `
+[template]
+src = "app.tmpl"
+dest = "`+filepath.ToSlash(dest)+`"
+`, `host={{ getv "/host" }}`)
+
+		_, err := ProcessResources(confDir, value, nil, ResourceOptions{})
+		require.NoError(t, err)
+		stat, err := os.Lstat(dest)
+		require.NoError(t, err)
+		assert.Equal(t, os.ModeSymlink, stat.Mode()&os.ModeSymlink, "dest should still be a symlink")
+		content, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "host=db", string(content))
+	})
+}
+
+func TestLoadResources(t *testing.T) {
+	temp := t.TempDir()
+	writeTestResource(t, temp, "b", "[template]\nsrc = \"b.tmpl\"\ndest = \"/b\"\nuid = 0\n", "")
+	writeTestResource(t, temp, "a", "[template]\nsrc = \"/a.tmpl\"\ndest = \"/a\"\n", "")
+
+	resources, err := LoadResources(temp)
+	require.NoError(t, err)
+	require.Len(t, resources, 2)
+	assert.Equal(t, "/a.tmpl", resources[0].Src)
+	assert.Nil(t, resources[0].Uid)
+	assert.Equal(t, filepath.Join(temp, "templates", "b.tmpl"), resources[1].Src)
+	assert.Equal(t, 0, *resources[1].Uid)
+
+	writeTestResource(t, temp, "c", "[template]\nsrc = \"c.tmpl\"\n", "")
+	_, err = LoadResources(temp)
+	assert.Error(t, err)
+}
@@ -0,0 +1,330 @@
+package template
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/pastdev/clconf/v3/pkg/memkv"
+)
+
+// ErrOutputLimit is returned when a sandboxed template renders more than
+// Sandbox.MaxOutput bytes.
+var ErrOutputLimit = errors.New("template output limit exceeded")
+
+// ErrTimeout is returned when a sandboxed template runs longer than
+// Sandbox.Timeout.
+var ErrTimeout = errors.New("template execution timed out")
+
+// sandboxDenied are the functions unavailable in a sandbox unless listed in
+// Sandbox.Funcs as they reveal information about the host or, for output,
+// write files other than the template result.
+var sandboxDenied = []string{"fileExists", "lookupIP", "lookupIPV4", "lookupIPV6", "lookupSRV", "output"}
+
+// Sandbox restricts templates from untrusted sources so that they can not
+// read secrets other than those they are allowed to.
+type Sandbox struct {
+	// Funcs, if not nil, are the only functions available (in addition to
+	// the text/template builtins). Otherwise all functions are available
+	// except fileExists, the DNS lookup functions and output. Either way
+	// getenv and the cget functions are limited by Env and Decrypt.
+	Funcs []string
+	// Env are the path.Match patterns (ie: APP_*) of the environment
+	// variables getenv can read, others are treated as unset.
+	Env []string
+	// Decrypt are the key prefixes (ie: /app/secrets) under which the cget
+	// functions can decrypt values.
+	Decrypt []string
+	// Timeout, if not zero, limits how long Execute can run.
+	Timeout time.Duration
+	// MaxOutput, if not zero, limits the size of the rendered result in
+	// bytes. It also limits the size of the results of include, indent,
+	// nindent and repeat, and the length of the lists returned by seq.
+	MaxOutput int
+}
+
+// applySandbox removes the functions not allowed by the sandbox of limits,
+// limits getenv and the cget functions, and checks the limits on every
+// function call.
+func applySandbox(funcMap map[string]interface{}, limits *sandboxLimits, fixtures *Fixtures, strict bool) error {
+	sandbox := limits.sandbox
+	lookupEnv := fixtures.lookupEnv()
+	funcMap["getenv"] = getenvFunc(func(key string) (string, bool) {
+		if !sandbox.envAllowed(key) {
+			return "", false
+		}
+		return lookupEnv(key)
+	}, strict)
+
+	err := sandbox.limitDecrypt(funcMap)
+	if err != nil {
+		return err
+	}
+	limits.limitSize(funcMap)
+
+	if sandbox.Funcs == nil {
+		for _, name := range sandboxDenied {
+			delete(funcMap, name)
+		}
+	} else {
+		allowed := map[string]bool{}
+		for _, name := range sandbox.Funcs {
+			allowed[name] = true
+		}
+		for name := range funcMap {
+			if !allowed[name] {
+				delete(funcMap, name)
+			}
+		}
+	}
+
+	for name, fn := range funcMap {
+		funcMap[name] = limits.checked(name, fn)
+	}
+	return nil
+}
+
+func (sandbox *Sandbox) envAllowed(key string) bool {
+	for _, pattern := range sandbox.Env {
+		if ok, _ := path.Match(pattern, key); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// decryptAllowed returns true if key (or pattern) is under one of the
+// Decrypt prefixes.
+func (sandbox *Sandbox) decryptAllowed(key string) bool {
+	key = "/" + strings.TrimLeft(key, "/")
+	for _, prefix := range sandbox.Decrypt {
+		prefix = "/" + strings.Trim(prefix, "/")
+		if prefix == "/" || key == prefix || strings.HasPrefix(key, prefix+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+func (sandbox *Sandbox) checkDecrypt(name, key string) error {
+	if !sandbox.decryptAllowed(key) {
+		return fmt.Errorf("%s %s: decryption is not allowed in the sandbox", name, key)
+	}
+	return nil
+}
+
+// limitDecrypt wraps the cget functions (if present) so that they fail
+// outside of the Decrypt prefixes.
+func (sandbox *Sandbox) limitDecrypt(funcMap map[string]interface{}) error {
+	for name, fn := range funcMap {
+		if !strings.HasPrefix(name, "cget") {
+			continue
+		}
+		var limited interface{}
+		switch fn := fn.(type) {
+		case func(string) (memkv.KVPair, error):
+			limited = func(key string) (memkv.KVPair, error) {
+				if err := sandbox.checkDecrypt(name, key); err != nil {
+					return memkv.KVPair{}, err
+				}
+				return fn(key)
+			}
+		case func(string) (memkv.KVPairs, error):
+			limited = func(pattern string) (memkv.KVPairs, error) {
+				if err := sandbox.checkDecrypt(name, pattern); err != nil {
+					return nil, err
+				}
+				return fn(pattern)
+			}
+		case func(string) (string, error):
+			limited = func(key string) (string, error) {
+				if err := sandbox.checkDecrypt(name, key); err != nil {
+					return "", err
+				}
+				return fn(key)
+			}
+		case func(string) ([]string, error):
+			limited = func(pattern string) ([]string, error) {
+				if err := sandbox.checkDecrypt(name, pattern); err != nil {
+					return nil, err
+				}
+				return fn(pattern)
+			}
+		}
+		if limited == nil {
+			return fmt.Errorf("sandbox: unsupported decrypt function %s", name)
+		}
+		funcMap[name] = limited
+	}
+	return nil
+}
+
+// sandboxLimits enforces the Timeout and MaxOutput of a Sandbox during an
+// execution.
+type sandboxLimits struct {
+	sandbox  *Sandbox
+	deadline time.Time
+}
+
+// start sets the deadline of a new execution.
+func (l *sandboxLimits) start() {
+	l.deadline = time.Time{}
+	if l.sandbox.Timeout > 0 {
+		l.deadline = time.Now().Add(l.sandbox.Timeout)
+	}
+}
+
+func (l *sandboxLimits) checkDeadline() error {
+	if !l.deadline.IsZero() && time.Now().After(l.deadline) {
+		return ErrTimeout
+	}
+	return nil
+}
+
+// checkSize fails if size is more than MaxOutput.
+func (l *sandboxLimits) checkSize(name string, size int) error {
+	if l.sandbox.MaxOutput > 0 && size > l.sandbox.MaxOutput {
+		return fmt.Errorf("%s: %w (%d bytes)", name, ErrOutputLimit, l.sandbox.MaxOutput)
+	}
+	return nil
+}
+
+// writer returns w limited to MaxOutput bytes written before the deadline.
+func (l *sandboxLimits) writer(w io.Writer) *sandboxWriter {
+	return &sandboxWriter{writer: w, limits: l}
+}
+
+// limitSize wraps the functions (if present) whose results can be far
+// larger than their arguments so that they fail, rather than exhaust the
+// memory, when the result would exceed MaxOutput.
+func (l *sandboxLimits) limitSize(funcMap map[string]interface{}) {
+	if l.sandbox.MaxOutput <= 0 {
+		return
+	}
+	maxOutput := l.sandbox.MaxOutput
+	if repeat, ok := funcMap["repeat"].(func(int, string) string); ok {
+		funcMap["repeat"] = func(count int, s string) (string, error) {
+			if len(s) > 0 && count > maxOutput/len(s) {
+				return "", l.checkSize("repeat", maxOutput+1)
+			}
+			return repeat(count, s), nil
+		}
+	}
+	for _, name := range []string{"indent", "nindent"} {
+		if indent, ok := funcMap[name].(func(int, string) string); ok {
+			funcMap[name] = func(spaces int, v string) (string, error) {
+				lines := strings.Count(v, "\n") + 1
+				if spaces > 0 && spaces > (maxOutput-len(v))/lines {
+					return "", l.checkSize(name, maxOutput+1)
+				}
+				return indent(spaces, v), nil
+			}
+		}
+	}
+	if seq, ok := funcMap["seq"].(func(int, int) []int); ok {
+		funcMap["seq"] = func(first, last int) ([]int, error) {
+			// unsigned so that the difference can not overflow
+			if last >= first && uint(last)-uint(first) >= uint(maxOutput) {
+				return nil, fmt.Errorf("seq: %w (%d elements)", ErrOutputLimit, maxOutput)
+			}
+			return seq(first, last), nil
+		}
+	}
+}
+
+// checked wraps fn so that it fails once the deadline has passed (so that an
+// abandoned execution stops at its next function call) or if it returns a
+// string larger than MaxOutput.
+func (l *sandboxLimits) checked(name string, fn interface{}) interface{} {
+	value := reflect.ValueOf(fn)
+	if value.Kind() != reflect.Func {
+		return fn
+	}
+	fnType := value.Type()
+	return reflect.MakeFunc(fnType, func(args []reflect.Value) []reflect.Value {
+		// text/template returns the panics of functions as their errors,
+		// which is the only way to fail those that do not return one
+		if err := l.checkDeadline(); err != nil {
+			panic(fmt.Errorf("%s: %w", name, err))
+		}
+		var results []reflect.Value
+		if fnType.IsVariadic() {
+			results = value.CallSlice(args)
+		} else {
+			results = value.Call(args)
+		}
+		if len(results) > 0 && results[0].Kind() == reflect.String {
+			if err := l.checkSize(name, results[0].Len()); err != nil {
+				panic(err)
+			}
+		}
+		return results
+	}).Interface()
+}
+
+// sandboxWriter enforces the limits of a Sandbox on each write.
+type sandboxWriter struct {
+	writer  io.Writer
+	limits  *sandboxLimits
+	written int
+}
+
+func (w *sandboxWriter) Write(p []byte) (int, error) {
+	if err := w.limits.checkDeadline(); err != nil {
+		return 0, err
+	}
+	if max := w.limits.sandbox.MaxOutput; max > 0 && w.written+len(p) > max {
+		return 0, fmt.Errorf("%w (%d bytes)", ErrOutputLimit, max)
+	}
+	w.written += len(p)
+	n, err := w.writer.Write(p)
+	if err != nil {
+		return n, fmt.Errorf("sandbox write: %w", err)
+	}
+	return n, nil
+}
+
+// executeSandboxed executes the template writing to w within the limits of
+// the sandbox. On timeout the execution is abandoned: it stops at its next
+// write or function call but, as text/template can not be interrupted, a
+// template that does neither (ie: an empty range over a long list) keeps
+// running in the background until it completes. As it may still be reading
+// the store, the template can not be executed again.
+func (tmpl *Template) executeSandboxed(w io.Writer) error {
+	sandbox := tmpl.config.Sandbox
+	execute := func(w io.Writer) error {
+		return tmpl.template.Execute(w, nil) //nolint:wrapcheck // wrapped by Execute
+	}
+	tmpl.limits.start()
+	if sandbox.Timeout <= 0 {
+		return execute(tmpl.limits.writer(w))
+	}
+
+	var buffer strings.Builder
+	writer := tmpl.limits.writer(&buffer)
+	done := make(chan error, 1)
+	go func() {
+		done <- execute(writer)
+	}()
+
+	timer := time.NewTimer(sandbox.Timeout)
+	defer timer.Stop()
+	select {
+	case err := <-done:
+		if err != nil {
+			return err
+		}
+		_, err = io.WriteString(w, buffer.String())
+		if err != nil {
+			return fmt.Errorf("sandbox write: %w", err)
+		}
+		return nil
+	case <-timer.C:
+		tmpl.abandoned = true
+		return fmt.Errorf("%w after %s", ErrTimeout, sandbox.Timeout)
+	}
+}
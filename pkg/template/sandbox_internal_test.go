@@ -0,0 +1,25 @@
+package template
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSandboxLimitsChecked(t *testing.T) {
+	limits := &sandboxLimits{sandbox: &Sandbox{Timeout: time.Second, MaxOutput: 3}}
+	limits.start()
+	double := limits.checked("double", func(s string) string { return s + s }).(func(string) string)
+	assert.Equal(t, "aa", double("a"))
+	assert.PanicsWithError(t, "double: template output limit exceeded (3 bytes)", func() { double("ab") })
+
+	join := limits.checked("join", func(sep string, s ...string) string {
+		return s[0] + sep + s[1]
+	}).(func(string, ...string) string)
+	assert.Equal(t, "a-b", join("-", "a", "b"))
+
+	// once abandoned, an execution stops at its next function call
+	limits.deadline = time.Now().Add(-time.Second)
+	assert.PanicsWithError(t, "double: template execution timed out", func() { double("a") })
+}
@@ -0,0 +1,165 @@
+package template_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/pastdev/clconf/v3/pkg/secret"
+	"github.com/pastdev/clconf/v3/pkg/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSandbox(t *testing.T) {
+	t.Setenv("APP_NAME", "app")
+	t.Setenv("SECRET_TOKEN", "token")
+	sa, err := secret.NewTestSecretAgent()
+	require.NoError(t, err)
+	encrypted, err := sa.Encrypt("password")
+	require.NoError(t, err)
+	data := map[interface{}]interface{}{
+		"app":     map[interface{}]interface{}{"secrets": map[interface{}]interface{}{"db": encrypted}},
+		"other":   encrypted,
+		"name":    "foo",
+		"numbers": []interface{}{1, 2},
+	}
+
+	tests := []struct {
+		name     string
+		text     string
+		sandbox  template.Sandbox
+		expected string
+		parseErr string
+		err      string
+	}{
+		{name: "getv", text: `{{ getv "/name" | toUpper }}`, expected: "FOO"},
+		{
+			name:     "getenv allowed",
+			text:     `{{ getenv "APP_NAME" }}`,
+			sandbox:  template.Sandbox{Env: []string{"APP_*"}},
+			expected: "app",
+		},
+		{name: "getenv denied", text: `[{{ getenv "SECRET_TOKEN" }}]`, expected: "[]"},
+		{
+			name:     "decrypt allowed",
+			text:     `{{ cgetv "/app/secrets/db" }}`,
+			sandbox:  template.Sandbox{Decrypt: []string{"/app/secrets/"}},
+			expected: "password",
+		},
+		{
+			name:    "decrypt denied",
+			text:    `{{ cgetv "/other" }}`,
+			sandbox: template.Sandbox{Decrypt: []string{"/app/secrets"}},
+			err:     "decryption is not allowed",
+		},
+		{name: "decrypt prefix", text: `{{ cgetvs "/app/*" }}`,
+			sandbox: template.Sandbox{Decrypt: []string{"/app/secrets"}},
+			err:     "decryption is not allowed",
+		},
+		{name: "denied func", text: `{{ fileExists "/etc/passwd" }}`, parseErr: `function "fileExists" not defined`},
+		{
+			name:     "allowlist",
+			text:     `{{ getv "/name" }}`,
+			sandbox:  template.Sandbox{Funcs: []string{"getv"}},
+			expected: "foo",
+		},
+		{
+			name:     "allowlist denied",
+			text:     `{{ getv "/name" | toUpper }}`,
+			sandbox:  template.Sandbox{Funcs: []string{"getv"}},
+			parseErr: `function "toUpper" not defined`,
+		},
+		{name: "output denied", text: `{{ output "a" }}`, parseErr: `function "output" not defined`},
+		{
+			name:    "repeat limit",
+			text:    `{{ $x := repeat 300000000 "xxxxxxxxxx" }}`,
+			sandbox: template.Sandbox{MaxOutput: 100},
+			err:     "repeat: template output limit exceeded",
+		},
+		{
+			name:    "indent limit",
+			text:    `{{ $x := indent 1000000000 "a\nb" }}`,
+			sandbox: template.Sandbox{MaxOutput: 100},
+			err:     "indent: template output limit exceeded",
+		},
+		{
+			name:    "nindent limit",
+			text:    `{{ $x := nindent 1000000000 "a" }}`,
+			sandbox: template.Sandbox{MaxOutput: 100},
+			err:     "nindent: template output limit exceeded",
+		},
+		{
+			name:    "seq limit",
+			text:    `{{ range seq -9223372036854775808 9223372036854775807 }}{{ end }}`,
+			sandbox: template.Sandbox{MaxOutput: 100},
+			err:     "seq: template output limit exceeded",
+		},
+		{
+			name: "include limit",
+			text: `{{ define "big" }}{{ range seq 1 20 }}0123456789{{ end }}{{ end }}` +
+				`{{ $x := include "big" . }}`,
+			sandbox: template.Sandbox{MaxOutput: 100},
+			err:     "template output limit exceeded",
+		},
+		{
+			name:    "result limit",
+			text:    `{{ $x := repeat 60 "x" }}{{ $y := cat $x $x }}`,
+			sandbox: template.Sandbox{MaxOutput: 100},
+			err:     "cat: template output limit exceeded",
+		},
+		{
+			name:     "within limits",
+			text:     `{{ repeat 2 "ab" }}{{ indent 2 "a" }}{{ seq 1 3 }}`,
+			sandbox:  template.Sandbox{MaxOutput: 100},
+			expected: "abab  a[1 2 3]",
+		},
+		{
+			name:    "max output",
+			text:    `{{ range seq 1 100 }}0123456789{{ end }}`,
+			sandbox: template.Sandbox{MaxOutput: 100},
+			err:     "output limit exceeded",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			sandbox := test.sandbox
+			tmpl, err := template.NewTemplate(test.name, test.text,
+				&template.TemplateConfig{SecretAgent: sa, Sandbox: &sandbox})
+			if test.parseErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.parseErr)
+				return
+			}
+			require.NoError(t, err)
+			actual, err := tmpl.Execute(data)
+			if test.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestSandboxTimeout(t *testing.T) {
+	sandbox := &template.Sandbox{Timeout: 50 * time.Millisecond}
+	tmpl, err := template.NewTemplate("fast", `{{ getv "/name" }}`, &template.TemplateConfig{Sandbox: sandbox})
+	require.NoError(t, err)
+	actual, err := tmpl.Execute(map[interface{}]interface{}{"name": "foo"})
+	require.NoError(t, err)
+	assert.Equal(t, "foo", actual)
+
+	// writes after the deadline stop the execution
+	tmpl, err = template.NewTemplate("slow", `{{ range 1000000000 }}{{ . }}{{ end }}`,
+		&template.TemplateConfig{Sandbox: sandbox})
+	require.NoError(t, err)
+	start := time.Now()
+	_, err = tmpl.Execute(nil)
+	require.ErrorIs(t, err, template.ErrTimeout)
+	assert.Less(t, time.Since(start), 5*time.Second)
+
+	_, err = tmpl.Execute(nil)
+	assert.ErrorIs(t, err, template.ErrTimeout)
+}
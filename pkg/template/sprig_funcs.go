@@ -0,0 +1,628 @@
+package template
+
+import (
+	"crypto/rand"
+	"crypto/sha1" //nolint:gosec // sha1sum is a checksum, not for security
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"math"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/pastdev/clconf/v3/pkg/yamljson"
+)
+
+// sprigFuncs returns functions compatible (in name, argument order and
+// result) with those of the same name in sprig:
+//
+//	https://masterminds.github.io/sprig/
+//
+// Where a confd function already uses a name (ie: add, contains, join,
+// replace, split, trimSuffix) the confd function is kept.
+func sprigFuncs() map[string]interface{} {
+	return map[string]interface{}{
+		// defaults
+		"coalesce": Coalesce,
+		"default":  Default,
+		"empty":    Empty,
+		"required": Required,
+		"ternary":  Ternary,
+
+		// strings
+		"b64dec":     Base64Decode,
+		"b64enc":     Base64Encode,
+		"cat":        Cat,
+		"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+		"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+		"lower":      strings.ToLower,
+		"nospace":    func(s string) string { return strings.Map(dropSpace, s) },
+		"quote":      Quote,
+		"regexMatch": RegexMatch,
+		"repeat":     func(count int, s string) string { return strings.Repeat(s, count) },
+		"splitList":  func(sep, s string) []string { return strings.Split(s, sep) },
+		"squote":     Squote,
+		"substr":     Substr,
+		"title":      Title,
+		"toString":   toString,
+		"trim":       strings.TrimSpace,
+		"trimAll":    func(cutset, s string) string { return strings.Trim(s, cutset) },
+		"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+		"trunc":      Trunc,
+		"upper":      strings.ToUpper,
+
+		// lists and dicts
+		"dict":   Dict,
+		"first":  First,
+		"has":    Has,
+		"hasKey": HasKey,
+		"keys":   Keys,
+		"last":   Last,
+		"list":   List,
+		"pluck":  Pluck,
+		"uniq":   Uniq,
+		"values": Values,
+
+		// encoding
+		"fromJson":     FromJSON,
+		"fromYaml":     FromYaml,
+		"toJson":       ToJSON,
+		"toPrettyJson": MarshalPrettyJSON,
+		"toYaml":       ToYaml,
+
+		// hashes and ids
+		"sha1sum":   func(s string) string { return hashHex(sha1.New(), s) }, //nolint:gosec // checksum
+		"sha256sum": func(s string) string { return hashHex(sha256.New(), s) },
+		"uuidv4":    UUIDv4,
+
+		// math
+		"add1":    func(a interface{}) int64 { return toInt64(a) + 1 },
+		"addf":    func(a, b interface{}) float64 { return toFloat64(a) + toFloat64(b) },
+		"ceil":    func(a interface{}) float64 { return math.Ceil(toFloat64(a)) },
+		"divf":    func(a, b interface{}) float64 { return toFloat64(a) / toFloat64(b) },
+		"float64": toFloat64,
+		"floor":   func(a interface{}) float64 { return math.Floor(toFloat64(a)) },
+		"int":     func(a interface{}) int { return int(toInt64(a)) },
+		"int64":   toInt64,
+		"max":     Max,
+		"maxf":    Maxf,
+		"min":     Min,
+		"minf":    Minf,
+		"mulf":    func(a, b interface{}) float64 { return toFloat64(a) * toFloat64(b) },
+		"round":   Round,
+		"subf":    func(a, b interface{}) float64 { return toFloat64(a) - toFloat64(b) },
+	}
+}
+
+// addSprigFuncs adds the sprigFuncs to funcMap without replacing any
+// function already in it.
+func addSprigFuncs(funcMap map[string]interface{}) {
+	for name, fn := range sprigFuncs() {
+		if _, ok := funcMap[name]; !ok {
+			funcMap[name] = fn
+		}
+	}
+}
+
+// Cat joins the string form of each non nil value with a space.
+func Cat(values ...interface{}) string {
+	parts := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			parts = append(parts, toString(v))
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// Coalesce returns the first non empty value (see Empty) or nil.
+func Coalesce(values ...interface{}) interface{} {
+	for _, v := range values {
+		if !Empty(v) {
+			return v
+		}
+	}
+	return nil
+}
+
+// Default returns given if it is not empty (see Empty), otherwise
+// defaultValue. It is intended to be piped: {{ getenv "X" | default "y" }}.
+func Default(defaultValue interface{}, given ...interface{}) interface{} {
+	if len(given) == 0 || Empty(given[0]) {
+		return defaultValue
+	}
+	return given[0]
+}
+
+// Dict creates a map from alternating keys and values. Keys are converted to
+// strings and a missing final value is an empty string.
+func Dict(keysAndValues ...interface{}) map[string]interface{} {
+	dict := make(map[string]interface{}, (len(keysAndValues)+1)/2)
+	for i := 0; i < len(keysAndValues); i += 2 {
+		var value interface{} = ""
+		if i+1 < len(keysAndValues) {
+			value = keysAndValues[i+1]
+		}
+		dict[toString(keysAndValues[i])] = value
+	}
+	return dict
+}
+
+// Empty returns true if value is nil, false, zero, or an empty string,
+// list or map.
+func Empty(value interface{}) bool {
+	v := reflect.ValueOf(value)
+	if !v.IsValid() {
+		return true
+	}
+	switch v.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return v.Len() == 0
+	case reflect.Ptr, reflect.Interface:
+		return v.IsNil() || Empty(v.Elem().Interface())
+	case reflect.Struct:
+		return false
+	default:
+		return v.IsZero()
+	}
+}
+
+// First returns the first element of list or nil if empty.
+func First(list interface{}) (interface{}, error) {
+	items, err := toList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[0], nil
+}
+
+// FromJSON unmarshals a json document.
+func FromJSON(data string) (interface{}, error) {
+	var v interface{}
+	err := json.Unmarshal([]byte(data), &v)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal json: %w", err)
+	}
+	return v, nil
+}
+
+// FromYaml unmarshals a yaml document into string keyed maps (an empty
+// document results in an empty map).
+func FromYaml(data string) (interface{}, error) {
+	docs, err := yamljson.UnmarshalAllYaml(data)
+	if err != nil {
+		return nil, fmt.Errorf("unmarshal yaml: %w", err)
+	}
+	switch len(docs) {
+	case 0:
+		return map[string]interface{}{}, nil
+	case 1:
+		return yamljson.ConvertMapIToMapS(docs[0]), nil
+	default:
+		return nil, fmt.Errorf("unmarshal yaml: expected one document, found %d", len(docs))
+	}
+}
+
+// Has returns true if list contains needle.
+func Has(needle interface{}, list interface{}) (bool, error) {
+	items, err := toList(list)
+	if err != nil {
+		return false, err
+	}
+	for _, item := range items {
+		if reflect.DeepEqual(item, needle) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// HasKey returns true if dict contains key.
+func HasKey(dict interface{}, key string) (bool, error) {
+	entries, err := toDict(dict)
+	if err != nil {
+		return false, err
+	}
+	_, ok := entries[key]
+	return ok, nil
+}
+
+// Keys returns the sorted, unique, keys of all dicts.
+func Keys(dicts ...interface{}) ([]string, error) {
+	unique := map[string]bool{}
+	for _, dict := range dicts {
+		entries, err := toDict(dict)
+		if err != nil {
+			return nil, err
+		}
+		for key := range entries {
+			unique[key] = true
+		}
+	}
+	keys := make([]string, 0, len(unique))
+	for key := range unique {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys, nil
+}
+
+// Last returns the last element of list or nil if empty.
+func Last(list interface{}) (interface{}, error) {
+	items, err := toList(list)
+	if err != nil || len(items) == 0 {
+		return nil, err
+	}
+	return items[len(items)-1], nil
+}
+
+// List creates a list from its arguments.
+func List(values ...interface{}) []interface{} {
+	return values
+}
+
+// MarshalPrettyJSON is ToJSON indented.
+func MarshalPrettyJSON(data interface{}) (string, error) {
+	v, err := json.MarshalIndent(jsonCompatible(data), "", "  ")
+	if err != nil {
+		return "", fmt.Errorf("json marshal: %w", err)
+	}
+	return string(v), nil
+}
+
+// Max returns the largest of the integers.
+func Max(a interface{}, others ...interface{}) int64 {
+	result := toInt64(a)
+	for _, other := range others {
+		if v := toInt64(other); v > result {
+			result = v
+		}
+	}
+	return result
+}
+
+// Maxf returns the largest of the numbers.
+func Maxf(a interface{}, others ...interface{}) float64 {
+	result := toFloat64(a)
+	for _, other := range others {
+		result = math.Max(result, toFloat64(other))
+	}
+	return result
+}
+
+// Min returns the smallest of the integers.
+func Min(a interface{}, others ...interface{}) int64 {
+	result := toInt64(a)
+	for _, other := range others {
+		if v := toInt64(other); v < result {
+			result = v
+		}
+	}
+	return result
+}
+
+// Minf returns the smallest of the numbers.
+func Minf(a interface{}, others ...interface{}) float64 {
+	result := toFloat64(a)
+	for _, other := range others {
+		result = math.Min(result, toFloat64(other))
+	}
+	return result
+}
+
+// Pluck returns the value of key in each dict that has it.
+func Pluck(key string, dicts ...interface{}) ([]interface{}, error) {
+	values := []interface{}{}
+	for _, dict := range dicts {
+		entries, err := toDict(dict)
+		if err != nil {
+			return nil, err
+		}
+		if value, ok := entries[key]; ok {
+			values = append(values, value)
+		}
+	}
+	return values, nil
+}
+
+// Quote returns the double quoted (go escaped) string form of each non nil
+// value, separated by spaces.
+func Quote(values ...interface{}) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			quoted = append(quoted, strconv.Quote(toString(v)))
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// RegexMatch returns true if s contains a match of regex.
+func RegexMatch(regex, s string) (bool, error) {
+	matched, err := regexp.MatchString(regex, s)
+	if err != nil {
+		return false, fmt.Errorf("regex match: %w", err)
+	}
+	return matched, nil
+}
+
+// Required returns value or, if it is empty (see Empty), fails the template
+// with message.
+func Required(message string, value interface{}) (interface{}, error) {
+	if Empty(value) {
+		return nil, errors.New(message)
+	}
+	return value, nil
+}
+
+// Round rounds value to precision decimal places. Like sprig, the magnitude
+// is rounded up when its fraction (at precision) is at least the optional
+// roundOn (.5 by default), and down otherwise. Negative values are rounded
+// away from zero the same way.
+func Round(value interface{}, precision int, roundOn ...float64) float64 {
+	threshold := .5
+	if len(roundOn) > 0 {
+		threshold = roundOn[0]
+	}
+	pow := math.Pow(10, float64(precision))
+	digits := toFloat64(value) * pow
+	whole, fraction := math.Modf(math.Abs(digits))
+	if fraction >= threshold {
+		whole++
+	}
+	return math.Copysign(whole, digits) / pow
+}
+
+// Squote returns the single quoted string form of each non nil value,
+// separated by spaces.
+func Squote(values ...interface{}) string {
+	quoted := make([]string, 0, len(values))
+	for _, v := range values {
+		if v != nil {
+			quoted = append(quoted, "'"+toString(v)+"'")
+		}
+	}
+	return strings.Join(quoted, " ")
+}
+
+// Substr returns the bytes of s from start to end. A negative start is
+// treated as 0 and a negative end, or one past the end of s, as len(s).
+func Substr(start, end int, s string) string {
+	if start < 0 {
+		start = 0
+	}
+	if end < 0 || end > len(s) {
+		end = len(s)
+	}
+	if start > end {
+		return ""
+	}
+	return s[start:end]
+}
+
+// Ternary returns trueValue if condition, otherwise falseValue. It is
+// intended to be piped: {{ eq 1 1 | ternary "yes" "no" }}.
+func Ternary(trueValue, falseValue interface{}, condition bool) interface{} {
+	if condition {
+		return trueValue
+	}
+	return falseValue
+}
+
+// Title upper cases the first letter of each space separated word.
+func Title(s string) string {
+	runes := []rune(s)
+	for i, r := range runes {
+		if i == 0 || unicode.IsSpace(runes[i-1]) {
+			runes[i] = unicode.ToTitle(r)
+		}
+	}
+	return string(runes)
+}
+
+// ToJSON returns the json representation of value. Unlike asJson, maps with
+// interface{} keys (as unmarshaled from yaml) are supported.
+func ToJSON(value interface{}) (string, error) {
+	return MarshalJSON(jsonCompatible(value))
+}
+
+// ToYaml returns the yaml representation of value without a trailing
+// newline (so it can be piped to indent).
+func ToYaml(value interface{}) (string, error) {
+	data, err := yamljson.MarshalYaml(value)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(string(data), "\n"), nil
+}
+
+// Trunc returns the first length bytes of s, or if length is negative, the
+// last -length bytes.
+func Trunc(length int, s string) string {
+	switch {
+	case length < 0 && length > -len(s):
+		return s[len(s)+length:]
+	case length >= 0 && length < len(s):
+		return s[:length]
+	default:
+		return s
+	}
+}
+
+// Uniq returns list without duplicates, in the order of their first
+// occurrence.
+func Uniq(list interface{}) ([]interface{}, error) {
+	items, err := toList(list)
+	if err != nil {
+		return nil, err
+	}
+	result := []interface{}{}
+	for _, item := range items {
+		if has, _ := Has(item, result); !has {
+			result = append(result, item)
+		}
+	}
+	return result, nil
+}
+
+// UUIDv4 returns a new random (version 4) UUID.
+func UUIDv4() (string, error) {
+	var uuid [16]byte
+	_, err := rand.Read(uuid[:])
+	if err != nil {
+		return "", fmt.Errorf("uuid random: %w", err)
+	}
+	uuid[6] = (uuid[6] & 0x0f) | 0x40
+	uuid[8] = (uuid[8] & 0x3f) | 0x80
+	s := hex.EncodeToString(uuid[:])
+	return s[0:8] + "-" + s[8:12] + "-" + s[12:16] + "-" + s[16:20] + "-" + s[20:], nil
+}
+
+// Values returns the values of dict ordered by their keys.
+func Values(dict interface{}) ([]interface{}, error) {
+	keys, err := Keys(dict)
+	if err != nil {
+		return nil, err
+	}
+	entries, _ := toDict(dict)
+	values := make([]interface{}, 0, len(keys))
+	for _, key := range keys {
+		values = append(values, entries[key])
+	}
+	return values, nil
+}
+
+func dropSpace(r rune) rune {
+	if unicode.IsSpace(r) {
+		return -1
+	}
+	return r
+}
+
+func hashHex(h hash.Hash, s string) string {
+	_, _ = h.Write([]byte(s))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// jsonCompatible returns a copy of value with all maps converted to string
+// keyed maps.
+func jsonCompatible(value interface{}) interface{} {
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Map:
+		entries, _ := toDict(value)
+		converted := make(map[string]interface{}, len(entries))
+		for key, entry := range entries {
+			converted[key] = jsonCompatible(entry)
+		}
+		return converted
+	case reflect.Slice:
+		if _, ok := value.([]byte); ok {
+			return value
+		}
+		items, _ := toList(value)
+		converted := make([]interface{}, len(items))
+		for i, item := range items {
+			converted[i] = jsonCompatible(item)
+		}
+		return converted
+	default:
+		return value
+	}
+}
+
+// toDict returns the entries of any map, with the keys converted to strings
+// (yaml maps have interface{} keys).
+func toDict(dict interface{}) (map[string]interface{}, error) {
+	if entries, ok := dict.(map[string]interface{}); ok {
+		return entries, nil
+	}
+	v := reflect.ValueOf(dict)
+	if v.Kind() != reflect.Map {
+		return nil, fmt.Errorf("expected a dict, found %T", dict)
+	}
+	entries := make(map[string]interface{}, v.Len())
+	iter := v.MapRange()
+	for iter.Next() {
+		entries[toString(iter.Key().Interface())] = iter.Value().Interface()
+	}
+	return entries, nil
+}
+
+func toFloat64(value interface{}) float64 {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.Bool:
+		if v.Bool() {
+			return 1
+		}
+		return 0
+	case reflect.String:
+		f, _ := strconv.ParseFloat(v.String(), 64)
+		return f
+	default:
+		return 0
+	}
+}
+
+func toInt64(value interface{}) int64 {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return v.Int()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return int64(v.Uint()) //nolint:gosec // sprig compatible truncation
+	case reflect.String:
+		if i, err := strconv.ParseInt(v.String(), 0, 64); err == nil {
+			return i
+		}
+		return int64(toFloat64(value))
+	default:
+		return int64(toFloat64(value))
+	}
+}
+
+// toList returns the elements of any slice or array.
+func toList(list interface{}) ([]interface{}, error) {
+	if items, ok := list.([]interface{}); ok {
+		return items, nil
+	}
+	v := reflect.ValueOf(list)
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return nil, fmt.Errorf("expected a list, found %T", list)
+	}
+	items := make([]interface{}, v.Len())
+	for i := range items {
+		items[i] = v.Index(i).Interface()
+	}
+	return items, nil
+}
+
+func toString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case nil:
+		return ""
+	case []byte:
+		return string(v)
+	case fmt.Stringer:
+		return v.String()
+	case error:
+		return v.Error()
+	default:
+		return fmt.Sprintf("%v", v)
+	}
+}
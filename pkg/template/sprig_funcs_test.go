@@ -0,0 +1,78 @@
+package template_test
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/pastdev/clconf/v3/pkg/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSprigFuncs(t *testing.T) {
+	data := map[interface{}]interface{}{
+		"app": map[interface{}]interface{}{
+			"name":  "web",
+			"empty": "",
+		},
+	}
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"default", `{{ getv "/app/empty" | default "x" }}`, "x"},
+		{"default given", `{{ getv "/app/name" | default "x" }}`, "web"},
+		{"empty", `{{ empty "" }} {{ empty 0 }} {{ empty (list) }} {{ empty "a" }}`, "true true true false"},
+		{"coalesce", `{{ coalesce "" 0 "a" "b" }}`, "a"},
+		{"ternary", `{{ eq 1 1 | ternary "yes" "no" }}`, "yes"},
+		{"quote", `{{ quote "a\"b" 1 }} {{ squote "a" }}`, `"a\"b" "1" 'a'`},
+		{"trim", `[{{ trim "  a  " }}][{{ trimAll "$" "$5$" }}][{{ trimPrefix "-" "-a" }}]`, "[a][5][a]"},
+		{"confd trimSuffix", `{{ trimSuffix "a.clconf" ".clconf" }}`, "a"},
+		{"hasPrefix", `{{ hasPrefix "we" "web" }} {{ hasSuffix "x" "web" }}`, "true false"},
+		{"case", `{{ upper "a" }}{{ lower "B" }} {{ title "hello world" }}`, "Ab Hello World"},
+		{"strings", `{{ repeat 2 "ab" }} {{ substr 1 3 "abcd" }} {{ trunc 2 "abc" }} {{ nospace "a b" }}`, "abab bc ab ab"},
+		{"trunc", `{{ trunc -2 "abc" }} {{ trunc 5 "abc" }} {{ trunc -9223372036854775808 "abc" }}`, "bc abc abc"},
+		{"cat", `{{ cat "a" 1 nil "b" }}`, "a 1 b"},
+		{"splitList", `{{ splitList "," "a,b" | last }}`, "b"},
+		{"dict", `{{ $d := dict "a" 1 "b" 2 }}{{ keys $d }} {{ values $d }} {{ hasKey $d "a" }}`, "[a b] [1 2] true"},
+		{"list", `{{ $l := list 1 2 2 3 }}{{ first $l }} {{ last $l }} {{ uniq $l }} {{ has 3 $l }}`, "1 3 [1 2 3] true"},
+		{"pluck", `{{ pluck "a" (dict "a" 1) (dict "b" 2) (dict "a" 3) }}`, "[1 3]"},
+		{"toJson", `{{ fromYaml "a: [1, {b: c}]" | toJson }}`, `{"a":[1,{"b":"c"}]}`},
+		{"toYaml", `{{ dict "a" (list 1 2) | toYaml }}`, "a:\n- 1\n- 2"},
+		{"fromJson", `{{ (fromJson "{\"a\": 1}").a }}`, "1"},
+		{"sha256sum", `{{ sha256sum "abc" }}`, "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"math", `{{ addf 1.5 2 }} {{ subf 3 0.5 }} {{ mulf 2 1.5 }} {{ divf 1 4 }}`, "3.5 2.5 3 0.25"},
+		{"rounding", `{{ floor 1.5 }} {{ ceil 1.5 }} {{ round 2.567 2 }}`, "1 2 2.57"},
+		{"round on", `{{ round 3.745 2 0.4 }} {{ round 3.743 2 0.4 }} {{ round 3.746 2 0.8 }} {{ round -3.745 2 0.4 }}`,
+			"3.75 3.74 3.74 -3.75"},
+		{"round half", `{{ round 2.5 0 }} {{ round -2.5 0 }} {{ round -2.4 0 }} {{ round 1234 -2 }}`, "3 -3 -2 1200"},
+		{"minmax", `{{ max 1 3 2 }} {{ min 3 1 2 }} {{ maxf 1.5 2 }} {{ minf 1.5 2 }} {{ add1 1 }}`, "3 1 2 1.5 2"},
+		{"required", `{{ required "name required" (getv "/app/name") }}`, "web"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl, err := template.NewTemplate(test.name, test.text, nil)
+			require.NoError(t, err)
+			actual, err := tmpl.Execute(data)
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
+
+func TestSprigFuncsErrors(t *testing.T) {
+	tmpl, err := template.NewTemplate("required", `{{ required "name required" "" }}`, nil)
+	require.NoError(t, err)
+	_, err = tmpl.Execute(nil)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "name required")
+}
+
+func TestUUIDv4(t *testing.T) {
+	uuid, err := template.UUIDv4()
+	require.NoError(t, err)
+	assert.Regexp(t,
+		regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`),
+		uuid)
+}
@@ -0,0 +1,81 @@
+package template
+
+import (
+	"fmt"
+	"net"
+	"os"
+)
+
+// addStrictFuncs replaces the functions that silently return empty results
+// with ones that fail instead.
+func addStrictFuncs(funcMap map[string]interface{}) {
+	addLookupFuncs(funcMap, os.LookupEnv, net.LookupIP, net.LookupSRV, true)
+}
+
+// addLookupFuncs replaces getenv and the DNS lookup functions with ones
+// using lookupEnv, resolveIP and resolveSRV. If strict, they fail instead of
+// returning empty results.
+func addLookupFuncs(
+	funcMap map[string]interface{},
+	lookupEnv func(string) (string, bool),
+	resolveIP func(string) ([]net.IP, error),
+	resolveSRV func(service, proto, name string) (string, []*net.SRV, error),
+	strict bool,
+) {
+	funcMap["getenv"] = getenvFunc(lookupEnv, strict)
+	if strict {
+		AddFuncs(funcMap, map[string]interface{}{
+			"lookupIP": func(data string) ([]string, error) { return lookupIP(resolveIP, data) },
+			"lookupIPV4": func(data string) ([]string, error) {
+				ips, err := lookupIP(resolveIP, data)
+				return filterIPs(ips, "."), err
+			},
+			"lookupIPV6": func(data string) ([]string, error) {
+				ips, err := lookupIP(resolveIP, data)
+				return filterIPs(ips, ":"), err
+			},
+			"lookupSRV": func(service, proto, name string) ([]*net.SRV, error) {
+				return lookupSRV(resolveSRV, service, proto, name)
+			},
+		})
+		return
+	}
+
+	lenientIP := func(data string) []string {
+		ips, _ := lookupIP(resolveIP, data)
+		return ips
+	}
+	AddFuncs(funcMap, map[string]interface{}{
+		"lookupIP":   lenientIP,
+		"lookupIPV4": func(data string) []string { return filterIPs(lenientIP(data), ".") },
+		"lookupIPV6": func(data string) []string { return filterIPs(lenientIP(data), ":") },
+		"lookupSRV": func(service, proto, name string) []*net.SRV {
+			addrs, err := lookupSRV(resolveSRV, service, proto, name)
+			if err != nil {
+				return []*net.SRV{}
+			}
+			return addrs
+		},
+	})
+}
+
+// getenvFunc returns the getenv function reading from lookupEnv.
+func getenvFunc(lookupEnv func(string) (string, bool), strict bool) interface{} {
+	if strict {
+		return func(key string, v ...string) (string, error) {
+			return getenvStrict(lookupEnv, key, v...)
+		}
+	}
+	return func(key string, v ...string) string { return getenv(lookupEnv, key, v...) }
+}
+
+// getenvStrict is getenv that fails if no default is supplied and the
+// variable is not set.
+func getenvStrict(lookupEnv func(string) (string, bool), key string, v ...string) (string, error) {
+	if len(v) == 0 {
+		if _, ok := lookupEnv(key); !ok {
+			return "", fmt.Errorf("environment variable %s is not set", key)
+		}
+	}
+	return getenv(lookupEnv, key, v...), nil
+}
@@ -0,0 +1,48 @@
+package template_test
+
+import (
+	"testing"
+
+	"github.com/pastdev/clconf/v3/pkg/template"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestStrict(t *testing.T) {
+	t.Setenv("CLCONF_STRICT_SET", "foo")
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+		err      string
+	}{
+		{name: "getenv set", text: `{{ getenv "CLCONF_STRICT_SET" }}`, expected: "foo"},
+		{name: "getenv default", text: `{{ getenv "CLCONF_STRICT_UNSET" "bar" }}`, expected: "bar"},
+		{
+			name: "getenv unset",
+			text: "line one\n{{ getenv \"CLCONF_STRICT_UNSET\" }}",
+			err:  `getenv unset:2:3: executing "getenv unset" at <getenv "CLCONF_STRICT_UNSET">`,
+		},
+		{name: "missing key", text: `{{ (dict "a" 1).b }}`, err: `map has no entry for key "b"`},
+		{name: "lookup failure", text: `{{ lookupIP "clconf.invalid" }}`, err: "lookup ip"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			tmpl, err := template.NewTemplate(test.name, test.text, nil)
+			require.NoError(t, err)
+			_, err = tmpl.Execute(nil)
+			assert.NoError(t, err, "not strict")
+
+			tmpl, err = template.NewTemplate(test.name, test.text, &template.TemplateConfig{Strict: true})
+			require.NoError(t, err)
+			actual, err := tmpl.Execute(nil)
+			if test.err != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), test.err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, test.expected, actual)
+		})
+	}
+}
@@ -1,11 +1,13 @@
 package template
 
 import (
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
 
 	"github.com/pastdev/clconf/v3/pkg/secret"
 )
@@ -30,6 +32,14 @@ type TemplateOptions struct { //nolint:revive
 	Rm bool
 	// FileMode is the permissions to apply to template files when writing.
 	FileMode os.FileMode
+	// CopyTemplateOwner changes the owner and group of results, and new
+	// folders, to those of their template unless Uid or Gid is set.
+	CopyTemplateOwner bool
+	// Uid, if not nil, is the user id results and new folders will be owned by.
+	Uid *int //nolint:revive // consistent with os.Chown
+	// Gid, if not nil, is the group id results and new folders will be owned
+	// by.
+	Gid *int
 	// DirMode is the permission similar to FileMode but for new folders.
 	DirMode os.FileMode
 	// Extension is the extension to use when searching folders. If missing all files will be used.
@@ -39,49 +49,237 @@ type TemplateOptions struct { //nolint:revive
 	LeftDelim string
 	// RightDelim is passed to go teplate.Delims
 	RightDelim string
+	// DryRun renders templates and reports the resulting status without
+	// writing or removing any files.
+	DryRun bool
+	// Diff populates TemplateResult.Diff with a unified diff of the change to
+	// each destination.
+	Diff bool
+	// Jobs is the maximum number of templates processed concurrently
+	// (sequentially if less than 2).
+	Jobs int
+	// Filter, if not nil, limits processing to the templates whose (cleaned)
+	// path it returns true for.
+	Filter func(templatePath string) bool
+	// Include, if not empty, limits the templates found under a source
+	// folder to those matching at least one of these gitignore style
+	// patterns.
+	Include []string
+	// Exclude skips files and folders under a source folder matching any of
+	// these gitignore style patterns (in addition to those in IgnoreFile
+	// files).
+	Exclude []string
+	// Symlinks determines how symlinks under a source folder are handled
+	// (defaults to SymlinkFollow).
+	Symlinks SymlinkMode
+	// LibraryDirs are folders whose LibraryExtension files are parsed along
+	// with every template (see LoadLibraries). Library files are never
+	// rendered themselves, even when they are under a template source.
+	LibraryDirs []string
+	// Strict fails templates instead of producing empty output (see
+	// TemplateConfig.Strict).
+	Strict bool
+	// Fixtures, if not nil, make templates render reproducibly (see
+	// TemplateConfig.Fixtures).
+	Fixtures *Fixtures
+	// Sandbox, if not nil, restricts what templates can read and limits
+	// their execution (see TemplateConfig.Sandbox).
+	Sandbox *Sandbox
+	// Archive, if not nil, receives the results (named by their path
+	// relative to their source) instead of them being written to dest or
+	// in place. Every non empty result is reported as StatusCreated and
+	// templates are not removed (see Rm).
+	Archive TemplateArchive
+
+	// libraries are the contents of the LibraryDirs loaded by
+	// ProcessTemplates.
+	libraries map[string]string
+	// claims are the files written by the templates of a ProcessTemplates
+	// run.
+	claims *targetClaims
 }
 
 type pathWithRelative struct {
 	full string
 	rel  string
+	// link is the target of a symlink to be copied (see SymlinkCopy).
+	link string
 }
 
+// TemplateStatus describes what happened to the destination of a template.
+type TemplateStatus string //nolint:revive
+
+const (
+	// StatusCreated indicates the destination did not exist and was written.
+	StatusCreated TemplateStatus = "created"
+	// StatusUpdated indicates the destination content or mode was replaced.
+	StatusUpdated TemplateStatus = "updated"
+	// StatusUnchanged indicates the destination already had the result so it
+	// was not written.
+	StatusUnchanged TemplateStatus = "unchanged"
+	// StatusRemoved indicates the result was empty so the existing
+	// destination was removed.
+	StatusRemoved TemplateStatus = "removed"
+)
+
 // TemplateResult stores the result of a single template processing.
 type TemplateResult struct { //nolint:revive
-	Src  string
-	Dest string
+	Src    string
+	Dest   string
+	Status TemplateStatus
+	// Diff is a unified diff of the change to Dest (only when
+	// TemplateOptions.Diff).
+	Diff string
+	// Dependencies are the config keys the template read.
+	Dependencies Dependencies
+
+	// entry is the result pending being written to TemplateOptions.Archive.
+	entry *archiveEntry
 }
 
 // ProcessTemplates processes templates. If dest is non empty it must be a folder into which
 // templates will be placed after processing (the folder will be created if necessary). If empty
-// templates are processed into the folders in which they are found.
+// templates are processed into the folders in which they are found. Templates are processed
+// options.Jobs at a time but results are always in the order the templates were found. All
+// templates are processed even if some fail, the failures are returned joined.
 func ProcessTemplates(srcs []string, dest string, value interface{}, secretAgent *secret.SecretAgent,
 	options TemplateOptions,
 ) ([]TemplateResult, error) {
-	if dest != "" {
-		err := MkdirAllNoUmask(dest, options.DirMode)
+	if dest != "" && !options.DryRun && options.Archive == nil {
+		err := MkdirAllNoUmask(dest, options.DirMode, WithOwner(options.uid(), options.gid()))
 		if err != nil {
 			return nil, err
 		}
 	}
 
-	results := []TemplateResult{}
+	var err error
+	options.libraries, err = LoadLibraries(options.LibraryDirs...)
+	if err != nil {
+		return nil, err
+	}
+	excluded, err := libraryFiles(options.LibraryDirs)
+	if err != nil {
+		return nil, err
+	}
+
+	options.claims = &targetClaims{targets: map[string]string{}}
+
+	finder, err := newTemplateFinder(options)
+	if err != nil {
+		return nil, err
+	}
 
+	templates := []pathWithRelative{}
 	for _, templateSrc := range srcs {
-		templates, err := findTemplates(templateSrc, options.Extension)
+		found, err := finder.find(templateSrc)
 		if err != nil {
 			return nil, err
 		}
 
-		for _, template := range templates {
-			result, err := processTemplate(template, dest, value, secretAgent, options)
+		for _, template := range found {
+			if options.Filter != nil && !options.Filter(template.full) {
+				continue
+			}
+			if abs, err := filepath.Abs(template.full); err == nil && excluded[abs] {
+				continue
+			}
+			templates = append(templates, template)
+		}
+	}
+
+	templateResults := make([][]TemplateResult, len(templates))
+	errs := make([]error, len(templates))
+	forEachJob(len(templates), options.Jobs, func(i int) {
+		templateResults[i], errs[i] = processTemplate(templates[i], dest, value, secretAgent, options)
+	})
+
+	results := []TemplateResult{}
+	for _, r := range templateResults {
+		results = append(results, r...)
+	}
+	if options.Archive != nil {
+		for _, result := range results {
+			err = result.entry.write(options.Archive)
 			if err != nil {
-				return nil, err
+				errs = append(errs, err)
+				break
 			}
-			results = append(results, result)
 		}
 	}
-	return results, nil
+	return results, errors.Join(errs...)
+}
+
+// targetClaims records the template writing each file in a run of
+// ProcessTemplates so that two templates (ie: an output of one and the
+// result of another) can not silently overwrite each other.
+type targetClaims struct {
+	mu      sync.Mutex
+	targets map[string]string
+}
+
+func claimKey(target string) string {
+	if abs, err := filepath.Abs(target); err == nil {
+		return abs
+	}
+	return filepath.Clean(target)
+}
+
+// claim records that the template at src writes target, failing if another
+// template already does.
+func (c *targetClaims) claim(target, src string) error {
+	if c == nil {
+		return nil
+	}
+	key := claimKey(target)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if other, ok := c.targets[key]; ok && other != src {
+		return fmt.Errorf("%s is written by both %s and %s", target, other, src)
+	}
+	c.targets[key] = src
+	return nil
+}
+
+// ifUnclaimed calls fn unless target is written by another template than
+// src, holding the claims so that target can not be claimed until fn is done.
+func (c *targetClaims) ifUnclaimed(target, src string, fn func() error) error {
+	if c == nil {
+		return fn()
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if other, ok := c.targets[claimKey(target)]; ok && other != src {
+		return nil
+	}
+	return fn()
+}
+
+// forEachJob calls job for each index in [0, count) using at most jobs
+// concurrent goroutines.
+func forEachJob(count, jobs int, job func(i int)) {
+	if jobs < 2 {
+		for i := 0; i < count; i++ {
+			job(i)
+		}
+		return
+	}
+
+	indexes := make(chan int)
+	var wg sync.WaitGroup
+	for worker := 0; worker < jobs && worker < count; worker++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range indexes {
+				job(i)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		indexes <- i
+	}
+	close(indexes)
+	wg.Wait()
 }
 
 func processTemplate(
@@ -90,37 +288,66 @@ func processTemplate(
 	value interface{},
 	secretAgent *secret.SecretAgent,
 	options TemplateOptions,
-) (TemplateResult, error) {
+) ([]TemplateResult, error) {
 	var mode os.FileMode
 	var err error
 
-	result := TemplateResult{}
+	if paths.link != "" && options.Archive != nil {
+		name := archiveName(paths, options)
+		return []TemplateResult{{
+			Src:    paths.full,
+			Dest:   name,
+			Status: StatusCreated,
+			entry:  &archiveEntry{name: name, link: paths.link},
+		}}, nil
+	}
+	if paths.link != "" {
+		target := templateTarget(paths, dest, options)
+		err = options.claims.claim(target, paths.full)
+		if err != nil {
+			return nil, err
+		}
+		result, err := copyLink(paths, target, options)
+		if err != nil {
+			return nil, err
+		}
+		return []TemplateResult{result}, nil
+	}
 
 	if options.CopyTemplatePerms {
 		stat, err := os.Stat(paths.full)
 		if err != nil {
-			return result, fmt.Errorf("stat for copy perms: %w", err)
+			return nil, fmt.Errorf("stat for copy perms: %w", err)
 		}
 		mode = stat.Mode()
 	} else {
 		mode = options.FileMode
 	}
 
-	var target = paths.full
-	if dest != "" {
-		if options.Flatten {
-			target = filepath.Join(dest, filepath.Base(target))
-		} else {
-			target = filepath.Join(dest, paths.rel)
+	uid, gid := options.uid(), options.gid()
+	if options.CopyTemplateOwner {
+		stat, err := os.Stat(paths.full)
+		if err != nil {
+			return nil, fmt.Errorf("stat for copy owner: %w", err)
+		}
+		if templateUID, templateGID, ok := fileOwner(stat); ok {
+			if uid == -1 {
+				uid = templateUID
+			}
+			if gid == -1 {
+				gid = templateGID
+			}
 		}
 	}
 
-	target = strings.TrimSuffix(target, options.Extension)
+	target := templateTarget(paths, dest, options)
 
-	targetDir := filepath.Dir(target)
-	err = MkdirAllNoUmask(targetDir, options.DirMode)
-	if err != nil {
-		return result, fmt.Errorf("making target dir %q: %w", targetDir, err)
+	if !options.DryRun && options.Archive == nil {
+		targetDir := filepath.Dir(target)
+		err = MkdirAllNoUmask(targetDir, options.DirMode, WithOwner(uid, gid))
+		if err != nil {
+			return nil, fmt.Errorf("making target dir %q: %w", targetDir, err)
+		}
 	}
 
 	template, err := NewTemplateFromFile(paths.rel, paths.full,
@@ -128,86 +355,139 @@ func processTemplate(
 			SecretAgent: secretAgent,
 			LeftDelim:   options.LeftDelim,
 			RightDelim:  options.RightDelim,
+			Libraries:   options.libraries,
+			Strict:      options.Strict,
+			Fixtures:    options.Fixtures,
+			Sandbox:     options.Sandbox,
+			Outputs:     true,
 		})
 	if err != nil {
-		return result, err
+		return nil, err
 	}
 
 	content, err := template.Execute(value)
 	if err != nil {
-		return result, fmt.Errorf("processing template: %w", err)
+		return nil, fmt.Errorf("processing template %s: %w", paths.full, err)
+	}
+	content, outputs, err := template.splitOutputs(content)
+	if err != nil {
+		return nil, fmt.Errorf("processing template %s: %w", paths.full, err)
 	}
 
-	if options.KeepEmpty || content != "" {
-		err = os.WriteFile(target, []byte(content), mode)
+	if options.Archive != nil {
+		results, err := archiveResults(paths.full, archiveName(paths, options), content, outputs,
+			mode, uid, gid, options)
 		if err != nil {
-			return result, fmt.Errorf("write target: %w", err)
+			return nil, fmt.Errorf("processing template %s: %w", paths.full, err)
 		}
-
-		if !options.KeepExistingPerms {
-			// WriteFile only uses the mode if the file is created during write
-			// and even then filters on the umask so we os.Chmod to get the
-			// requested perms.
-			err = os.Chmod(target, mode)
-			if err != nil {
-				return result, fmt.Errorf("chmod target: %w", err)
-			}
+		dependencies := template.Dependencies()
+		for i := range results {
+			results[i].Dependencies = dependencies
 		}
-	} else { // Don't keep the empty result
-		_, err = os.Stat(target)
-		if err == nil {
-			err = os.Remove(target)
+		return results, nil
+	}
+
+	results := []TemplateResult{}
+	// a template that only writes outputs has no result of its own (though
+	// one from a previous run is removed)
+	if len(outputs) == 0 || content != "" || isRegularFile(target) {
+		err = options.claims.claim(target, paths.full)
+		if err != nil {
+			return nil, err
 		}
-		if err != nil && !os.IsNotExist(err) {
-			return result, fmt.Errorf("remove empty: %w", err)
+		result, err := writeTarget(paths.full, target, []byte(content), mode, uid, gid, options)
+		if err != nil {
+			return nil, err
 		}
+		results = append(results, result)
 	}
 
-	if options.Rm && paths.full != target {
+	outputResults, err := processOutputs(paths.full, target, outputs, mode, uid, gid, options)
+	if err != nil {
+		return nil, err
+	}
+	results = append(results, outputResults...)
+
+	dependencies := template.Dependencies()
+	for i := range results {
+		results[i].Dependencies = dependencies
+	}
+
+	if !options.DryRun && options.Rm && paths.full != target {
 		err = os.Remove(paths.full)
 		if err != nil {
-			return result, fmt.Errorf("remove template: %w", err)
+			return nil, fmt.Errorf("remove template: %w", err)
 		}
 	}
 
-	result.Dest = target
-	result.Src = paths.full
+	return results, nil
+}
 
-	return result, nil
+// templateTarget returns the path the result of the template at paths is
+// written to.
+func templateTarget(paths pathWithRelative, dest string, options TemplateOptions) string {
+	var target = paths.full
+	if dest != "" {
+		if options.Flatten {
+			target = filepath.Join(dest, filepath.Base(target))
+		} else {
+			target = filepath.Join(dest, paths.rel)
+		}
+	}
+
+	return strings.TrimSuffix(target, options.Extension)
 }
 
-// findTemplates returns the templates under the given path as strings in the format
-// <relativePath> + os.PathListSeparator + <fullPath>
-func findTemplates(startPath string, extension string) ([]pathWithRelative, error) {
-	var result []pathWithRelative
-	startPath = filepath.Clean(startPath)
+// writeTarget plans the change for target to hold content and, unless
+// options.DryRun, applies it.
+func writeTarget(
+	src, target string,
+	content []byte,
+	mode os.FileMode,
+	uid, gid int,
+	options TemplateOptions,
+) (TemplateResult, error) {
+	result := TemplateResult{Src: src, Dest: target}
 
-	err := filepath.Walk(startPath, func(path string, info os.FileInfo, err error) error {
-		if err != nil {
-			return err
-		}
-		if !info.IsDir() && (strings.HasSuffix(path, extension) || path == startPath) {
-			relPath, err := filepath.Rel(startPath, path)
+	change, err := planTarget(target, content, mode, uid, gid, options)
+	if err != nil {
+		return result, err
+	}
+	result.Status = change.status
+	if options.Diff {
+		result.Diff = change.diff(target)
+	}
+
+	if !options.DryRun {
+		if change.status == StatusCreated {
+			targetDir := filepath.Dir(target)
+			err = MkdirAllNoUmask(targetDir, options.DirMode, WithOwner(uid, gid))
 			if err != nil {
-				return fmt.Errorf("reltative path: %w", err)
-			}
-			if strings.HasPrefix(relPath, "..") {
-				return fmt.Errorf("path %q somehow ended up outside starting path %q (relpath: %q)",
-					path, startPath, relPath)
-			}
-			if relPath == "." {
-				relPath = filepath.Base(path)
+				return result, fmt.Errorf("making target dir %q: %w", targetDir, err)
 			}
-			result = append(result, pathWithRelative{rel: relPath, full: path})
 		}
-		return nil
-	})
-	if err != nil {
-		return nil, fmt.Errorf("find templates: %w", err)
+		err = change.apply(target)
+		if err != nil {
+			return result, err
+		}
 	}
 	return result, nil
 }
 
+func (options TemplateOptions) uid() int {
+	if options.Uid == nil {
+		return -1
+	}
+	return *options.Uid
+}
+
+func (options TemplateOptions) gid() int {
+	if options.Gid == nil {
+		return -1
+	}
+	return *options.Gid
+}
+
 // UnixModeToFileMode converts a unix file mode including special bits to a golang os.FileMode.
 // The special bits (sticky, setuid, setgid) don't line up exactly between the two.
 // Example: 02777 would set the setuid bit on unix but would end up 0777 if used as an os.FileMode
@@ -118,12 +118,16 @@ func Fqdn(hostname, domain string) string {
 // It returns the value, which will the default value if the variable is not present.
 // If no default value was given - returns "".
 func Getenv(key string, v ...string) string {
+	return getenv(os.LookupEnv, key, v...)
+}
+
+func getenv(lookupEnv func(string) (string, bool), key string, v ...string) string {
 	defaultValue := ""
 	if len(v) > 0 {
 		defaultValue = v[0]
 	}
 
-	value := os.Getenv(key)
+	value, _ := lookupEnv(key)
 	if value == "" {
 		return defaultValue
 	}
@@ -175,10 +179,19 @@ func isFileExist(fpath string) bool {
 }
 
 func LookupIP(data string) []string {
-	ips, err := net.LookupIP(data)
+	ips, err := lookupIP(net.LookupIP, data)
 	if err != nil {
 		return nil
 	}
+	return ips
+}
+
+// lookupIP resolves data using resolve returning the sorted addresses.
+func lookupIP(resolve func(string) ([]net.IP, error), data string) ([]string, error) {
+	ips, err := resolve(data)
+	if err != nil {
+		return nil, fmt.Errorf("lookup ip: %w", err)
+	}
 	// "Cast" IPs into strings and sort the array
 	ipStrings := make([]string, len(ips))
 
@@ -186,23 +199,23 @@ func LookupIP(data string) []string {
 		ipStrings[i] = ip.String()
 	}
 	sort.Strings(ipStrings)
-	return ipStrings
+	return ipStrings, nil
 }
 
 func LookupIPV4(data string) []string {
-	var addresses []string
-	for _, ip := range LookupIP(data) {
-		if strings.Contains(ip, ".") {
-			addresses = append(addresses, ip)
-		}
-	}
-	return addresses
+	return filterIPs(LookupIP(data), ".")
 }
 
 func LookupIPV6(data string) []string {
+	return filterIPs(LookupIP(data), ":")
+}
+
+// filterIPs returns the addresses containing separator (. for IPv4 and : for
+// IPv6).
+func filterIPs(ips []string, separator string) []string {
 	var addresses []string
-	for _, ip := range LookupIP(data) {
-		if strings.Contains(ip, ":") {
+	for _, ip := range ips {
+		if strings.Contains(ip, separator) {
 			addresses = append(addresses, ip)
 		}
 	}
@@ -210,14 +223,26 @@ func LookupIPV6(data string) []string {
 }
 
 func LookupSRV(service, proto, name string) []*net.SRV {
-	_, addrs, err := net.LookupSRV(service, proto, name)
+	addrs, err := lookupSRV(net.LookupSRV, service, proto, name)
 	if err != nil {
 		return []*net.SRV{}
 	}
-	sort.Sort(sortSRV(addrs))
 	return addrs
 }
 
+// lookupSRV resolves the SRV records using resolve returning them sorted.
+func lookupSRV(
+	resolve func(service, proto, name string) (string, []*net.SRV, error),
+	service, proto, name string,
+) ([]*net.SRV, error) {
+	_, addrs, err := resolve(service, proto, name)
+	if err != nil {
+		return nil, fmt.Errorf("lookup srv: %w", err)
+	}
+	sort.Sort(sortSRV(addrs))
+	return addrs, nil
+}
+
 // MarshalJSON will return the JSON encoded representation of the supplied
 // data.
 func MarshalJSON(data interface{}) (string, error) {
@@ -263,6 +288,7 @@ func NewFuncMap(s *memkv.Store) map[string]interface{} {
 	m["getenv"] = Getenv
 	m["getksvs"] = getksvs(s)
 	m["getsvs"] = getsvs(s)
+	m["indent"] = Indent
 	m["join"] = strings.Join
 	m["json"] = UnmarshalJSONObject
 	m["jsonArray"] = UnmarshalJSONArray
@@ -273,6 +299,7 @@ func NewFuncMap(s *memkv.Store) map[string]interface{} {
 	m["map"] = CreateMap
 	m["mod"] = func(a, b int) int { return a % b }
 	m["mul"] = func(a, b int) int { return a * b }
+	m["nindent"] = Nindent
 	m["parseBool"] = strconv.ParseBool
 	m["regexReplace"] = RegexReplace
 	m["replace"] = strings.Replace
@@ -286,9 +313,21 @@ func NewFuncMap(s *memkv.Store) map[string]interface{} {
 	m["toLower"] = strings.ToLower
 	m["toUpper"] = strings.ToUpper
 	m["trimSuffix"] = strings.TrimSuffix
+	addSprigFuncs(m)
 	return m
 }
 
+// Indent prefixes every line of v with spaces spaces.
+func Indent(spaces int, v string) string {
+	pad := strings.Repeat(" ", spaces)
+	return pad + strings.ReplaceAll(v, "\n", "\n"+pad)
+}
+
+// Nindent is Indent preceded by a newline.
+func Nindent(spaces int, v string) string {
+	return "\n" + Indent(spaces, v)
+}
+
 // RegexReplace maps to regexp.ReplaceAllString
 func RegexReplace(regex, src, repl string) (string, error) {
 	re, err := regexp.Compile(regex)
@@ -5,11 +5,18 @@ package template
 import (
 	"fmt"
 	"os"
+	"os/exec"
+	"sync"
 	"syscall"
 )
 
-// MkdirAllNoUmask is os.MkdirAll that ignores the current unix umask.
-func MkdirAllNoUmask(path string, perms os.FileMode) error {
+// umaskLock serializes changes to the process wide umask.
+var umaskLock sync.Mutex
+
+// mkdirAllNoUmask is os.MkdirAll that ignores the current unix umask.
+func mkdirAllNoUmask(path string, perms os.FileMode) error {
+	umaskLock.Lock()
+	defer umaskLock.Unlock()
 	existing := syscall.Umask(0)
 	defer syscall.Umask(existing)
 	err := os.MkdirAll(path, perms)
@@ -18,3 +25,31 @@ func MkdirAllNoUmask(path string, perms os.FileMode) error {
 	}
 	return nil
 }
+
+// ShellCommand returns a command that will run command using sh.
+func ShellCommand(command string) *exec.Cmd {
+	return exec.Command("sh", "-c", command)
+}
+
+// fileOwner returns the uid and gid of the file described by info.
+func fileOwner(info os.FileInfo) (int, int, bool) {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return -1, -1, false
+	}
+	return int(stat.Uid), int(stat.Gid), true
+}
+
+// syncDir flushes the entries of dir (ie: a rename into it) to disk.
+func syncDir(dir string) error {
+	f, err := os.Open(dir)
+	if err != nil {
+		return fmt.Errorf("open dir: %w", err)
+	}
+	defer func() { _ = f.Close() }()
+	err = f.Sync()
+	if err != nil {
+		return fmt.Errorf("sync dir: %w", err)
+	}
+	return nil
+}
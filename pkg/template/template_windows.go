@@ -2,10 +2,29 @@ package template
 
 import (
 	"os"
+	"os/exec"
 )
 
-// MkdirAllNoUmask is os.MkdirAll that ignores the current unix umask.
-func MkdirAllNoUmask(path string, perms os.FileMode) error {
+// mkdirAllNoUmask is os.MkdirAll that ignores the current unix umask.
+func mkdirAllNoUmask(path string, perms os.FileMode) error {
 	// syscall.Umask is not available on windows
 	return os.MkdirAll(path, perms)
 }
+
+// ShellCommand returns a command that will run command using cmd.
+func ShellCommand(command string) *exec.Cmd {
+	return exec.Command("cmd", "/C", command)
+}
+
+// fileOwner returns the uid and gid of the file described by info.
+func fileOwner(_ os.FileInfo) (int, int, bool) {
+	// ownership is not supported on windows
+	return -1, -1, false
+}
+
+// syncDir flushes the entries of dir (ie: a rename into it) to disk.
+func syncDir(_ string) error {
+	// folders can not be opened for sync on windows, renames are durable
+	// once MoveFileEx returns
+	return nil
+}
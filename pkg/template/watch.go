@@ -0,0 +1,195 @@
+package template
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// DefaultWatchInterval is the polling interval used by NewWatcher when none is
+// specified.
+const DefaultWatchInterval = time.Second
+
+// Watcher watches a set of files and folders (recursively) for changes.
+// File system events (inotify, kqueue, ReadDirectoryChangesW) are used to
+// notice changes as soon as they happen, while polling every interval is the
+// fallback for where events are unavailable or missed (ie: network file
+// systems). Either way changes are detected by comparing the files against
+// their previous state, so that the symlink swapping kubernetes uses to update
+// ConfigMap and Secret volumes is handled.
+type Watcher struct {
+	paths    []string
+	interval time.Duration
+	debounce time.Duration
+	state    map[string]fileState
+	// notify is nil if file system events are unavailable.
+	notify *fsnotify.Watcher
+}
+
+type fileState struct {
+	modTime time.Time
+	size    int64
+	mode    os.FileMode
+}
+
+// NewWatcher returns a watcher for paths that polls every interval in
+// addition to listening for file system events. Changes are reported once no
+// further changes have been seen for debounce. Paths that do not (yet) exist
+// are watched for creation. Close releases the file system events.
+func NewWatcher(paths []string, interval, debounce time.Duration) *Watcher {
+	if interval <= 0 {
+		interval = DefaultWatchInterval
+	}
+	cleaned := make([]string, len(paths))
+	for i, path := range paths {
+		cleaned[i] = filepath.Clean(path)
+	}
+	w := &Watcher{
+		paths:    cleaned,
+		interval: interval,
+		debounce: debounce,
+		state:    snapshot(cleaned),
+	}
+	notify, err := fsnotify.NewWatcher()
+	if err == nil {
+		w.notify = notify
+		w.addNotifyPaths()
+	}
+	return w
+}
+
+// Close stops listening for file system events.
+func (w *Watcher) Close() error {
+	if w.notify == nil {
+		return nil
+	}
+	err := w.notify.Close()
+	if err != nil {
+		return fmt.Errorf("close watcher: %w", err)
+	}
+	return nil
+}
+
+// addNotifyPaths listens for events in every existing folder being watched
+// and the folders containing the watched files (to see them replaced or
+// created). Folders that fail to be added are left to polling.
+func (w *Watcher) addNotifyPaths() {
+	for _, root := range w.paths {
+		_ = w.notify.Add(filepath.Dir(root))
+		_ = filepath.Walk(root, func(path string, _ os.FileInfo, err error) error {
+			if err != nil {
+				return nil //nolint:nilerr // left to polling
+			}
+			if info, err := os.Stat(path); err == nil && info.IsDir() {
+				_ = w.notify.Add(path)
+			}
+			return nil
+		})
+	}
+}
+
+// Wait blocks until files have been created, modified or removed and returns
+// their (cleaned) paths in sorted order. An error is only returned if ctx is
+// done.
+func (w *Watcher) Wait(ctx context.Context) ([]string, error) {
+	changed := map[string]bool{}
+	var lastChange time.Time
+	ticker := time.NewTicker(w.interval)
+	defer ticker.Stop()
+	settled := time.NewTimer(w.debounce)
+	settled.Stop()
+	defer settled.Stop()
+
+	var events <-chan fsnotify.Event
+	var errs <-chan error
+	if w.notify != nil {
+		events = w.notify.Events
+		errs = w.notify.Errors
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-errs:
+			// missed events are caught by polling
+			continue
+		case <-events:
+		case <-ticker.C:
+		case <-settled.C:
+		}
+
+		now := time.Now()
+		current := snapshot(w.paths)
+		diff := diffStates(w.state, current)
+		w.state = current
+		if len(diff) > 0 {
+			for _, path := range diff {
+				changed[path] = true
+			}
+			lastChange = now
+			settled.Reset(w.debounce)
+			if w.notify != nil {
+				// listen in folders created since
+				w.addNotifyPaths()
+			}
+		}
+		if len(changed) > 0 && now.Sub(lastChange) >= w.debounce {
+			paths := make([]string, 0, len(changed))
+			for path := range changed {
+				paths = append(paths, path)
+			}
+			sort.Strings(paths)
+			return paths, nil
+		}
+	}
+}
+
+func (s fileState) equal(other fileState) bool {
+	return s.modTime.Equal(other.modTime) && s.size == other.size && s.mode == other.mode
+}
+
+func snapshot(paths []string) map[string]fileState {
+	state := map[string]fileState{}
+	for _, root := range paths {
+		// errors are ignored so that missing or unreadable files are simply
+		// absent from the snapshot and reported when they reappear
+		_ = filepath.Walk(root, func(path string, _ os.FileInfo, err error) error {
+			if err != nil {
+				return nil //nolint:nilerr // see above
+			}
+			// stat rather than the walk info so that symlinks are followed
+			info, err := os.Stat(path)
+			if err != nil || info.IsDir() {
+				return nil //nolint:nilerr // see above
+			}
+			state[path] = fileState{
+				modTime: info.ModTime(),
+				size:    info.Size(),
+				mode:    info.Mode(),
+			}
+			return nil
+		})
+	}
+	return state
+}
+
+func diffStates(previous, current map[string]fileState) []string {
+	diff := []string{}
+	for path, state := range current {
+		if prev, ok := previous[path]; !ok || !prev.equal(state) {
+			diff = append(diff, path)
+		}
+	}
+	for path := range previous {
+		if _, ok := current[path]; !ok {
+			diff = append(diff, path)
+		}
+	}
+	return diff
+}
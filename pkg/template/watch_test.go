@@ -0,0 +1,68 @@
+package template
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWatcher(t *testing.T) {
+	temp := t.TempDir()
+	file := filepath.Join(temp, "config.yml")
+	folder := filepath.Join(temp, "templates")
+	require.NoError(t, os.WriteFile(file, []byte("a: 1"), 0600))
+	require.NoError(t, os.Mkdir(folder, 0700))
+	missing := filepath.Join(temp, "missing.yml")
+
+	watcher := NewWatcher([]string{file, folder, missing}, 10*time.Millisecond, 30*time.Millisecond)
+	defer func() { _ = watcher.Close() }()
+	wait := func() []string {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		changed, err := watcher.Wait(ctx)
+		require.NoError(t, err)
+		return changed
+	}
+
+	require.NoError(t, os.WriteFile(file, []byte("a: 12"), 0600))
+	assert.Equal(t, []string{file}, wait())
+
+	nested := filepath.Join(folder, "sub", "a.clconf")
+	require.NoError(t, os.MkdirAll(filepath.Dir(nested), 0700))
+	require.NoError(t, os.WriteFile(nested, []byte("a"), 0600))
+	require.NoError(t, os.WriteFile(missing, []byte("a: 1"), 0600))
+	assert.Equal(t, []string{missing, nested}, wait())
+
+	require.NoError(t, os.Remove(nested))
+	assert.Equal(t, []string{nested}, wait())
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := watcher.Wait(ctx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestWatcherEvents(t *testing.T) {
+	temp := t.TempDir()
+	file := filepath.Join(temp, "config.yml")
+	require.NoError(t, os.WriteFile(file, []byte("a: 1"), 0600))
+
+	// polling would not notice the change before the timeout
+	watcher := NewWatcher([]string{file}, time.Hour, 10*time.Millisecond)
+	defer func() { _ = watcher.Close() }()
+	if watcher.notify == nil {
+		t.Skip("file system events unavailable")
+	}
+
+	require.NoError(t, os.WriteFile(file, []byte("a: 12"), 0600))
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	changed, err := watcher.Wait(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{file}, changed)
+}
@@ -44,21 +44,30 @@ func UnmarshalAllYaml(yamlString string) ([]interface{}, error) {
 // objects, and return the resulting map. If a root node is a list it will be
 // converted to an int map prior to merging. An emtpy document returns nil.
 func UnmarshalYamlInterface(yamlStrings ...string) (interface{}, error) {
-	// We collect all the yamls into a base string map so mergo can handle them as
-	// subnodes for consistentcy (mergo doesn't like conflicting types in root
-	// nodes)
-	var allYamls []map[string]interface{}
+	var docs []interface{}
 	for _, yamlString := range yamlStrings {
 		yamls, err := UnmarshalAllYaml(yamlString)
 		if err != nil {
 			return nil, err
 		}
-		for _, yaml := range yamls {
-			// We do this to maintain backward compatibility with empty docs being
-			// treated as an empty map
-			if yaml != nil {
-				allYamls = append(allYamls, map[string]interface{}{"root": yaml})
-			}
+		docs = append(docs, yamls...)
+	}
+	return MergeInterfaces(docs...)
+}
+
+// MergeInterfaces will merge the supplied, already unmarshaled, yaml documents
+// in order (last takes precedence) and return the result. Nil documents are
+// ignored and if no documents remain an empty map is returned.
+func MergeInterfaces(docs ...interface{}) (interface{}, error) {
+	// We collect all the yamls into a base string map so mergo can handle them as
+	// subnodes for consistentcy (mergo doesn't like conflicting types in root
+	// nodes)
+	var allYamls []map[string]interface{}
+	for _, yaml := range docs {
+		// We do this to maintain backward compatibility with empty docs being
+		// treated as an empty map
+		if yaml != nil {
+			allYamls = append(allYamls, map[string]interface{}{"root": yaml})
 		}
 	}
 